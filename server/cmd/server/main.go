@@ -22,21 +22,20 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"go.uber.org/zap"
 
 	_ "github.com/GabbyWorld/all-time-high-backend/docs" // 导入生成的Swagger文档
 	"github.com/GabbyWorld/all-time-high-backend/internal/config"
 	"github.com/GabbyWorld/all-time-high-backend/internal/logger"
-	// "github.com/GabbyWorld/all-time-high-backend/internal/models"
 	"github.com/GabbyWorld/all-time-high-backend/internal/repository"
 	"github.com/GabbyWorld/all-time-high-backend/internal/router"
 	"github.com/GabbyWorld/all-time-high-backend/pkg/utils"
 	"github.com/joho/godotenv"
-	// "gorm.io/gorm"
 )
 
-// main 是应用程序的入口点
+// main 是应用程序的入口点。不带参数时启动服务器，"stats rebuild" 子命令用于从战斗记录重建战绩
 func main() {
 	// 加载环境变量
 	if err := godotenv.Load(); err != nil {
@@ -58,89 +57,65 @@ func main() {
 	}
 	defer logger.SyncLogger()
 
+	// 子命令只连接数据库，不做迁移和数据补齐
+	if len(os.Args) > 1 {
+		db, err := repository.Connect(cfg)
+		if err != nil {
+			logger.Logger.Fatal("Could not connect to the database", zap.Error(err))
+		}
+		code := runCommand(db, os.Args[1:])
+		logger.SyncLogger()
+		os.Exit(code)
+	}
+
 	// 连接数据库并自动迁移
 	repo, err := repository.NewRepository(cfg)
 	if err != nil {
 		logger.Logger.Fatal("Could not connect to the database", zap.Error(err))
 	}
 
-	// 更新代理统计数据
-	// if err := updateAgentStatistics(repo.DB); err != nil {
-	// 	log.Fatalf("Failed to update agent statistics: %v", err)
-	// }
-
 	// 初始化JWTManager
 	jwtManager, err := utils.NewJWTManager(cfg.JWT.Secret, cfg.JWT.Expiration)
 	if err != nil {
 		logger.Logger.Fatal("Could not initialize JWT Manager", zap.Error(err))
 	}
 
+	// 初始化价格来源，由 PRICE_PROVIDER 选择
+	prices, err := utils.NewPriceProvider(utils.PriceProviderOptions{
+		Kind:             cfg.Price.Provider,
+		BaseURL:          cfg.Price.JupiterURL,
+		Timeout:          cfg.Price.Timeout,
+		ChunkSize:        cfg.Price.ChunkSize,
+		Concurrency:      cfg.Price.Concurrency,
+		ReplayFile:       cfg.Price.ReplayFile,
+		Sources:          cfg.Price.Sources,
+		DexScreenerURL:   cfg.Price.DexScreenerURL,
+		RPCEndpoint:      cfg.Solana.RPCEndpoint,
+		PumpProgramID:    cfg.Solana.PumpProgramID,
+		BreakerThreshold: cfg.Price.BreakerThreshold,
+		BreakerCooldown:  cfg.Price.BreakerCooldown,
+	})
+	if err != nil {
+		logger.Logger.Fatal("Could not initialize price provider", zap.Error(err))
+	}
+
+	// 读取 pump.fun 联合曲线，用于跟踪进度和毕业；没有有效的 PUMP_PROGRAM_ID 时关闭联合曲线跟踪和交易索引
+	var curves *utils.BondingCurveReader
+	if cfg.Solana.PumpProgramID == "" {
+		logger.Logger.Warn("PUMP_PROGRAM_ID is not configured, bonding curve tracking is disabled")
+	} else if curves, err = utils.NewBondingCurveReader(cfg.Solana.RPCEndpoint, cfg.Solana.PumpProgramID); err != nil {
+		logger.Logger.Warn("Could not initialize bonding curve reader, bonding curve tracking is disabled", zap.Error(err))
+		curves = nil
+	}
+
 	// 打印数据库连接状态（可选）
 	logger.Logger.Info("Database connection established and migrations run")
 
-	// 设置路由，并传递数据库实例和JWTManager
-	r := router.SetupRouter(repo.DB, jwtManager, cfg)
+	// 设置路由，并传递数据库实例、JWTManager、价格来源和联合曲线读取器
+	r := router.SetupRouter(repo.DB, jwtManager, prices, curves, cfg)
 
 	// 启动服务器
 	if err := r.Run(":" + cfg.Server.Port); err != nil {
 		logger.Logger.Fatal("Could not run the server", zap.Error(err))
 	}
 }
-
-// func updateAgentStatistics(db *gorm.DB) error {
-// 	var agents []models.Agent
-// 	if err := db.Find(&agents).Error; err != nil {
-// 		return err
-// 	}
-
-// 	for _, agent := range agents {
-// 		var total int64
-// 		var wins int64
-// 		var losses int64
-
-// 		// 获取该代理参与的所有战斗，作为攻击者或防御者
-// 		var battles []models.Battle
-// 		if err := db.Where("attacker_id = ? OR defender_id = ?", agent.ID, agent.ID).Find(&battles).Error; err != nil {
-// 			return err
-// 		}
-
-// 		total = int64(len(battles))
-
-// 		// 计算胜利和失败次数
-// 		for _, battle := range battles {
-// 			if battle.AttackerID == agent.ID {
-// 				// 作为攻击者
-// 				if battle.Outcome == "TOTAL_VICTORY" || battle.Outcome == "NARROW_VICTORY" {
-// 					wins++
-// 				} else {
-// 					losses++
-// 				}
-// 			} else if battle.DefenderID == agent.ID {
-// 				// 作为防御者
-// 				if battle.Outcome == "CRUSHING_DEFEAT" || battle.Outcome == "NARROW_DEFEAT" {
-// 					wins++
-// 				} else {
-// 					losses++
-// 				}
-// 			}
-// 		}
-
-// 		// 计算胜率
-// 		var winRate float64
-// 		if total > 0 {
-// 			winRate = float64(wins) / float64(total) * 100
-// 		}
-
-// 		// 更新代理的统计数据
-// 		agent.Total = int(total)
-// 		agent.Wins = int(wins)
-// 		agent.Losses = int(losses)
-// 		agent.WinRate = winRate
-
-// 		// 保存更新
-// 		if err := db.Save(&agent).Error; err != nil {
-// 			return err
-// 		}
-// 	}
-// 	return nil
-// }
@@ -0,0 +1,66 @@
+// cmd/server/stats.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/stats"
+	"gorm.io/gorm"
+)
+
+// runCommand 执行命令行子命令，返回进程退出码
+func runCommand(db *gorm.DB, args []string) int {
+	if len(args) >= 2 && args[0] == "stats" && args[1] == "rebuild" {
+		return runStatsRebuild(db, args[2:])
+	}
+	fmt.Fprintln(os.Stderr, "usage: server stats rebuild [--agent id] [--dry-run] [--batch-size n]")
+	return 2
+}
+
+// runStatsRebuild 从战斗记录重建 Agent 的战绩和 Elo 分数，并打印发生变化的 Agent
+func runStatsRebuild(db *gorm.DB, args []string) int {
+	fs := flag.NewFlagSet("stats rebuild", flag.ContinueOnError)
+	agentID := fs.Uint("agent", 0, "only write back this agent (all agents when 0)")
+	dryRun := fs.Bool("dry-run", false, "print the diff without writing it")
+	batchSize := fs.Int("batch-size", stats.DefaultBatchSize, "battles read per batch")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	opts := stats.Options{DryRun: *dryRun, BatchSize: *batchSize}
+	if *agentID != 0 {
+		id := *agentID
+		opts.AgentID = &id
+	}
+
+	report, err := stats.Rebuild(db, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "stats rebuild failed: %v\n", err)
+		return 1
+	}
+	printStatsReport(report)
+	return 0
+}
+
+func printStatsReport(report *stats.Report) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "AGENT\tNAME\tTOTAL\tWINS\tLOSSES\tDRAWS\tWIN RATE\tRATING")
+	for _, diff := range report.Changed {
+		b, a := diff.Before, diff.After
+		fmt.Fprintf(w, "%d\t%s\t%d -> %d\t%d -> %d\t%d -> %d\t%d -> %d\t%.2f -> %.2f\t%.1f -> %.1f\n",
+			diff.AgentID, diff.Name,
+			b.Total, a.Total, b.Wins, a.Wins, b.Losses, a.Losses, b.Draws, a.Draws,
+			b.WinRate, a.WinRate, b.Rating, a.Rating)
+	}
+	w.Flush()
+
+	action, historyAction := "updated", "Rewrote"
+	if report.DryRun {
+		action, historyAction = "would update", "Would rewrite"
+	}
+	fmt.Printf("Replayed %d battles, %s %d of %d agents\n", report.Battles, action, len(report.Changed), report.Agents)
+	fmt.Printf("%s rating history of %d agents\n", historyAction, report.HistoryRewritten)
+}
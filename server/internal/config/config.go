@@ -1,8 +1,14 @@
 package config
 
 import (
+	"fmt"
 	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/gagliardetto/solana-go"
 	"github.com/spf13/viper"
 )
 
@@ -17,6 +23,11 @@ type Config struct {
 	AWS             AWSConfig
 	CORS            CORSConfig
 	Solana          SolanaConfig
+	Battle          BattleConfig
+	Admin           AdminConfig
+	Price           PriceConfig
+	Webhook         WebhookConfig
+	Indexer         IndexerConfig
 }
 
 type ServerConfig struct {
@@ -94,7 +105,138 @@ type SolanaConfig struct {
 	IPFSURL          string `mapstructure:"SOLANA_IPFS_URL"`
 	TradeURL         string `mapstructure:"SOLANA_TRADE_URL"`
 	TokenProgramID   string `mapstructure:"SOLANA_TOKEN_PROGRAM_ID"`
-	MockCreateToken  bool   `mapstructure:"MOCK_CREATE_TOKEN"`
+	// pump.fun 程序地址，用于联合曲线和交易索引；无效时为空，相关功能关闭
+	PumpProgramID   string `mapstructure:"PUMP_PROGRAM_ID"`
+	MockCreateToken bool   `mapstructure:"MOCK_CREATE_TOKEN"`
+}
+
+type BattleConfig struct {
+	MatchmakingStrategy string        // random, rating_band, market_cap_band, avoid_rematch
+	RatingBand          float64       // rating_band 策略允许的分差
+	MarketCapBand       float64       // market_cap_band 策略允许的市值倍数
+	RematchWindow       time.Duration // avoid_rematch 策略的回避时间窗口
+	JobWorkers          int           // 同时执行战斗任务的 worker 数量
+	JobMaxAttempts      int           // 战斗任务的最大尝试次数
+	JobBackoff          time.Duration // 首次重试的等待时间，之后指数增长
+	JobPollInterval     time.Duration // worker 轮询任务表的间隔
+	JobLeaseTimeout     time.Duration // running 状态超过该时长（且超过一场战斗的最坏耗时）的任务视为中断，重新放回队列
+	TriggerPolicy       string        // any_increase, threshold, new_ath
+	TriggerThresholdPct float64       // threshold 策略要求的涨幅（百分比）
+	TriggerOnGraduation bool          // 代币联合曲线完成（毕业）时是否触发一场战斗，与 TriggerPolicy 独立
+	MonitorInterval     time.Duration // 轮询价格并检查战斗触发的间隔；开启交易索引后成交会实时触发
+	JudgePanel          []JudgeSpec   // 裁判团，每个裁判一次独立调用
+	JudgeAggregation    string        // majority, mean_margin
+	SeasonLength        time.Duration // 每个赛季的时长
+	ChallengeCooldown   time.Duration // 同一 Agent 两次发起挑战之间的最短间隔
+	AttackCooldown      time.Duration // 同一 Agent 两次作为攻击者之间的最短间隔，0 表示不限制
+	DefenderCooldown    time.Duration // 同一 Agent 两次作为防御者之间的最短间隔，0 表示不限制
+	MaxBattlesPerHour   int           // 每个 Agent 每小时最多参与的战斗数（攻防合计），0 表示不限制
+	PairRematchWindow   time.Duration // 同一对 Agent 再次交手的最短间隔，0 表示不限制
+	Rounds              int           // 每场战斗的回合数，1 表示只由裁判团直接判决
+	MatchupCacheTTL     time.Duration // 对阵战绩接口的缓存时间，0 表示不缓存
+}
+
+// JudgeSpec 单个裁判使用的模型和温度
+type JudgeSpec struct {
+	Model       string
+	Temperature float64
+}
+
+type AdminConfig struct {
+	WalletAddresses []string // 允许访问管理接口的钱包地址
+}
+
+type IndexerConfig struct {
+	Enabled        bool          // 是否通过 websocket 实时索引 pump.fun 成交
+	BackfillLimit  int           // 每次补齐时每个代币最多读取的交易数，没有补完的区间下次继续
+	ReconnectDelay time.Duration // 连接断开后首次重连的等待时间，之后指数增长
+	SyncInterval   time.Duration // 重新加载需要订阅的代币列表的间隔
+	// 持有人和成交量统计
+	AnalyticsInterval time.Duration // 采集 Agent 社区数据的间隔，每天的快照取当天最后一次采集
+}
+
+type WebhookConfig struct {
+	URLs    []string      // 接收事件的地址，为空时不推送
+	Secret  string        // 请求体签名使用的密钥，为空时不签名
+	Timeout time.Duration // 单次推送的超时时间
+}
+
+type PriceConfig struct {
+	Provider   string        // jupiter, fake, replay, composite
+	JupiterURL string        // Jupiter Price API 地址
+	Timeout    time.Duration // 单次价格请求的超时时间
+	CacheTTL   time.Duration // 接口读取价格的缓存时间，过期后先返回旧价格再后台刷新
+	ReplayFile string        // replay 价格来源使用的脚本文件（PriceSnapshot 的 JSON 数组）
+	// 分片取价
+	ChunkSize   int // 每次请求的代币数
+	Concurrency int // 同时进行的请求数
+	// 市值计算
+	MarketCapInterval time.Duration // 后台刷新市值的间隔
+	SupplyTTL         time.Duration // 链上供应量的缓存时长，过期后重新读取
+	// 价格快照的保留策略，0 表示不合并或不删除
+	SnapshotRawRetention time.Duration // 原始快照保留的时长，之后按小时合并
+	SnapshotRetention    time.Duration // 快照（含合并后）保留的时长
+	// composite 价格来源
+	Sources          []string      // 按优先级排列的来源
+	DexScreenerURL   string        // DexScreener API 地址
+	BreakerThreshold int           // 来源连续失败多少次后熔断
+	BreakerCooldown  time.Duration // 熔断时长，之后放行一次试探请求
+	// pump.fun 联合曲线
+	CurveRefreshInterval time.Duration // 读取联合曲线进度的间隔
+}
+
+// MatchmakingStrategies 支持的匹配策略
+var MatchmakingStrategies = []string{"random", "rating_band", "market_cap_band", "avoid_rematch"}
+
+// TriggerPolicies 支持的战斗触发策略
+var TriggerPolicies = []string{"any_increase", "threshold", "new_ath"}
+
+// JudgeAggregations 支持的裁判团汇总方式
+var JudgeAggregations = []string{"majority", "mean_margin"}
+
+// PriceProviders 支持的价格来源
+var PriceProviders = []string{"jupiter", "fake", "replay", "composite"}
+
+// PriceSources composite 价格来源可组合的来源
+var PriceSources = []string{"jupiter", "dexscreener", "pumpfun"}
+
+// parseList 解析以逗号分隔的列表，忽略空项
+func parseList(value string) []string {
+	var list []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// parseJudgePanel 解析 "model:temperature" 以逗号分隔的裁判列表，例如 "gpt-4o:0.2,gpt-4o:0.8,gpt-4o-mini:0.5"
+func parseJudgePanel(value string) ([]JudgeSpec, error) {
+	var panel []JudgeSpec
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		model, temperature, found := strings.Cut(entry, ":")
+		spec := JudgeSpec{Model: strings.TrimSpace(model), Temperature: 1}
+		if found {
+			t, err := strconv.ParseFloat(strings.TrimSpace(temperature), 64)
+			if err != nil || t < 0 || t > 2 {
+				return nil, fmt.Errorf("invalid temperature in judge %q", entry)
+			}
+			spec.Temperature = t
+		}
+		if spec.Model == "" {
+			return nil, fmt.Errorf("missing model in judge %q", entry)
+		}
+		panel = append(panel, spec)
+	}
+	if len(panel) == 0 {
+		return nil, fmt.Errorf("judge panel is empty")
+	}
+	return panel, nil
 }
 
 func LoadConfig() *Config {
@@ -136,10 +278,67 @@ func LoadConfig() *Config {
 	viper.SetDefault("SOLANA_IPFS_URL", "https://pump.fun/api/ipfs")
 	viper.SetDefault("SOLANA_TRADE_URL", "https://pumpportal.fun/api/trade-local")
 	viper.SetDefault("SOLANA_TOKEN_PROGRAM_ID", "6EF8rcorrecthR5Dkzon8Nwu78hRvfCKubJ14M5uBEwF6P")
+	viper.SetDefault("PUMP_PROGRAM_ID", "6EF8rrecthR5Dkzon8Nwu78hRvfCKubJ14M5uBEwF6P")
 	viper.SetDefault("MOCK_CREATE_TOKEN", false)
+	// 战斗匹配配置默认值
+	viper.SetDefault("BATTLE_MATCHMAKING_STRATEGY", "random")
+	viper.SetDefault("BATTLE_RATING_BAND", 200)
+	viper.SetDefault("BATTLE_MARKET_CAP_BAND", 5)
+	viper.SetDefault("BATTLE_REMATCH_WINDOW", "24h")
+	viper.SetDefault("BATTLE_JOB_WORKERS", 2)
+	viper.SetDefault("BATTLE_JOB_MAX_ATTEMPTS", 5)
+	viper.SetDefault("BATTLE_JOB_BACKOFF", "30s")
+	viper.SetDefault("BATTLE_JOB_POLL_INTERVAL", "5s")
+	viper.SetDefault("BATTLE_JOB_LEASE_TIMEOUT", "10m")
+	viper.SetDefault("BATTLE_TRIGGER_POLICY", "any_increase")
+	viper.SetDefault("BATTLE_TRIGGER_THRESHOLD_PCT", 5)
+	viper.SetDefault("BATTLE_TRIGGER_ON_GRADUATION", false)
+	viper.SetDefault("PRICE_MONITOR_INTERVAL", "5m")
+	viper.SetDefault("JUDGE_PANEL", "gpt-4o:1")
+	viper.SetDefault("JUDGE_AGGREGATION", "majority")
+	viper.SetDefault("SEASON_LENGTH", "720h") // 30天
+	viper.SetDefault("BATTLE_CHALLENGE_COOLDOWN", "1h")
+	viper.SetDefault("BATTLE_ATTACK_COOLDOWN", "15m")
+	viper.SetDefault("BATTLE_DEFENDER_COOLDOWN", "10m")
+	viper.SetDefault("BATTLE_MAX_PER_HOUR", 6)
+	viper.SetDefault("BATTLE_PAIR_REMATCH_WINDOW", "1h")
+	viper.SetDefault("BATTLE_ROUNDS", 1)
+	viper.SetDefault("BATTLE_MATCHUP_CACHE_TTL", "5m")
+	viper.SetDefault("ADMIN_WALLET_ADDRESSES", []string{})
+	// 价格来源配置默认值
+	viper.SetDefault("PRICE_PROVIDER", "jupiter")
+	viper.SetDefault("JUPITER_PRICE_URL", "https://api.jup.ag/price/v2")
+	viper.SetDefault("PRICE_TIMEOUT", "10s")
+	viper.SetDefault("PRICE_CHUNK_SIZE", 100)
+	viper.SetDefault("PRICE_CONCURRENCY", 4)
+	viper.SetDefault("PRICE_CACHE_TTL", "30s")
+	viper.SetDefault("PRICE_SNAPSHOT_RAW_RETENTION", "168h") // 7天
+	viper.SetDefault("PRICE_SNAPSHOT_RETENTION", "8760h")    // 365天
+	viper.SetDefault("PRICE_REPLAY_FILE", "")
+	viper.SetDefault("MARKET_CAP_REFRESH_INTERVAL", "1m")
+	viper.SetDefault("TOKEN_SUPPLY_TTL", "24h")
+	viper.SetDefault("PRICE_SOURCES", "jupiter,dexscreener,pumpfun")
+	viper.SetDefault("DEXSCREENER_URL", "https://api.dexscreener.com")
+	viper.SetDefault("PRICE_BREAKER_THRESHOLD", 3)
+	viper.SetDefault("PRICE_BREAKER_COOLDOWN", "1m")
+	viper.SetDefault("BONDING_CURVE_REFRESH_INTERVAL", "1m")
+	// Webhook 配置默认值
+	viper.SetDefault("WEBHOOK_URLS", "")
+	viper.SetDefault("WEBHOOK_SECRET", "")
+	viper.SetDefault("WEBHOOK_TIMEOUT", "10s")
+	// 交易索引配置默认值
+	viper.SetDefault("TRADE_INDEXER_ENABLED", true)
+	viper.SetDefault("TRADE_BACKFILL_LIMIT", 1000)
+	viper.SetDefault("TRADE_INDEXER_RECONNECT_DELAY", "5s")
+	viper.SetDefault("TRADE_INDEXER_SYNC_INTERVAL", "1m")
+	viper.SetDefault("ANALYTICS_INTERVAL", "1h")
 	if err := viper.ReadInConfig(); err != nil {
 		log.Println("No config file found, reading from environment variables")
 	}
+	judgePanel, err := parseJudgePanel(viper.GetString("JUDGE_PANEL"))
+	if err != nil {
+		log.Fatalf("Invalid JUDGE_PANEL: %v", err)
+	}
 	config := &Config{
 		Server: ServerConfig{
 			Port: viper.GetString("SERVER_PORT"),
@@ -207,8 +406,73 @@ func LoadConfig() *Config {
 			IPFSURL:          viper.GetString("SOLANA_IPFS_URL"),
 			TradeURL:         viper.GetString("SOLANA_TRADE_URL"),
 			TokenProgramID:   viper.GetString("SOLANA_TOKEN_PROGRAM_ID"),
+			PumpProgramID:    viper.GetString("PUMP_PROGRAM_ID"),
 			MockCreateToken:  viper.GetBool("MOCK_CREATE_TOKEN"),
 		},
+		Battle: BattleConfig{
+			MatchmakingStrategy: viper.GetString("BATTLE_MATCHMAKING_STRATEGY"),
+			RatingBand:          viper.GetFloat64("BATTLE_RATING_BAND"),
+			MarketCapBand:       viper.GetFloat64("BATTLE_MARKET_CAP_BAND"),
+			RematchWindow:       viper.GetDuration("BATTLE_REMATCH_WINDOW"),
+			JobWorkers:          viper.GetInt("BATTLE_JOB_WORKERS"),
+			JobMaxAttempts:      viper.GetInt("BATTLE_JOB_MAX_ATTEMPTS"),
+			JobBackoff:          viper.GetDuration("BATTLE_JOB_BACKOFF"),
+			JobPollInterval:     viper.GetDuration("BATTLE_JOB_POLL_INTERVAL"),
+			JobLeaseTimeout:     viper.GetDuration("BATTLE_JOB_LEASE_TIMEOUT"),
+			TriggerPolicy:       viper.GetString("BATTLE_TRIGGER_POLICY"),
+			TriggerThresholdPct: viper.GetFloat64("BATTLE_TRIGGER_THRESHOLD_PCT"),
+			TriggerOnGraduation: viper.GetBool("BATTLE_TRIGGER_ON_GRADUATION"),
+			MonitorInterval:     viper.GetDuration("PRICE_MONITOR_INTERVAL"),
+			JudgePanel:          judgePanel,
+			JudgeAggregation:    viper.GetString("JUDGE_AGGREGATION"),
+			SeasonLength:        viper.GetDuration("SEASON_LENGTH"),
+			ChallengeCooldown:   viper.GetDuration("BATTLE_CHALLENGE_COOLDOWN"),
+			AttackCooldown:      viper.GetDuration("BATTLE_ATTACK_COOLDOWN"),
+			DefenderCooldown:    viper.GetDuration("BATTLE_DEFENDER_COOLDOWN"),
+			MaxBattlesPerHour:   viper.GetInt("BATTLE_MAX_PER_HOUR"),
+			PairRematchWindow:   viper.GetDuration("BATTLE_PAIR_REMATCH_WINDOW"),
+			Rounds:              viper.GetInt("BATTLE_ROUNDS"),
+			MatchupCacheTTL:     viper.GetDuration("BATTLE_MATCHUP_CACHE_TTL"),
+		},
+		Admin: AdminConfig{
+			WalletAddresses: viper.GetStringSlice("ADMIN_WALLET_ADDRESSES"),
+		},
+		Price: PriceConfig{
+			Provider:   viper.GetString("PRICE_PROVIDER"),
+			JupiterURL: viper.GetString("JUPITER_PRICE_URL"),
+			Timeout:    viper.GetDuration("PRICE_TIMEOUT"),
+			CacheTTL:   viper.GetDuration("PRICE_CACHE_TTL"),
+			ReplayFile: viper.GetString("PRICE_REPLAY_FILE"),
+			// 分片取价
+			ChunkSize:   viper.GetInt("PRICE_CHUNK_SIZE"),
+			Concurrency: viper.GetInt("PRICE_CONCURRENCY"),
+			// 市值计算
+			MarketCapInterval: viper.GetDuration("MARKET_CAP_REFRESH_INTERVAL"),
+			SupplyTTL:         viper.GetDuration("TOKEN_SUPPLY_TTL"),
+			// 价格快照保留策略
+			SnapshotRawRetention: viper.GetDuration("PRICE_SNAPSHOT_RAW_RETENTION"),
+			SnapshotRetention:    viper.GetDuration("PRICE_SNAPSHOT_RETENTION"),
+			// composite 价格来源
+			Sources:          parseList(viper.GetString("PRICE_SOURCES")),
+			DexScreenerURL:   viper.GetString("DEXSCREENER_URL"),
+			BreakerThreshold: viper.GetInt("PRICE_BREAKER_THRESHOLD"),
+			BreakerCooldown:  viper.GetDuration("PRICE_BREAKER_COOLDOWN"),
+			// pump.fun 联合曲线
+			CurveRefreshInterval: viper.GetDuration("BONDING_CURVE_REFRESH_INTERVAL"),
+		},
+		Webhook: WebhookConfig{
+			URLs:    parseList(viper.GetString("WEBHOOK_URLS")),
+			Secret:  viper.GetString("WEBHOOK_SECRET"),
+			Timeout: viper.GetDuration("WEBHOOK_TIMEOUT"),
+		},
+		Indexer: IndexerConfig{
+			Enabled:        viper.GetBool("TRADE_INDEXER_ENABLED"),
+			BackfillLimit:  viper.GetInt("TRADE_BACKFILL_LIMIT"),
+			ReconnectDelay: viper.GetDuration("TRADE_INDEXER_RECONNECT_DELAY"),
+			SyncInterval:   viper.GetDuration("TRADE_INDEXER_SYNC_INTERVAL"),
+			// 持有人和成交量统计
+			AnalyticsInterval: viper.GetDuration("ANALYTICS_INTERVAL"),
+		},
 	}
 
 	// 验证必要的配置项
@@ -224,6 +488,64 @@ func LoadConfig() *Config {
 	if config.Solana.SignerPrivateKey == "" {
 		log.Fatal("Solana private keys are required. Please set SOLANA_SIGNER_PRIVATE_KEY.")
 	}
+	if !slices.Contains(MatchmakingStrategies, config.Battle.MatchmakingStrategy) {
+		log.Fatalf("Unknown matchmaking strategy %q. Please set BATTLE_MATCHMAKING_STRATEGY to one of %v.", config.Battle.MatchmakingStrategy, MatchmakingStrategies)
+	}
+	if !slices.Contains(TriggerPolicies, config.Battle.TriggerPolicy) {
+		log.Fatalf("Unknown battle trigger policy %q. Please set BATTLE_TRIGGER_POLICY to one of %v.", config.Battle.TriggerPolicy, TriggerPolicies)
+	}
+	if !slices.Contains(JudgeAggregations, config.Battle.JudgeAggregation) {
+		log.Fatalf("Unknown judge aggregation %q. Please set JUDGE_AGGREGATION to one of %v.", config.Battle.JudgeAggregation, JudgeAggregations)
+	}
+	if config.Battle.Rounds < 1 || config.Battle.Rounds > 10 {
+		log.Fatalf("Invalid battle rounds %d. Please set BATTLE_ROUNDS between 1 and 10.", config.Battle.Rounds)
+	}
+	if !slices.Contains(PriceProviders, config.Price.Provider) {
+		log.Fatalf("Unknown price provider %q. Please set PRICE_PROVIDER to one of %v.", config.Price.Provider, PriceProviders)
+	}
+	if config.Price.MarketCapInterval <= 0 {
+		log.Fatal("Invalid market cap refresh interval. Please set MARKET_CAP_REFRESH_INTERVAL to a positive duration.")
+	}
+	if config.Price.Provider == "replay" && config.Price.ReplayFile == "" {
+		log.Fatal("Replay price provider requires a script. Please set PRICE_REPLAY_FILE.")
+	}
+	if config.Battle.MonitorInterval <= 0 {
+		log.Fatal("Invalid price monitor interval. Please set PRICE_MONITOR_INTERVAL to a positive duration.")
+	}
+	if config.Indexer.Enabled && (config.Indexer.ReconnectDelay <= 0 || config.Indexer.SyncInterval <= 0) {
+		log.Fatal("Invalid trade indexer intervals. Please set TRADE_INDEXER_RECONNECT_DELAY and TRADE_INDEXER_SYNC_INTERVAL to positive durations.")
+	}
+	if config.Indexer.AnalyticsInterval <= 0 {
+		log.Fatal("Invalid analytics interval. Please set ANALYTICS_INTERVAL to a positive duration.")
+	}
+	if config.Price.CurveRefreshInterval <= 0 {
+		log.Fatal("Invalid bonding curve refresh interval. Please set BONDING_CURVE_REFRESH_INTERVAL to a positive duration.")
+	}
+	// pump.fun 程序地址无效时只关闭联合曲线跟踪和交易索引，不阻止服务启动
+	if config.Solana.PumpProgramID == "" {
+		log.Println("Warning: PUMP_PROGRAM_ID is not set, bonding curve tracking and trade indexing are disabled.")
+	} else if _, err := solana.PublicKeyFromBase58(config.Solana.PumpProgramID); err != nil {
+		log.Printf("Warning: invalid PUMP_PROGRAM_ID %q (%v), bonding curve tracking and trade indexing are disabled.", config.Solana.PumpProgramID, err)
+		config.Solana.PumpProgramID = ""
+	}
+	if config.Price.Provider == "composite" {
+		if len(config.Price.Sources) == 0 {
+			log.Fatal("Composite price provider requires sources. Please set PRICE_SOURCES.")
+		}
+		for _, source := range config.Price.Sources {
+			if !slices.Contains(PriceSources, source) {
+				log.Fatalf("Unknown price source %q. Please set PRICE_SOURCES to a comma-separated list of %v.", source, PriceSources)
+			}
+		}
+		// 联合曲线来源依赖 pump.fun 程序地址，没有有效地址时从组合中去掉
+		if config.Solana.PumpProgramID == "" && slices.Contains(config.Price.Sources, "pumpfun") {
+			log.Println("Warning: PUMP_PROGRAM_ID is not valid, removing the pumpfun price source.")
+			config.Price.Sources = slices.DeleteFunc(config.Price.Sources, func(source string) bool { return source == "pumpfun" })
+			if len(config.Price.Sources) == 0 {
+				log.Fatal("Composite price provider has no usable sources. Please set PUMP_PROGRAM_ID or add other PRICE_SOURCES.")
+			}
+		}
+	}
 
 	log.Printf("Server will run on port: %s", config.Server.Port)
 	log.Printf("Connecting to database: %s@%s:%d/%s with SSL mode: %s", config.Database.User, config.Database.Host, config.Database.Port, config.Database.DBName, config.Database.SSLMode)
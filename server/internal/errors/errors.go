@@ -14,6 +14,8 @@ const (
 	ErrUnauthorized      ErrorCode = "UNAUTHORIZED"
 	ErrForbidden         ErrorCode = "FORBIDDEN"
 	ErrNotFound          ErrorCode = "NOT_FOUND"
+	ErrConflict          ErrorCode = "CONFLICT"
+	ErrRateLimited       ErrorCode = "RATE_LIMITED"
 	ErrInternal          ErrorCode = "INTERNAL_ERROR"
 	ErrDatabase          ErrorCode = "DATABASE_ERROR"
 	ErrValidation        ErrorCode = "VALIDATION_ERROR"
@@ -64,6 +66,10 @@ func GetHTTPStatus(code ErrorCode) int {
 		return http.StatusForbidden
 	case ErrNotFound:
 		return http.StatusNotFound
+	case ErrConflict:
+		return http.StatusConflict
+	case ErrRateLimited:
+		return http.StatusTooManyRequests
 	case ErrInternal, ErrDatabase, ErrTokenGeneration:
 		return http.StatusInternalServerError
 	default:
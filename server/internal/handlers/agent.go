@@ -22,8 +22,13 @@ type AgentHandler struct {
 	DB         *gorm.DB
 	Config     *config.Config
 	JWTManager *utils.JWTManager
+	Prices     *utils.PriceCache
+	MarketCaps *MarketCapService
 }
 
+// initialPumpPriceSOL pump.fun 新代币在曲线起点的价格（SOL），作为新 Agent 的初始历史最高价
+const initialPumpPriceSOL = 2.92e-8
+
 // AgentRequest 请求体
 type AgentRequest struct {
 	Name   string `json:"name" binding:"required,max=100"`
@@ -47,6 +52,9 @@ type AgentResponse struct {
 	Wins              int       `json:"wins"`     // 新增
 	Losses            int       `json:"losses"`   // 新增
 	WinRate           float64   `json:"win_rate"` // 新增
+	Rating            float64   `json:"rating"`
+	CurveProgress     float64   `json:"curve_progress"` // pump.fun 联合曲线完成度（0-1）
+	Graduated         bool      `json:"graduated"`
 }
 
 // CreateAgent godoc
@@ -221,8 +229,9 @@ func (h *AgentHandler) CreateAgent(c *gin.Context) {
 		TokenAddress:      tokenAddress,
 		UserID:            userID, // 关联用户ID
 		CreatedAt:         time.Now(),
-		HighestPrice:      2.92e-8,
+		HighestPrice:      initialPumpPriceSOL,
 		UserWalletAddress: userWalletAddress,
+		Rating:            utils.DefaultRating,
 	}
 
 	if err := tx.Create(&agent).Error; err != nil {
@@ -242,13 +251,16 @@ func (h *AgentHandler) CreateAgent(c *gin.Context) {
 		return
 	}
 
+	// 读取新代币的链上供应量并计算市值，失败时由后台任务补齐
+	agents := []models.Agent{agent}
+	h.MarketCaps.Refresh(c.Request.Context(), agents)
+	agent = agents[0]
+
 	// 通知 WebSocket，有新的 Agent 创建
 	logger.Logger.Info("Sending agent to AgentCreatedChan", zap.Uint("agent_id", agent.ID))
 
 	AgentCreatedChan <- agent
 
-	marketCap := agent.HighestPrice * 1e9
-
 	// logger.Logger.Info("CreateAgent: agent created with token address", zap.Uint("agent_id", agent.ID), zap.Uint("user_id", userID), zap.String("token_address", tokenAddress))
 	c.JSON(http.StatusCreated, AgentResponse{
 		ID:                agent.ID,
@@ -260,7 +272,8 @@ func (h *AgentHandler) CreateAgent(c *gin.Context) {
 		TokenAddress:      agent.TokenAddress,
 		CreatedAt:         agent.CreatedAt,
 		UserWalletAddress: userWalletAddress,
-		MarketCap:         marketCap,
+		MarketCap:         agent.MarketCap,
+		Rating:            agent.Rating,
 	})
 }
 
@@ -364,13 +377,8 @@ func (h *AgentHandler) GetUserAgents(c *gin.Context) {
 	for i, agent := range agents {
 		tokenAddresses[i] = agent.TokenAddress
 	}
-	prices, err := utils.GetMultipleTokenPrice(tokenAddresses)
-	if err != nil {
-		apiErr := errors.NewAPIError(errors.ErrInternal, "Failed to get token prices", err.Error())
-		c.Error(apiErr)
-		logger.Logger.Error("GetUserAgents: failed to get token prices", zap.Error(err))
-		return
-	}
+	// 上游不可用时返回最后已知的价格，并以 price_stale 标记
+	quotes := h.Prices.Quotes(c.Request.Context(), tokenAddresses, "")
 
 	type agentWithFormattedTime struct {
 		ID                 uint      `json:"id"`
@@ -383,7 +391,11 @@ func (h *AgentHandler) GetUserAgents(c *gin.Context) {
 		CreatedAt          time.Time `json:"created_at"`
 		MarketCap          float64   `json:"market_cap"`
 		MarketCapUpdatedAt time.Time `json:"market_cap_updated_at"`
+		PriceStale         bool      `json:"price_stale"`
+		CurveProgress      float64   `json:"curve_progress"`
+		Graduated          bool      `json:"graduated"`
 		UserWalletAddress  string    `json:"user_wallet_address"`
+		Rating             float64   `json:"rating"`
 	}
 
 	type AgentsPaginatedResponse struct {
@@ -396,8 +408,8 @@ func (h *AgentHandler) GetUserAgents(c *gin.Context) {
 	var response AgentsPaginatedResponse
 
 	for _, agent := range agents {
-		price := prices[agent.TokenAddress]
-		marketCap := price * 1e9 // 根据需求，这里假设总供应量为1e9
+		quote, ok := quotes[agent.TokenAddress]
+		marketCap, marketCapUpdatedAt := liveMarketCap(agent, quote, ok)
 		response.Agents = append(response.Agents, agentWithFormattedTime{
 			ID:                 agent.ID,
 			Name:               agent.Name,
@@ -408,8 +420,12 @@ func (h *AgentHandler) GetUserAgents(c *gin.Context) {
 			TokenAddress:       agent.TokenAddress,
 			CreatedAt:          agent.CreatedAt,
 			MarketCap:          marketCap,
-			MarketCapUpdatedAt: time.Now(),
+			MarketCapUpdatedAt: marketCapUpdatedAt,
+			PriceStale:         quote.Stale,
+			CurveProgress:      agent.CurveProgress,
+			Graduated:          agent.Graduated,
 			UserWalletAddress:  agent.UserWalletAddress,
+			Rating:             agent.Rating,
 		})
 	}
 
@@ -476,13 +492,8 @@ func (h *AgentHandler) GetAllAgents(c *gin.Context) {
 	for i, agent := range agents {
 		tokenAddresses[i] = agent.TokenAddress
 	}
-	prices, err := utils.GetMultipleTokenPrice(tokenAddresses)
-	if err != nil {
-		apiErr := errors.NewAPIError(errors.ErrInternal, "Failed to get token prices", err.Error())
-		c.Error(apiErr)
-		logger.Logger.Error("GetAllAgents: failed to get token prices", zap.Error(err))
-		return
-	}
+	// 上游不可用时返回最后已知的价格，并以 price_stale 标记
+	quotes := h.Prices.Quotes(c.Request.Context(), tokenAddresses, "")
 
 	type agentWithFormattedTime struct {
 		ID                 uint      `json:"id"`
@@ -495,7 +506,11 @@ func (h *AgentHandler) GetAllAgents(c *gin.Context) {
 		CreatedAt          time.Time `json:"created_at"`
 		MarketCap          float64   `json:"market_cap"`
 		MarketCapUpdatedAt time.Time `json:"market_cap_updated_at"`
+		PriceStale         bool      `json:"price_stale"`
+		CurveProgress      float64   `json:"curve_progress"`
+		Graduated          bool      `json:"graduated"`
 		UserWalletAddress  string    `json:"user_wallet_address"`
+		Rating             float64   `json:"rating"`
 	}
 
 	type AgentsPaginatedResponse struct {
@@ -508,8 +523,8 @@ func (h *AgentHandler) GetAllAgents(c *gin.Context) {
 	var response AgentsPaginatedResponse
 
 	for _, agent := range agents {
-		price := prices[agent.TokenAddress]
-		marketCap := price * 1e9 // 根据需求，这里假设总供应量为1e9
+		quote, ok := quotes[agent.TokenAddress]
+		marketCap, marketCapUpdatedAt := liveMarketCap(agent, quote, ok)
 
 		response.Agents = append(response.Agents, agentWithFormattedTime{
 			ID:                 agent.ID,
@@ -521,8 +536,12 @@ func (h *AgentHandler) GetAllAgents(c *gin.Context) {
 			TokenAddress:       agent.TokenAddress,
 			CreatedAt:          agent.CreatedAt,
 			MarketCap:          marketCap,
-			MarketCapUpdatedAt: time.Now(),
+			MarketCapUpdatedAt: marketCapUpdatedAt,
+			PriceStale:         quote.Stale,
+			CurveProgress:      agent.CurveProgress,
+			Graduated:          agent.Graduated,
 			UserWalletAddress:  agent.UserWalletAddress,
+			Rating:             agent.Rating,
 		})
 	}
 
@@ -572,14 +591,17 @@ func (h *AgentHandler) GetAgentByID(c *gin.Context) {
 
 	// 将数据库记录转换为返回体
 	response := AgentResponse{
-		ID:           agent.ID,
-		Name:         agent.Name,
-		Ticker:       agent.Ticker,
-		Prompt:       agent.Prompt,
-		Description:  agent.Description,
-		ImageURL:     agent.ImageURL,
-		TokenAddress: agent.TokenAddress,
-		CreatedAt:    agent.CreatedAt,
+		ID:            agent.ID,
+		Name:          agent.Name,
+		Ticker:        agent.Ticker,
+		Prompt:        agent.Prompt,
+		Description:   agent.Description,
+		ImageURL:      agent.ImageURL,
+		TokenAddress:  agent.TokenAddress,
+		CreatedAt:     agent.CreatedAt,
+		Rating:        agent.Rating,
+		CurveProgress: agent.CurveProgress,
+		Graduated:     agent.Graduated,
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -591,31 +613,83 @@ type LeaderboardResponse struct {
 }
 
 type AgentInfo struct {
-	ID          uint      `json:"id"`
-	Name        string    `json:"name"`
-	Ticker      string    `json:"ticker"`
-	Wins        int       `json:"wins"`
-	WinRate     float64   `json:"win_rate"`
-	CreatedAt   time.Time `json:"created_at"`
-	ImageURL    string    `json:"image_url"`
-	Description string    `json:"description"`
-	MarketCap   float64   `json:"market_cap"`
+	ID            uint      `json:"id"`
+	Name          string    `json:"name"`
+	Ticker        string    `json:"ticker"`
+	Wins          int       `json:"wins"`
+	WinRate       float64   `json:"win_rate"`
+	CreatedAt     time.Time `json:"created_at"`
+	ImageURL      string    `json:"image_url"`
+	Description   string    `json:"description"`
+	MarketCap     float64   `json:"market_cap"`
+	PriceStale    bool      `json:"price_stale"`
+	Rating        float64   `json:"rating"`
+	CurveProgress float64   `json:"curve_progress"`
+	Graduated     bool      `json:"graduated"`
+	TractionScore float64   `json:"traction_score"`
+}
+
+// leaderboardOrders 排行榜支持的排序模式
+var leaderboardOrders = map[string]string{
+	"wins":   "wins DESC, win_rate DESC, created_at ASC",
+	"rating": "rating DESC, wins DESC, created_at ASC",
+	// 社区热度，由每日社区数据快照计算，只用于总榜
+	"traction": "traction_score DESC, wins DESC, created_at ASC",
+}
+
+// seasonLeaderboardOrders 赛季排行榜的排序模式，与归档排名使用相同的规则
+var seasonLeaderboardOrders = map[string]string{
+	"wins":   "wins DESC, win_rate DESC, rating DESC, agent_id ASC",
+	"rating": "rating DESC, wins DESC, agent_id ASC",
 }
 
 // GetLeaderboard 获取排行榜前100名的 Agent
 // @Summary 获取排行榜
-// @Description 获取按照胜利次数、胜率和创建时间排序的前100名 Agent
+// @Description 获取前100名 Agent，默认按照胜利次数、胜率和创建时间排序，sort=rating 时按 Elo 分数排序，
+// @Description sort=traction 时按社区热度（持有人、交易者和成交量）排序。
+// @Description 指定 season 时返回该赛季的战绩，已归档的赛季返回最终排名（不支持 traction）
 // @Tags Agent
 // @Produce json
+// @Param sort query string false "排序模式: wins(默认)、rating 或 traction"
+// @Param season query string false "赛季: current 或赛季 ID，不传时为总榜"
 // @Success 200 {object} LeaderboardResponse "成功返回排行榜"
+// @Failure 400 {object} errors.APIError "请求参数错误"
+// @Failure 404 {object} errors.APIError "赛季不存在"
 // @Failure 500 {object} errors.APIError "服务器错误"
 // @Router /api/leaderboard [get]
 func (h *AgentHandler) GetLeaderboard(c *gin.Context) {
+	sortMode := c.DefaultQuery("sort", "wins")
+	order, ok := leaderboardOrders[sortMode]
+	if !ok {
+		apiErr := errors.NewAPIError(errors.ErrValidation, "Invalid sort mode", sortMode)
+		c.Error(apiErr)
+		logger.Logger.Error("GetLeaderboard: invalid sort mode", zap.String("sort", sortMode))
+		return
+	}
+
 	var agents []models.Agent
+	var records map[uint]models.SeasonRecord
 
-	// 查询符合条件的前100名 Agent
-	if err := h.DB.
-		Order("wins DESC, win_rate DESC, created_at ASC").
+	// 查询符合条件的前100名 Agent，指定赛季时按赛季战绩排名
+	if param := c.Query("season"); param != "" {
+		seasonOrder, ok := seasonLeaderboardOrders[sortMode]
+		if !ok {
+			c.Error(errors.NewAPIError(errors.ErrValidation, "Sort mode not supported for season leaderboard", sortMode))
+			return
+		}
+		var err error
+		agents, records, err = h.seasonLeaderboard(param, seasonOrder)
+		if err != nil {
+			apiErr, ok := err.(*errors.APIError)
+			if !ok {
+				apiErr = errors.NewAPIError(errors.ErrDatabase, "Failed to get season leaderboard", err.Error())
+			}
+			c.Error(apiErr)
+			logger.Logger.Error("GetLeaderboard: failed to get season leaderboard", zap.String("season", param), zap.Error(err))
+			return
+		}
+	} else if err := h.DB.
+		Order(order).
 		Limit(100).
 		Find(&agents).Error; err != nil {
 		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to get leaderboard", err.Error())
@@ -630,35 +704,167 @@ func (h *AgentHandler) GetLeaderboard(c *gin.Context) {
 		tokenAddresses[i] = agent.TokenAddress
 	}
 
-	// 使用 GetMultipleTokenPrice 获取价格
-	prices, err := utils.GetMultipleTokenPrice(tokenAddresses)
-	if err != nil {
-		apiErr := errors.NewAPIError(errors.ErrInternal, "Failed to get token prices", err.Error())
-		c.Error(apiErr)
-		logger.Logger.Error("GetLeaderboard: failed to get token prices", zap.Error(err))
-		return
-	}
+	// 批量获取 USD 价格
+	// 上游不可用时返回最后已知的价格，并以 price_stale 标记
+	quotes := h.Prices.Quotes(c.Request.Context(), tokenAddresses, "")
 
 	// 构建响应数据
 	var leaderboard []AgentInfo
 	for _, agent := range agents {
-		price := prices[agent.TokenAddress]
-		marketCap := price * 1e9 // 假设总供应量为 1e9
-
-		leaderboard = append(leaderboard, AgentInfo{
-			ID:          agent.ID,
-			Name:        agent.Name,
-			Ticker:      agent.Ticker,
-			Wins:        agent.Wins,
-			WinRate:     agent.WinRate,
-			CreatedAt:   agent.CreatedAt,
-			ImageURL:    agent.ImageURL,
-			Description: agent.Description,
-			MarketCap:   marketCap,
-		})
+		quote, ok := quotes[agent.TokenAddress]
+		marketCap, _ := liveMarketCap(agent, quote, ok)
+
+		info := AgentInfo{
+			ID:            agent.ID,
+			Name:          agent.Name,
+			Ticker:        agent.Ticker,
+			Wins:          agent.Wins,
+			WinRate:       agent.WinRate,
+			CreatedAt:     agent.CreatedAt,
+			ImageURL:      agent.ImageURL,
+			Description:   agent.Description,
+			MarketCap:     marketCap,
+			PriceStale:    quote.Stale,
+			Rating:        agent.Rating,
+			CurveProgress: agent.CurveProgress,
+			Graduated:     agent.Graduated,
+			TractionScore: agent.TractionScore,
+		}
+		if record, ok := records[agent.ID]; ok {
+			info.Wins = record.Wins
+			info.WinRate = record.WinRate
+			info.Rating = record.Rating
+		}
+		leaderboard = append(leaderboard, info)
 	}
 
 	c.JSON(http.StatusOK, LeaderboardResponse{
 		Leaderboard: leaderboard,
 	})
 }
+
+// seasonLeaderboard 返回赛季排行榜前100名的 Agent（按排名顺序）及其赛季战绩。
+// 已归档的赛季读取最终排名，进行中的赛季读取实时战绩
+func (h *AgentHandler) seasonLeaderboard(param, order string) ([]models.Agent, map[uint]models.SeasonRecord, error) {
+	season, err := resolveSeason(h.DB, h.Config.Battle.SeasonLength, param)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var stats []models.AgentSeasonStats
+	query := h.DB.Model(&models.AgentSeasonStats{})
+	if season.ArchivedAt != nil {
+		query = h.DB.Table("season_standings")
+		if order == seasonLeaderboardOrders["wins"] {
+			order = "rank ASC"
+		}
+	}
+	if err := query.Where("season_id = ?", season.ID).Order(order).Limit(100).Find(&stats).Error; err != nil {
+		return nil, nil, err
+	}
+
+	ids := make([]uint, len(stats))
+	records := make(map[uint]models.SeasonRecord, len(stats))
+	for i, s := range stats {
+		ids[i] = s.AgentID
+		records[s.AgentID] = s.SeasonRecord
+	}
+
+	var found []models.Agent
+	if len(ids) > 0 {
+		if err := h.DB.Where("id IN ?", ids).Find(&found).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+	byID := make(map[uint]models.Agent, len(found))
+	for _, agent := range found {
+		byID[agent.ID] = agent
+	}
+
+	// 保持排名顺序，已删除的 Agent 不再展示
+	agents := make([]models.Agent, 0, len(ids))
+	for _, id := range ids {
+		if agent, ok := byID[id]; ok {
+			agents = append(agents, agent)
+		}
+	}
+	return agents, records, nil
+}
+
+// RatingHistoryResponse Agent 分数变化记录
+type RatingHistoryResponse struct {
+	AgentID uint                   `json:"agent_id"`
+	Rating  float64                `json:"rating"`
+	History []models.RatingHistory `json:"history"`
+}
+
+// GetRatingHistory godoc
+// @Summary 获取 Agent 的分数变化记录
+// @Description 按时间升序返回指定 Agent 每场战斗后的 Elo 分数变化
+// @Tags Agent
+// @Produce json
+// @Param id path int true "Agent ID"
+// @Param from query string false "起始时间 (RFC3339)"
+// @Param to query string false "结束时间 (RFC3339)"
+// @Success 200 {object} RatingHistoryResponse "成功返回分数记录"
+// @Failure 400 {object} errors.APIError "请求参数错误"
+// @Failure 404 {object} errors.APIError "未找到"
+// @Failure 500 {object} errors.APIError "服务器错误"
+// @Router /api/agents/{id}/rating_history [get]
+func (h *AgentHandler) GetRatingHistory(c *gin.Context) {
+	agentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		apiErr := errors.NewAPIError(errors.ErrValidation, "Invalid agent ID", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("GetRatingHistory: invalid agent ID", zap.Error(err))
+		return
+	}
+
+	var agent models.Agent
+	if err := h.DB.First(&agent, agentID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apiErr := errors.NewAPIError(errors.ErrNotFound, "Agent not found", err.Error())
+			c.Error(apiErr)
+			logger.Logger.Error("GetRatingHistory: agent not found", zap.Error(err))
+			return
+		}
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to retrieve agent", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("GetRatingHistory: failed to retrieve agent", zap.Error(err))
+		return
+	}
+
+	query := h.DB.Where("agent_id = ?", agentID)
+	if from := c.Query("from"); from != "" {
+		fromTime, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			apiErr := errors.NewAPIError(errors.ErrValidation, "Invalid from time", err.Error())
+			c.Error(apiErr)
+			return
+		}
+		query = query.Where("created_at >= ?", fromTime)
+	}
+	if to := c.Query("to"); to != "" {
+		toTime, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			apiErr := errors.NewAPIError(errors.ErrValidation, "Invalid to time", err.Error())
+			c.Error(apiErr)
+			return
+		}
+		query = query.Where("created_at <= ?", toTime)
+	}
+
+	history := []models.RatingHistory{}
+	if err := query.Order("created_at ASC, id ASC").Find(&history).Error; err != nil {
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to retrieve rating history", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("GetRatingHistory: failed to retrieve rating history", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, RatingHistoryResponse{
+		AgentID: agent.ID,
+		Rating:  agent.Rating,
+		History: history,
+	})
+}
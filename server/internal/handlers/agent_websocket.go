@@ -78,7 +78,8 @@ func init() {
 // ======================================================
 
 type AgentWebSocketHandler struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	Prices *utils.PriceCache
 }
 
 var upgrader = websocket.Upgrader{
@@ -162,13 +163,9 @@ func (h *AgentWebSocketHandler) HandleAgentWebSocket(c *gin.Context) {
 					return
 				}
 
-				// 从第三方函数获取当前 Token 价格
-				price, err := utils.GetTokenPrice(agent.TokenAddress)
-				if err != nil {
-					logger.Logger.Error("Failed to get token price", zap.Error(err))
-					continue
-				}
-				marketCap := price * 1e9
+				// 获取当前 Token 价格，新代币可能暂时没有报价
+				quote, ok := h.Prices.Quotes(ctx, []string{agent.TokenAddress}, "")[agent.TokenAddress]
+				marketCap, marketCapUpdatedAt := liveMarketCap(agent, quote, ok)
 
 				// 这里对 Agent 做一次简单格式化，以便发送到前端
 				formattedAgent := struct {
@@ -182,6 +179,9 @@ func (h *AgentWebSocketHandler) HandleAgentWebSocket(c *gin.Context) {
 					CreatedAt          string  `json:"created_at"`
 					MarketCap          float64 `json:"market_cap"`
 					MarketCapUpdatedAt string  `json:"market_cap_updated_at"`
+					PriceStale         bool    `json:"price_stale"`
+					CurveProgress      float64 `json:"curve_progress"`
+					Graduated          bool    `json:"graduated"`
 				}{
 					ID:                 agent.ID,
 					Name:               agent.Name,
@@ -192,7 +192,10 @@ func (h *AgentWebSocketHandler) HandleAgentWebSocket(c *gin.Context) {
 					TokenAddress:       agent.TokenAddress,
 					CreatedAt:          agent.CreatedAt.Format("2006-01-02 15:04:05"),
 					MarketCap:          marketCap,
-					MarketCapUpdatedAt: time.Now().Format("2006-01-02 15:04:05"),
+					MarketCapUpdatedAt: marketCapUpdatedAt.Format("2006-01-02 15:04:05"),
+					PriceStale:         quote.Stale,
+					CurveProgress:      agent.CurveProgress,
+					Graduated:          agent.Graduated,
 				}
 
 				// 序列化成 JSON
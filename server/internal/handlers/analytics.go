@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/config"
+	"github.com/GabbyWorld/all-time-high-backend/internal/errors"
+	"github.com/GabbyWorld/all-time-high-backend/internal/logger"
+	"github.com/GabbyWorld/all-time-high-backend/internal/models"
+	"github.com/GabbyWorld/all-time-high-backend/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 社区数据接口可查询的天数
+const (
+	defaultAnalyticsDays = 30
+	maxAnalyticsDays     = 365
+)
+
+// AnalyticsService 定期采集 Agent 代币的持有人、集中度和 24 小时成交数据，写入每日快照并更新社区热度
+type AnalyticsService struct {
+	db      *gorm.DB
+	holders *utils.TokenHolderReader
+	Config  *config.Config
+}
+
+func NewAnalyticsService(db *gorm.DB, holders *utils.TokenHolderReader, config *config.Config) *AnalyticsService {
+	return &AnalyticsService{db: db, holders: holders, Config: config}
+}
+
+// Start 按 ANALYTICS_INTERVAL 采集社区数据
+func (s *AnalyticsService) Start() {
+	go func() {
+		ticker := time.NewTicker(s.Config.Indexer.AnalyticsInterval)
+		defer ticker.Stop()
+		for ; true; <-ticker.C {
+			if err := s.Collect(context.Background(), time.Now()); err != nil {
+				logger.Logger.Error("Failed to collect agent analytics", zap.Error(err))
+			}
+		}
+	}()
+}
+
+// tradeVolume 一个 Agent 在统计窗口内的成交汇总
+type tradeVolume struct {
+	AgentID       uint
+	BuyLamports   float64
+	SellLamports  float64
+	Buys          int
+	Sells         int
+	UniqueTraders int
+}
+
+// Collect 采集所有 Agent 的社区数据并覆盖当天（UTC）的快照。持有人读取失败时沿用当天已有的持有人数据
+func (s *AnalyticsService) Collect(ctx context.Context, now time.Time) error {
+	var agents []models.Agent
+	if err := s.db.Where("token_address <> ''").Find(&agents).Error; err != nil {
+		return err
+	}
+	if len(agents) == 0 {
+		return nil
+	}
+
+	var rows []tradeVolume
+	err := s.db.Raw(`SELECT agent_id,
+			COALESCE(SUM(CASE WHEN is_buy THEN sol_amount ELSE 0 END), 0) AS buy_lamports,
+			COALESCE(SUM(CASE WHEN is_buy THEN 0 ELSE sol_amount END), 0) AS sell_lamports,
+			COUNT(*) FILTER (WHERE is_buy) AS buys,
+			COUNT(*) FILTER (WHERE NOT is_buy) AS sells,
+			COUNT(DISTINCT trader) AS unique_traders
+		FROM trades
+		WHERE block_time >= ?
+		GROUP BY agent_id`, now.Add(-24*time.Hour)).Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+	volumes := make(map[uint]tradeVolume, len(rows))
+	for _, row := range rows {
+		volumes[row.AgentID] = row
+	}
+
+	date := now.UTC().Truncate(24 * time.Hour)
+	var existing []models.AgentAnalytics
+	if err := s.db.Where("date = ?", date).Find(&existing).Error; err != nil {
+		return err
+	}
+	previous := make(map[uint]models.AgentAnalytics, len(existing))
+	for _, snapshot := range existing {
+		previous[snapshot.AgentID] = snapshot
+	}
+
+	for _, agent := range agents {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		volume := volumes[agent.ID]
+		snapshot := models.AgentAnalytics{
+			AgentID:       agent.ID,
+			Date:          date,
+			BuyVolumeSOL:  volume.BuyLamports / 1e9,
+			SellVolumeSOL: volume.SellLamports / 1e9,
+			Buys:          volume.Buys,
+			Sells:         volume.Sells,
+			UniqueTraders: volume.UniqueTraders,
+		}
+		holders, err := s.holders.GetHolderStats(ctx, agent.TokenAddress)
+		if err != nil {
+			logger.Logger.Warn("Failed to read token holders", zap.Uint("agentId", agent.ID), zap.String("tokenAddress", agent.TokenAddress), zap.Error(err))
+			prev := previous[agent.ID]
+			holders = utils.HolderStats{Holders: prev.Holders, TopHolderShare: prev.TopHolderShare, Top10Share: prev.Top10Share}
+		}
+		snapshot.Holders = holders.Holders
+		snapshot.TopHolderShare = holders.TopHolderShare
+		snapshot.Top10Share = holders.Top10Share
+		snapshot.TractionScore = tractionScore(snapshot)
+
+		err = s.db.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "agent_id"}, {Name: "date"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"holders", "top_holder_share", "top10_share", "buy_volume_sol", "sell_volume_sol",
+				"buys", "sells", "unique_traders", "traction_score", "updated_at",
+			}),
+		}).Create(&snapshot).Error
+		if err != nil {
+			logger.Logger.Error("Failed to save agent analytics", zap.Uint("agentId", agent.ID), zap.Error(err))
+			continue
+		}
+		if err := s.db.Model(&models.Agent{}).Where("id = ?", agent.ID).UpdateColumn("traction_score", snapshot.TractionScore).Error; err != nil {
+			logger.Logger.Error("Failed to update agent traction score", zap.Uint("agentId", agent.ID), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// tractionScore 社区热度：持有人数、24 小时独立交易者和成交量（SOL）各取 ln(1+x) 后相加，避免单一指标主导；
+// 再按前 10 名持有人的集中度打折，筹码越集中得分越低
+func tractionScore(a models.AgentAnalytics) float64 {
+	score := math.Log1p(float64(a.Holders)) + math.Log1p(float64(a.UniqueTraders)) + math.Log1p(a.BuyVolumeSOL+a.SellVolumeSOL)
+	return score * (1 - min(a.Top10Share, 1)/2)
+}
+
+// AnalyticsResponse Agent 的社区数据
+type AnalyticsResponse struct {
+	AgentID uint                    `json:"agent_id"`
+	Latest  *models.AgentAnalytics  `json:"latest"`
+	History []models.AgentAnalytics `json:"history"` // 按日期从早到晚
+}
+
+// GetAnalytics godoc
+// @Summary 获取 Agent 社区数据
+// @Description 返回 Agent 代币的每日快照：持有人数、头部持有人集中度、24 小时买卖成交量和独立交易者数，以及社区热度得分。
+// @Description 成交数据只包含 pump.fun 联合曲线上的成交
+// @Tags Agent
+// @Produce json
+// @Param id path int true "Agent ID"
+// @Param days query int false "返回最近多少天的快照(默认为30，最多365)"
+// @Success 200 {object} AnalyticsResponse "成功返回社区数据"
+// @Failure 400 {object} errors.APIError "请求参数错误"
+// @Failure 404 {object} errors.APIError "未找到"
+// @Failure 500 {object} errors.APIError "服务器错误"
+// @Router /api/agents/{id}/analytics [get]
+func (h *AgentHandler) GetAnalytics(c *gin.Context) {
+	agentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		apiErr := errors.NewAPIError(errors.ErrValidation, "Invalid agent ID", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("GetAnalytics: invalid agent ID", zap.Error(err))
+		return
+	}
+
+	days := defaultAnalyticsDays
+	if param := c.Query("days"); param != "" {
+		days, err = strconv.Atoi(param)
+		if err != nil || days < 1 || days > maxAnalyticsDays {
+			c.Error(errors.NewAPIError(errors.ErrValidation, "Invalid days", "days must be between 1 and 365"))
+			return
+		}
+	}
+
+	var count int64
+	if err := h.DB.Model(&models.Agent{}).Where("id = ?", agentID).Count(&count).Error; err != nil {
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to retrieve agent", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("GetAnalytics: failed to retrieve agent", zap.Error(err))
+		return
+	}
+	if count == 0 {
+		c.Error(errors.NewAPIError(errors.ErrNotFound, "Agent not found", strconv.FormatUint(agentID, 10)))
+		return
+	}
+
+	since := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1-days)
+	history := []models.AgentAnalytics{}
+	if err := h.DB.Where("agent_id = ? AND date >= ?", agentID, since).Order("date ASC").Find(&history).Error; err != nil {
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to retrieve agent analytics", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("GetAnalytics: failed to retrieve agent analytics", zap.Error(err))
+		return
+	}
+
+	response := AnalyticsResponse{AgentID: uint(agentID), History: history}
+	if len(history) > 0 {
+		response.Latest = &history[len(history)-1]
+	}
+	c.JSON(http.StatusOK, response)
+}
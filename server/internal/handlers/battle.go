@@ -1,45 +1,67 @@
 package handlers
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/GabbyWorld/all-time-high-backend/internal/config"
+	"github.com/GabbyWorld/all-time-high-backend/internal/errors"
 	"github.com/GabbyWorld/all-time-high-backend/internal/logger"
 	"github.com/GabbyWorld/all-time-high-backend/internal/models"
 	"github.com/GabbyWorld/all-time-high-backend/pkg/utils"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// maxVerdictAttempts 裁判返回无效判决时的最大尝试次数
+const maxVerdictAttempts = 3
+
 type BattleService struct {
-	db        *gorm.DB
-	wsHandler *BattleWebSocketHandler
-	Config    *config.Config
+	db         *gorm.DB
+	wsHandler  *BattleWebSocketHandler
+	matchmaker Matchmaker
+	prices     utils.PriceProvider
+	Config     *config.Config
+	// 对阵战绩的缓存，每场战斗结束后清空
+	matchupCache    *utils.TTLCache[*MatchupsResponse]
+	headToHeadCache *utils.TTLCache[*HeadToHeadResponse]
 }
 
-func NewBattleService(db *gorm.DB, wsHandler *BattleWebSocketHandler, config *config.Config) *BattleService {
+func NewBattleService(db *gorm.DB, wsHandler *BattleWebSocketHandler, prices utils.PriceProvider, config *config.Config) *BattleService {
+	matchmaker, err := NewMatchmaker(config.Battle)
+	if err != nil {
+		logger.Logger.Warn("Falling back to random matchmaking", zap.Error(err))
+		matchmaker = RandomMatchmaker{}
+	}
 	return &BattleService{
-		db:        db,
-		wsHandler: wsHandler,
-		Config:    config,
+		db:              db,
+		wsHandler:       wsHandler,
+		matchmaker:      matchmaker,
+		prices:          prices,
+		Config:          config,
+		matchupCache:    utils.NewTTLCache[*MatchupsResponse](config.Battle.MatchupCacheTTL),
+		headToHeadCache: utils.NewTTLCache[*HeadToHeadResponse](config.Battle.MatchupCacheTTL),
 	}
 }
 
-func (s *BattleService) StartPriceMonitoring() {
-	ticker := time.NewTicker(5 * time.Minute)
+// StartPriceMonitoring 定期轮询价格来源，记录价格快照并触发战斗。indexer 不为空时，
+// 正在由交易索引器实时提供价格的代币只记录快照，战斗由索引器触发；已毕业或未被索引的代币照常由轮询触发
+func (s *BattleService) StartPriceMonitoring(indexer *TradeIndexer) {
+	ticker := time.NewTicker(s.Config.Battle.MonitorInterval)
 	go func() {
 		for range ticker.C {
 			logger.Logger.Info("Checking prices and triggering battles")
-			s.checkPricesAndTriggerBattles()
+			s.checkPricesAndTriggerBattles(indexer)
 		}
 	}()
 }
 
-func (s *BattleService) checkPricesAndTriggerBattles() {
+func (s *BattleService) checkPricesAndTriggerBattles(indexer *TradeIndexer) {
 	var agents []models.Agent
 	if err := s.db.Find(&agents).Error; err != nil {
 		logger.Logger.Error("Failed to fetch agents", zap.Error(err))
@@ -52,110 +74,304 @@ func (s *BattleService) checkPricesAndTriggerBattles() {
 		tokenAddresses[i] = agent.TokenAddress
 	}
 
-	prices, err := utils.GetMultipleTokenVsSOLPrice(tokenAddresses)
-	if err != nil {
+	// 部分代币取价失败（例如已下架）时，其余代币照常处理
+	prices, solSources, err := utils.GetPricesWithSources(context.Background(), s.prices, tokenAddresses, utils.SOLMint)
+	failures, partial := utils.PartialPriceErrors(err)
+	if err != nil && !partial {
 		logger.Logger.Error("Failed to get multiple token prices", zap.Error(err))
 		return
 	}
+	// USD 价格只用于价格快照，获取失败时快照中的 USD 价格留空
+	usdPrices, usdSources, err := utils.GetPricesWithSources(context.Background(), s.prices, tokenAddresses, "")
+	if err != nil {
+		logger.Logger.Warn("Failed to get token USD prices", zap.Error(err))
+	}
+	s.recordPriceSnapshots(agents, prices, usdPrices, solSources, usdSources)
 
 	for _, agent := range agents {
+		if indexer != nil && indexer.Indexed(agent.TokenAddress) {
+			continue
+		}
 		price, ok := prices[agent.TokenAddress]
 		if !ok {
 			logger.Logger.Error("Price not found for token",
 				zap.String("tokenAddress", agent.TokenAddress),
-				zap.String("agentId", strconv.FormatUint(uint64(agent.ID), 10)))
+				zap.String("agentId", strconv.FormatUint(uint64(agent.ID), 10)),
+				zap.NamedError("reason", failures[agent.TokenAddress]))
 			continue
 		}
 
-		// 如果 PreviousPrice 为 0，表示第一次获取价格，直接更新
-		if agent.PreviousPrice == 0 {
-			agent.PreviousPrice = price
-			if err := s.db.Save(&agent).Error; err != nil {
-				logger.Logger.Error("Failed to update agent's previous price", zap.Error(err))
+		s.handlePriceUpdate(agent, price)
+	}
+}
+
+// handlePriceUpdate 处理一次新的价格采样：维护历史最高价、记录 ATH 事件，并按触发策略写入战斗任务。
+// 价格列在行锁内按列更新，不会覆盖并发写入的战绩；战斗任务与价格在同一个事务中写入，不会只记录其中一个
+func (s *BattleService) handlePriceUpdate(agent models.Agent, price float64) {
+	var previousPrice float64
+	var athEvent *models.AthEvent
+	var trigger *battleTrigger
+	var skip *battleSkipError
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var current models.Agent
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "previous_price", "highest_price").
+			First(&current, agent.ID).Error; err != nil {
+			return err
+		}
+		previousPrice = current.PreviousPrice
+
+		updates := map[string]interface{}{"previous_price": price}
+		if price > current.HighestPrice {
+			updates["highest_price"] = price
+			// 如果 PreviousPrice 为 0，表示第一次获取价格，只作为基准更新；之后突破历史最高价时记录 ATH 事件
+			if previousPrice != 0 {
+				athEvent = &models.AthEvent{
+					AgentID: agent.ID,
+					OldHigh: current.HighestPrice,
+					NewHigh: price,
+				}
+				if err := tx.Create(athEvent).Error; err != nil {
+					return fmt.Errorf("record ATH event: %w", err)
+				}
 			}
-			continue
+		}
+		if err := tx.Model(&models.Agent{}).Where("id = ?", agent.ID).Updates(updates).Error; err != nil {
+			return err
 		}
 
-		// 比较当前价格与 PreviousPrice
-		if price > agent.PreviousPrice {
-			// 当前价格高于5分钟前的价格，触发战斗
-			s.triggerBattle(agent)
+		if previousPrice == 0 || !s.shouldTriggerBattle(previousPrice, price, athEvent != nil) {
+			return nil
+		}
+		trigger = &battleTrigger{Type: models.BattleTypePriceIncrease}
+		if athEvent != nil {
+			trigger = &battleTrigger{Type: models.BattleTypeAthBreakout, AthEventID: &athEvent.ID}
 		}
+		var err error
+		skip, err = s.enqueueTriggeredBattle(tx, agent, *trigger)
+		return err
+	})
+	if err != nil {
+		logger.Logger.Error("Failed to update agent's price", zap.Uint("agentId", agent.ID), zap.Error(err))
+		return
+	}
 
-		// 更新 PreviousPrice 为当前价格
+	if athEvent != nil {
 		agent.PreviousPrice = price
-		if err := s.db.Save(&agent).Error; err != nil {
-			logger.Logger.Error("Failed to update agent's previous price", zap.Error(err))
-		}
+		agent.HighestPrice = price
+		s.wsHandler.BroadcastAthEvent(*athEvent, agent)
+	}
+	if skip != nil {
+		s.reportTriggerSkip(agent.ID, trigger.Type, skip)
 	}
 }
 
-func (s *BattleService) triggerBattle(attacker models.Agent) {
-	// Find a random opponent
-	var defender models.Agent
-	if err := s.db.Where("id != ?", attacker.ID).Order("RANDOM()").First(&defender).Error; err != nil {
-		logger.Logger.Error("Failed to find opponent", zap.Error(err))
-		return
+// enqueueTriggeredBattle 在 tx 中为自动触发的战斗写入任务，攻击冷却、每小时上限或已有排队任务时返回跳过原因。
+// 检查前锁定攻击者所在行，同一 Agent 的并发触发依次执行，不会重复排队
+func (s *BattleService) enqueueTriggeredBattle(tx *gorm.DB, agent models.Agent, trigger battleTrigger) (*battleSkipError, error) {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").
+		First(&models.Agent{}, agent.ID).Error; err != nil {
+		return nil, err
 	}
-
-	// Get battle outcome from ChatGPT
-	battleDesc, err := utils.GenerateBattleOutcome(
-		s.Config.OpenAI.APIKey,
-		s.Config.OpenAI.CompletionsEndpoint,
-		attacker.Name,
-		attacker.Prompt,
-		defender.Name,
-		defender.Prompt,
-	)
+	skip, err := s.checkAttacker(tx, agent.ID, true)
 	if err != nil {
-		logger.Logger.Error("Failed to generate battle outcome", zap.Error(err))
-		return
+		return nil, fmt.Errorf("check attacker fairness: %w", err)
+	}
+	if skip != nil {
+		return skip, nil
 	}
 
-	// Determine outcome based on description
-	var outcome string
-	switch {
-	case strings.Contains(strings.ToLower(battleDesc), "total victory"):
-		outcome = "TOTAL_VICTORY"
-	case strings.Contains(strings.ToLower(battleDesc), "narrow victory"):
-		outcome = "NARROW_VICTORY"
-	case strings.Contains(strings.ToLower(battleDesc), "crushing defeat"):
-		outcome = "CRUSHING_DEFEAT"
-	case strings.Contains(strings.ToLower(battleDesc), "narrow defeat"):
-		outcome = "NARROW_DEFEAT"
+	// 写入战斗任务，由 worker 执行
+	if err := s.enqueueBattle(tx, agent, trigger); err != nil {
+		return nil, fmt.Errorf("enqueue battle job: %w", err)
+	}
+	return nil, nil
+}
+
+// reportTriggerSkip 记录自动触发因公平性规则被跳过，在写入任务的事务提交后调用
+func (s *BattleService) reportTriggerSkip(agentID uint, battleType models.BattleType, skip *battleSkipError) {
+	s.recordAttackerSkip(agentID, battleType, skip)
+	logger.Logger.Info("Battle trigger skipped", zap.Uint("agentId", agentID), zap.String("rule", skip.Rule), zap.String("detail", skip.Detail))
+}
+
+// shouldTriggerBattle 根据配置的触发策略判断本次价格变化是否触发战斗
+func (s *BattleService) shouldTriggerBattle(previousPrice, price float64, newHigh bool) bool {
+	switch s.Config.Battle.TriggerPolicy {
+	case "threshold":
+		return previousPrice > 0 && (price-previousPrice)/previousPrice*100 >= s.Config.Battle.TriggerThresholdPct
+	case "new_ath":
+		return newHigh
 	default:
-		outcome = "NARROW_VICTORY" // Default case
+		return price > previousPrice
+	}
+}
+
+// battleTrigger 描述一场战斗由什么触发
+type battleTrigger struct {
+	Type       models.BattleType
+	AthEventID *uint
+	// DefenderID 由挑战指定的对手，为空时使用匹配策略
+	DefenderID *uint
+}
+
+// triggerBattle 为攻击者匹配对手并执行一场战斗，失败时返回错误以便任务重试
+func (s *BattleService) triggerBattle(attacker models.Agent, trigger battleTrigger, run battleRun) (*models.Battle, error) {
+	// 执行前再次检查公平性规则，排队期间可能已有其他战斗
+	skip, err := s.checkAttacker(s.db, attacker.ID, false)
+	if err != nil {
+		return nil, fmt.Errorf("check attacker fairness: %w", err)
+	}
+	if skip != nil {
+		s.recordAttackerSkip(attacker.ID, trigger.Type, skip)
+		return nil, skip
+	}
+	ineligible, err := s.ineligibleDefenders(attacker)
+	if err != nil {
+		return nil, fmt.Errorf("check defender fairness: %w", err)
+	}
+
+	if trigger.DefenderID != nil {
+		if skip := ineligible[*trigger.DefenderID]; skip != nil {
+			s.recordDefenderSkips(attacker.ID, trigger.Type, map[uint]*battleSkipError{*trigger.DefenderID: skip})
+			return nil, skip
+		}
+		var defender models.Agent
+		if err := s.db.First(&defender, *trigger.DefenderID).Error; err != nil {
+			return nil, fmt.Errorf("load challenged defender: %w", err)
+		}
+		return s.runBattle(attacker, defender, models.Battle{
+			MatchStrategy:     "challenge",
+			CandidatePool:     "challenge",
+			CandidatePoolSize: 1,
+			Type:              trigger.Type,
+		}, run)
+	}
+
+	// Find an opponent with the configured matchmaking strategy, skipping agents blocked by fairness rules
+	s.recordDefenderSkips(attacker.ID, trigger.Type, ineligible)
+	excluded := make([]uint, 0, len(ineligible))
+	for id := range ineligible {
+		excluded = append(excluded, id)
+	}
+	match, err := s.matchmaker.FindOpponent(s.db, attacker, excluded)
+	if err != nil {
+		return nil, fmt.Errorf("find opponent with %s strategy: %w", s.matchmaker.Name(), err)
+	}
+
+	return s.runBattle(attacker, match.Defender, models.Battle{
+		MatchStrategy:     s.matchmaker.Name(),
+		CandidatePool:     match.Pool,
+		CandidatePoolSize: match.PoolSize,
+
+		Type:       trigger.Type,
+		AthEventID: trigger.AthEventID,
+	}, run)
+}
+
+// battleRun 一次战斗执行的附加选项
+type battleRun struct {
+	// job 执行该战斗的任务，锦标赛等直接执行的战斗为空
+	job *models.BattleJob
+	// attach 在写入战斗记录和战绩的同一事务中执行，用于写入关联记录（例如锦标赛对阵结果、任务完成状态），返回错误时整场战斗回滚
+	attach func(tx *gorm.DB, battle *models.Battle) error
+}
+
+// ref 本次执行在 WebSocket 消息中的标识，任务的每次尝试使用不同的 run ID
+func (r battleRun) ref(attackerID uint) BattleRunRef {
+	if r.job == nil {
+		return BattleRunRef{RunID: fmt.Sprintf("agent:%d:%d", attackerID, time.Now().UnixNano())}
+	}
+	return BattleRunRef{
+		RunID:   fmt.Sprintf("job:%d:%d", r.job.ID, r.job.Attempts),
+		JobID:   &r.job.ID,
+		Attempt: r.job.Attempts,
+	}
+}
+
+// runBattle 让裁判团判定 attacker 与 defender 的 1v1 战斗，battle 携带配对和触发信息
+func (s *BattleService) runBattle(attacker, defender models.Agent, battle models.Battle, run battleRun) (*models.Battle, error) {
+	return s.runTeamBattle([]models.Agent{attacker}, []models.Agent{defender}, battle, run)
+}
+
+// runTeamBattle 让裁判团判定两支队伍的战斗，每队第一个 Agent 为队长，记录在 AttackerID/DefenderID 中。
+// 判决结果写入后保存全部参战者和回合记录、更新战绩并广播
+func (s *BattleService) runTeamBattle(attackers, defenders []models.Agent, battle models.Battle, run battleRun) (result *models.Battle, err error) {
+	// 多回合战斗先逐回合生成交锋过程，裁判团再根据全部回合判决。已广播的回合最后以完成或中止事件收尾
+	var transcript []utils.BattleRoundResult
+	if s.Config.Battle.Rounds > 1 {
+		ref := run.ref(attackers[0].ID)
+		defer func() {
+			if err != nil {
+				s.wsHandler.BroadcastBattleRunFinished(ref, "aborted", nil, err.Error())
+			} else {
+				s.wsHandler.BroadcastBattleRunFinished(ref, "completed", &result.ID, "")
+			}
+		}()
+		rounds, results, err := s.fightRounds(ref, attackers, defenders)
+		if err != nil {
+			return nil, err
+		}
+		battle.Rounds = rounds
+		transcript = results
 	}
 
-	// Clean up battleDesc by removing content before newlines
-	if idx := strings.Index(battleDesc, "\n\n"); idx != -1 {
-		battleDesc = battleDesc[idx+2:]
-	} else if idx := strings.Index(battleDesc, "\n"); idx != -1 {
-		battleDesc = battleDesc[idx+1:]
+	// Get a structured verdict from ChatGPT
+	verdict, err := s.judgeBattle(attackers, defenders, transcript)
+	if err != nil {
+		return nil, fmt.Errorf("generate battle outcome: %w", err)
 	}
 
 	// Create battle result
-	battle := models.Battle{
-		AttackerID:  attacker.ID,
-		Attacker:    attacker,
-		DefenderID:  defender.ID,
-		Defender:    defender,
-		CreatedAt:   time.Now(),
-		Outcome:     outcome,
-		Description: battleDesc,
-	}
-
-	if err := s.db.Create(&battle).Error; err != nil {
-		logger.Logger.Error("Failed to create battle", zap.Error(err))
-		return
+	battle.AttackerID = attackers[0].ID
+	battle.Attacker = attackers[0]
+	battle.DefenderID = defenders[0].ID
+	battle.Defender = defenders[0]
+	battle.CreatedAt = time.Now()
+	battle.Outcome = verdict.Outcome
+	battle.Margin = verdict.Margin
+	battle.Description = verdict.Narrative
+	battle.Reasoning = verdict.Reasoning
+	battle.Aggregation = verdict.Aggregation
+	battle.PanelDecision = verdict.Decision
+	battle.Votes = verdict.Votes
+	battle.TeamSize = len(attackers)
+	battle.Participants = battleParticipants(attackers, defenders)
+
+	// 判决完成后按需切换赛季（裁判调用可能跨过赛季结束时间），战斗所属的赛季在提交事务中确定
+	if _, err := activeSeason(s.db, s.Config.Battle.SeasonLength); err != nil {
+		logger.Logger.Error("Failed to resolve active season", zap.Error(err))
 	}
 
-	//update agent stats
-	s.updateAgentStats(&attacker, &defender, outcome)
+	// 战斗记录和所有参战者的战绩在同一个事务中提交。战斗计入提交时所在的赛季，
+	// 赛季切换锁以共享模式持有到提交，赛季不会在写入赛季战绩的过程中被归档；没有进行中的赛季时只计入总战绩
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		season, err := lockSeason(tx, battle.CreatedAt)
+		if err != nil {
+			return err
+		}
+		if season != nil {
+			battle.SeasonID = &season.ID
+		}
+		if err := tx.Omit("Attacker", "Defender").Create(&battle).Error; err != nil {
+			return fmt.Errorf("create battle: %w", err)
+		}
+		if err := s.updateAgentStats(tx, &battle); err != nil {
+			return err
+		}
+		if run.attach != nil {
+			return run.attach(tx, &battle)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	s.matchupCache.Purge()
+	s.headToHeadCache.Purge()
 
-	if err := s.db.Preload("Attacker").Preload("Defender").First(&battle, battle.ID).Error; err != nil {
+	if err := preloadBattle(s.db).First(&battle, battle.ID).Error; err != nil {
 		logger.Logger.Error("Failed to retrieve created battle", zap.Error(err))
-		return
+		return &battle, nil
 	}
 
 	// Broadcast the new result
@@ -166,13 +382,40 @@ func (s *BattleService) triggerBattle(attacker models.Agent) {
 		zap.String("battleId", strconv.FormatUint(uint64(battle.ID), 10)),
 		zap.String("attacker", strconv.FormatUint(uint64(battle.AttackerID), 10)),
 		zap.String("defender", strconv.FormatUint(uint64(battle.DefenderID), 10)),
-		zap.String("outcome", battle.Outcome),
+		zap.Int("teamSize", battle.TeamSize),
+		zap.String("outcome", string(battle.Outcome)),
+		zap.String("type", string(battle.Type)),
 	)
+	return &battle, nil
+}
+
+// battleParticipants 按双方队伍的顺序生成参战记录
+func battleParticipants(attackers, defenders []models.Agent) []models.BattleParticipant {
+	participants := make([]models.BattleParticipant, 0, len(attackers)+len(defenders))
+	for i, agent := range attackers {
+		participants = append(participants, models.BattleParticipant{AgentID: agent.ID, Side: models.SideAttacker, Slot: i})
+	}
+	for i, agent := range defenders {
+		participants = append(participants, models.BattleParticipant{AgentID: agent.ID, Side: models.SideDefender, Slot: i})
+	}
+	return participants
+}
+
+// preloadBattle 加载战斗的双方队长、全部参战者、裁判投票和回合记录
+func preloadBattle(db *gorm.DB) *gorm.DB {
+	return db.Preload("Attacker").Preload("Defender").Preload("Votes").
+		Preload("Participants", func(db *gorm.DB) *gorm.DB {
+			return db.Order("side ASC, slot ASC")
+		}).
+		Preload("Participants.Agent").
+		Preload("Rounds", func(db *gorm.DB) *gorm.DB {
+			return db.Order("round ASC")
+		})
 }
 
 func (s *BattleService) GetBattle(c *gin.Context) {
 	var battle models.Battle
-	if err := s.db.Preload("Attacker").Preload("Defender").First(&battle, c.Query("id")).Error; err != nil {
+	if err := preloadBattle(s.db).First(&battle, c.Query("id")).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Battle not found"})
 		return
 	}
@@ -193,55 +436,209 @@ func (s *BattleService) GetBattles(c *gin.Context) {
 		return
 	}
 
-	// get all battles related to this agent
+	page, apiErr := parseBattlePage(c)
+	if apiErr != nil {
+		c.Error(apiErr)
+		return
+	}
+
+	// get battles related to this agent one page at a time, including team battles it fought in
+	query := preloadBattle(s.db).
+		Where("id IN (?)", s.db.Model(&models.BattleParticipant{}).Select("battle_id").Where("agent_id = ?", agentID))
+	record := models.SeasonRecord{
+		Total:   agent.Total,
+		Wins:    agent.Wins,
+		Losses:  agent.Losses,
+		Draws:   agent.Draws,
+		WinRate: agent.WinRate,
+		Rating:  agent.Rating,
+	}
+
+	// 指定赛季时只返回该赛季的战斗和赛季战绩
+	var seasonID *uint
+	if param := c.Query("season"); param != "" {
+		season, err := resolveSeason(s.db, s.Config.Battle.SeasonLength, param)
+		if err != nil {
+			if apiErr, ok := err.(*errors.APIError); ok {
+				c.Error(apiErr)
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve season"})
+			return
+		}
+		query = query.Where("season_id = ?", season.ID)
+		seasonID = &season.ID
+
+		var stats models.AgentSeasonStats
+		result := s.db.Where("season_id = ? AND agent_id = ?", season.ID, agentID).Limit(1).Find(&stats)
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch season stats"})
+			return
+		}
+		record = models.SeasonRecord{Rating: utils.DefaultRating}
+		if result.RowsAffected > 0 {
+			record = stats.SeasonRecord
+		}
+	}
+
 	var battles []models.Battle
-	if err := s.db.Preload("Attacker").Preload("Defender").
-		Where("attacker_id = ? OR defender_id = ?", agentID, agentID).
-		Order("created_at desc").
-		Find(&battles).Error; err != nil {
+	if err := page.apply(query).Find(&battles).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch battles"})
 		return
 	}
+	battles, next := page.trim(battles)
+
+	byType, err := s.battleStatsByType(uint(agentID), seasonID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch battle stats"})
+		return
+	}
 
 	// return battle records and stats
 	c.JSON(http.StatusOK, gin.H{
-		"battles":  battles,
-		"total":    agent.Total,
-		"wins":     agent.Wins,
-		"losses":   agent.Losses,
-		"win_rate": agent.WinRate,
+		"battles":     battles,
+		"next_cursor": next,
+		"total":       record.Total,
+		"wins":        record.Wins,
+		"losses":      record.Losses,
+		"draws":       record.Draws,
+		"win_rate":    record.WinRate,
+		"by_type":     byType,
 	})
 }
 
-func (s *BattleService) updateAgentStats(attacker *models.Agent, defender *models.Agent, outcome string) {
-	// update total battles
-	attacker.Total++
-	defender.Total++
+// BattleTypeStats Agent 在某一类战斗中的战绩
+type BattleTypeStats struct {
+	Type   models.BattleType `json:"type"`
+	Total  int               `json:"total"`
+	Wins   int               `json:"wins"`
+	Losses int               `json:"losses"`
+	Draws  int               `json:"draws"`
+}
+
+// battleStatsByType 按战斗类型统计 Agent 的战绩，用于区分价格触发和挑战等来源
+func (s *BattleService) battleStatsByType(agentID uint, seasonID *uint) ([]BattleTypeStats, error) {
+	victories := []models.BattleOutcome{models.OutcomeTotalVictory, models.OutcomeNarrowVictory}
+	defeats := []models.BattleOutcome{models.OutcomeNarrowDefeat, models.OutcomeCrushingDefeat}
+
+	query := s.db.Model(&models.Battle{}).
+		Select(`battles.type, COUNT(*) AS total,
+			SUM(CASE WHEN (p.side = ? AND outcome IN ?) OR (p.side = ? AND outcome IN ?) THEN 1 ELSE 0 END) AS wins,
+			SUM(CASE WHEN (p.side = ? AND outcome IN ?) OR (p.side = ? AND outcome IN ?) THEN 1 ELSE 0 END) AS losses,
+			SUM(CASE WHEN outcome = ? THEN 1 ELSE 0 END) AS draws`,
+			models.SideAttacker, victories, models.SideDefender, defeats,
+			models.SideAttacker, defeats, models.SideDefender, victories,
+			models.OutcomeDraw).
+		Joins("JOIN battle_participants p ON p.battle_id = battles.id").
+		Where("p.agent_id = ?", agentID)
+	if seasonID != nil {
+		query = query.Where("battles.season_id = ?", *seasonID)
+	}
+
+	stats := []BattleTypeStats{}
+	err := query.Group("battles.type").Order("battles.type").Scan(&stats).Error
+	return stats, err
+}
+
+// updateAgentStats 在 tx 中把战斗结果计入每个参战者的战绩。参战者按 ID 顺序加行锁后读取最新分数，
+// 战绩列按增量更新，团队战中每名成员按对方队伍的平均分数计算 Elo 变化
+func (s *BattleService) updateAgentStats(tx *gorm.DB, battle *models.Battle) error {
+	outcome := battle.Outcome
+
+	ids := make([]uint, len(battle.Participants))
+	for i, participant := range battle.Participants {
+		ids[i] = participant.AgentID
+	}
+	var locked []models.Agent
+	if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id", "rating").
+		Where("id IN ?", ids).
+		Order("id ASC").
+		Find(&locked).Error; err != nil {
+		return fmt.Errorf("lock agents: %w", err)
+	}
+	ratings := make(map[uint]float64, len(locked))
+	for _, agent := range locked {
+		ratings[agent.ID] = agent.Rating
+	}
+
+	var attackers, defenders []models.Agent
+	for _, participant := range battle.Participants {
+		agent := models.Agent{ID: participant.AgentID, Rating: ratings[participant.AgentID]}
+		if participant.Side == models.SideAttacker {
+			attackers = append(attackers, agent)
+		} else {
+			defenders = append(defenders, agent)
+		}
+	}
 
-	switch outcome {
-	case "TOTAL_VICTORY", "NARROW_VICTORY":
-		// attacker wins
-		attacker.Wins++
-		defender.Losses++
-	case "CRUSHING_DEFEAT", "NARROW_DEFEAT":
-		// defender wins
-		attacker.Losses++
-		defender.Wins++
+	var attackerScore float64
+	switch {
+	case outcome.AttackerWon():
+		attackerScore = 1
+	case outcome.DefenderWon():
+	default:
+		// draw
+		attackerScore = 0.5
 	}
 
-	// calculate win rate
-	if attacker.Total > 0 {
-		attacker.WinRate = float64(attacker.Wins) / float64(attacker.Total) * 100
+	attackerAvg, defenderAvg := averageRating(attackers), averageRating(defenders)
+	history := make([]models.RatingHistory, 0, len(battle.Participants))
+	for _, side := range []struct {
+		members     []models.Agent
+		score       float64
+		opponentAvg float64
+	}{
+		{attackers, attackerScore, defenderAvg},
+		{defenders, 1 - attackerScore, attackerAvg},
+	} {
+		win, loss, draw := resultIncrements(side.score)
+		for _, agent := range side.members {
+			// update elo rating, total victories and crushing defeats move ratings further
+			oldRating := agent.Rating
+			newRating := oldRating + utils.EloDelta(oldRating, side.opponentAvg, side.score, outcome.Decisive())
+
+			// update totals and win rate in place so concurrent price updates are not overwritten
+			if err := tx.Model(&models.Agent{}).Where("id = ?", agent.ID).Updates(map[string]interface{}{
+				"total":    gorm.Expr("total + 1"),
+				"wins":     gorm.Expr("wins + ?", win),
+				"losses":   gorm.Expr("losses + ?", loss),
+				"draws":    gorm.Expr("draws + ?", draw),
+				"win_rate": gorm.Expr("(wins + ?) * 100.0 / (total + 1)", win),
+				"rating":   newRating,
+			}).Error; err != nil {
+				return fmt.Errorf("update stats of agent %d: %w", agent.ID, err)
+			}
+			history = append(history, models.RatingHistory{
+				AgentID: agent.ID, BattleID: battle.ID, OldRating: oldRating, NewRating: newRating, Delta: newRating - oldRating,
+			})
+		}
 	}
-	if defender.Total > 0 {
-		defender.WinRate = float64(defender.Wins) / float64(defender.Total) * 100
+
+	if err := tx.Create(&history).Error; err != nil {
+		return fmt.Errorf("record rating history: %w", err)
 	}
 
-	// save updated agent
-	if err := s.db.Save(attacker).Error; err != nil {
-		logger.Logger.Error("Failed to update attacker stats", zap.Error(err))
+	return s.updateSeasonStats(tx, battle, attackerScore)
+}
+
+// resultIncrements 把得分换算为胜、负、平三列的增量
+func resultIncrements(score float64) (win, loss, draw int) {
+	switch score {
+	case 1:
+		return 1, 0, 0
+	case 0:
+		return 0, 1, 0
+	default:
+		return 0, 0, 1
 	}
-	if err := s.db.Save(defender).Error; err != nil {
-		logger.Logger.Error("Failed to update defender stats", zap.Error(err))
+}
+
+// averageRating 一支队伍的平均 Elo 分数，1v1 即该 Agent 的分数
+func averageRating(team []models.Agent) float64 {
+	var sum float64
+	for _, agent := range team {
+		sum += agent.Rating
 	}
+	return sum / float64(len(team))
 }
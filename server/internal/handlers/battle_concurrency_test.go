@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/config"
+	"github.com/GabbyWorld/all-time-high-backend/internal/logger"
+	"github.com/GabbyWorld/all-time-high-backend/internal/models"
+	"github.com/GabbyWorld/all-time-high-backend/internal/repository"
+	"go.uber.org/zap"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// 并发测试的规模：每个 Agent 依次写入 pricesPerAgent 个价格，同时执行 concurrentBattles 场战斗
+const (
+	concurrentAgents  = 4
+	concurrentBattles = 40
+	pricesPerAgent    = 25
+)
+
+// openTestDB 连接 TEST_DATABASE_URL 指定的 Postgres 并迁移模型，未设置时跳过测试
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	if logger.Logger == nil {
+		logger.Logger = zap.NewNop()
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: gormlogger.Default.LogMode(gormlogger.Silent)})
+	if err != nil {
+		t.Fatalf("connect test database: %v", err)
+	}
+	if err := repository.Migrate(db); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+	return db
+}
+
+// newJudgeStub 模拟 chat completions 接口，按请求顺序轮流返回各种判决结果
+func newJudgeStub(t *testing.T) *httptest.Server {
+	t.Helper()
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		outcome := models.JudgeOutcomes[int(calls.Add(1))%len(models.JudgeOutcomes)]
+		margin := 20
+		if outcome.Decisive() {
+			margin = 60
+		}
+		verdict, _ := json.Marshal(map[string]interface{}{
+			"outcome":   outcome,
+			"margin":    margin,
+			"narrative": "A close fight.",
+			"reasoning": "Stub verdict.",
+		})
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"role": "assistant", "content": string(verdict)}},
+			},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// createTestAgents 创建测试用户和 Agent，测试结束后删除它们以及相关的战斗记录
+func createTestAgents(t *testing.T, db *gorm.DB, n int) []models.Agent {
+	t.Helper()
+	suffix := time.Now().UnixNano()
+	user := models.User{WalletAddress: fmt.Sprintf("test-wallet-%d", suffix)}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	agents := make([]models.Agent, n)
+	ids := make([]uint, n)
+	for i := range agents {
+		agents[i] = models.Agent{
+			Name:      fmt.Sprintf("agent-%d-%d", suffix, i),
+			Ticker:    fmt.Sprintf("T%d", i),
+			Prompt:    "test",
+			UserID:    user.ID,
+			Rating:    1500,
+			MarketCap: 1000,
+		}
+		if err := db.Create(&agents[i]).Error; err != nil {
+			t.Fatalf("create agent: %v", err)
+		}
+		ids[i] = agents[i].ID
+	}
+
+	t.Cleanup(func() {
+		battles := db.Model(&models.BattleParticipant{}).Select("battle_id").Where("agent_id IN ?", ids)
+		for _, model := range []interface{}{&models.JudgeVote{}, &models.BattleRound{}, &models.BattleParticipant{}} {
+			db.Where("battle_id IN (?)", battles).Delete(model)
+		}
+		db.Where("attacker_id IN ? OR defender_id IN ?", ids, ids).Delete(&models.Battle{})
+		for _, model := range []interface{}{&models.RatingHistory{}, &models.AgentSeasonStats{}, &models.AthEvent{}, &models.BattleJob{}, &models.BattleSkip{}} {
+			db.Where("agent_id IN ?", ids).Delete(model)
+		}
+		db.Unscoped().Where("id IN ?", ids).Delete(&models.Agent{})
+		db.Unscoped().Delete(&user)
+	})
+	return agents
+}
+
+// TestConcurrentBattlesAndPriceUpdates 并发执行战斗结算和价格更新，战绩不能丢失，价格列也不能被战斗结算覆盖
+func TestConcurrentBattlesAndPriceUpdates(t *testing.T) {
+	db := openTestDB(t)
+	judge := newJudgeStub(t)
+	cfg := &config.Config{
+		OpenAI: config.OpenAIConfig{APIKey: "test", CompletionsEndpoint: judge.URL},
+		Battle: config.BattleConfig{
+			MatchmakingStrategy: "random",
+			// 价格更新不触发新的战斗任务
+			TriggerPolicy:       "threshold",
+			TriggerThresholdPct: 1e9,
+			JudgePanel:          []config.JudgeSpec{{Model: "test"}},
+			JudgeAggregation:    "majority",
+			SeasonLength:        24 * time.Hour,
+			Rounds:              1,
+		},
+	}
+	s := NewBattleService(db, NewBattleWebSocketHandler(db), nil, cfg)
+	agents := createTestAgents(t, db, concurrentAgents)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, concurrentBattles)
+	for i := 0; i < concurrentBattles; i++ {
+		// 对手在其余 Agent 中轮换，每个 Agent 同时以攻击者和防御者身份参战
+		n := len(agents)
+		attacker, defender := agents[i%n], agents[(i+1+(i/n)%(n-1))%n]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.runBattle(attacker, defender, models.Battle{Type: models.BattleTypeChallenge}, battleRun{}); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	// 每个 Agent 的价格按顺序递增写入，与战斗结算交错执行
+	for _, agent := range agents {
+		wg.Add(1)
+		go func(agent models.Agent) {
+			defer wg.Done()
+			for p := 1; p <= pricesPerAgent; p++ {
+				s.handlePriceUpdate(agent, float64(p))
+			}
+		}(agent)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("run battle: %v", err)
+	}
+
+	ids := make([]uint, len(agents))
+	for i, agent := range agents {
+		ids[i] = agent.ID
+	}
+	var stored []models.Agent
+	if err := db.Where("id IN ?", ids).Order("id ASC").Find(&stored).Error; err != nil {
+		t.Fatalf("load agents: %v", err)
+	}
+
+	var battles []models.Battle
+	if err := db.Where("attacker_id IN ?", ids).Find(&battles).Error; err != nil {
+		t.Fatalf("load battles: %v", err)
+	}
+	if len(battles) != concurrentBattles {
+		t.Fatalf("battles = %d, want %d", len(battles), concurrentBattles)
+	}
+	// 按判决结果推算每个 Agent 应有的胜负平
+	want := make(map[uint]*models.SeasonRecord, len(agents))
+	for _, agent := range agents {
+		want[agent.ID] = &models.SeasonRecord{}
+	}
+	for _, battle := range battles {
+		var attackerScore float64
+		switch {
+		case battle.Outcome.AttackerWon():
+			attackerScore = 1
+		case battle.Outcome.DefenderWon():
+		default:
+			attackerScore = 0.5
+		}
+		want[battle.AttackerID].Record(attackerScore)
+		want[battle.DefenderID].Record(1 - attackerScore)
+	}
+
+	total := 0
+	for _, agent := range stored {
+		var fought int64
+		if err := db.Model(&models.BattleParticipant{}).Where("agent_id = ?", agent.ID).Count(&fought).Error; err != nil {
+			t.Fatalf("count participations: %v", err)
+		}
+		if agent.Total != int(fought) {
+			t.Errorf("agent %d total = %d, want %d battles", agent.ID, agent.Total, fought)
+		}
+		if agent.Wins+agent.Losses+agent.Draws != agent.Total {
+			t.Errorf("agent %d wins+losses+draws = %d, want total %d", agent.ID, agent.Wins+agent.Losses+agent.Draws, agent.Total)
+		}
+		if w := want[agent.ID]; agent.Total != w.Total || agent.Wins != w.Wins || agent.Losses != w.Losses || agent.Draws != w.Draws {
+			t.Errorf("agent %d record = %d/%d/%d of %d, want %d/%d/%d of %d",
+				agent.ID, agent.Wins, agent.Losses, agent.Draws, agent.Total, w.Wins, w.Losses, w.Draws, w.Total)
+		}
+		var history int64
+		if err := db.Model(&models.RatingHistory{}).Where("agent_id = ?", agent.ID).Count(&history).Error; err != nil {
+			t.Fatalf("count rating history: %v", err)
+		}
+		if history != fought {
+			t.Errorf("agent %d rating history = %d rows, want %d", agent.ID, history, fought)
+		}
+		if agent.PreviousPrice != pricesPerAgent || agent.HighestPrice != pricesPerAgent {
+			t.Errorf("agent %d prices = (previous %v, highest %v), want %d", agent.ID, agent.PreviousPrice, agent.HighestPrice, pricesPerAgent)
+		}
+		if agent.MarketCap != 1000 {
+			t.Errorf("agent %d market cap = %v, want 1000", agent.ID, agent.MarketCap)
+		}
+		total += agent.Total
+	}
+	if total != 2*concurrentBattles {
+		t.Errorf("sum of totals = %d, want %d", total, 2*concurrentBattles)
+	}
+}
@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/errors"
+	"github.com/GabbyWorld/all-time-high-backend/internal/logger"
+	"github.com/GabbyWorld/all-time-high-backend/internal/models"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 战斗列表每页的默认和最大条数
+const (
+	defaultBattlePageSize = 20
+	maxBattlePageSize     = 100
+)
+
+// battleCursor 战斗列表的游标，按 (created_at, id) 倒序翻页
+type battleCursor struct {
+	CreatedAt time.Time
+	ID        uint
+}
+
+func (c battleCursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", c.CreatedAt.UnixNano(), c.ID)))
+}
+
+func decodeBattleCursor(s string) (*battleCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	battleID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &battleCursor{CreatedAt: time.Unix(0, n), ID: uint(battleID)}, nil
+}
+
+// battlePage 解析 cursor 和 limit 参数
+type battlePage struct {
+	Cursor *battleCursor
+	Limit  int
+}
+
+func parseBattlePage(c *gin.Context) (battlePage, *errors.APIError) {
+	page := battlePage{Limit: defaultBattlePageSize}
+	if param := c.Query("limit"); param != "" {
+		limit, err := strconv.Atoi(param)
+		if err != nil || limit < 1 {
+			return page, errors.NewAPIError(errors.ErrValidation, "Invalid limit", param)
+		}
+		page.Limit = min(limit, maxBattlePageSize)
+	}
+	if param := c.Query("cursor"); param != "" {
+		cursor, err := decodeBattleCursor(param)
+		if err != nil {
+			return page, errors.NewAPIError(errors.ErrValidation, "Invalid cursor", err.Error())
+		}
+		page.Cursor = cursor
+	}
+	return page, nil
+}
+
+// apply 在查询上加上游标条件和排序，多取一条用于判断是否还有下一页
+func (p battlePage) apply(query *gorm.DB) *gorm.DB {
+	if p.Cursor != nil {
+		query = query.Where("(battles.created_at, battles.id) < (?, ?)", p.Cursor.CreatedAt, p.Cursor.ID)
+	}
+	return query.Order("battles.created_at DESC, battles.id DESC").Limit(p.Limit + 1)
+}
+
+// trim 去掉多取的一条并返回下一页的游标，没有下一页时为空
+func (p battlePage) trim(battles []models.Battle) ([]models.Battle, string) {
+	if len(battles) <= p.Limit {
+		return battles, ""
+	}
+	battles = battles[:p.Limit]
+	last := battles[len(battles)-1]
+	return battles, battleCursor{CreatedAt: last.CreatedAt, ID: last.ID}.encode()
+}
+
+// AgentSummary 战斗列表中展示的 Agent 概要，不包含 prompt
+type AgentSummary struct {
+	ID                uint    `json:"id"`
+	Name              string  `json:"name"`
+	Ticker            string  `json:"ticker"`
+	ImageURL          string  `json:"image_url"`
+	UserWalletAddress string  `json:"user_wallet_address"`
+	Rating            float64 `json:"rating"`
+}
+
+// ParticipantSummary 战斗的一名参战者
+type ParticipantSummary struct {
+	Agent AgentSummary `json:"agent"`
+	Side  string       `json:"side"`
+	Slot  int          `json:"slot"`
+}
+
+// BattleSummary 战斗动态中的一场战斗
+type BattleSummary struct {
+	ID           uint                 `json:"id"`
+	Type         models.BattleType    `json:"type"`
+	Outcome      models.BattleOutcome `json:"outcome"`
+	Margin       int                  `json:"margin"`
+	Description  string               `json:"description"`
+	TeamSize     int                  `json:"team_size"`
+	SeasonID     *uint                `json:"season_id,omitempty"`
+	TournamentID *uint                `json:"tournament_id,omitempty"`
+	Attacker     AgentSummary         `json:"attacker"`
+	Defender     AgentSummary         `json:"defender"`
+	Participants []ParticipantSummary `json:"participants"`
+	CreatedAt    time.Time            `json:"created_at"`
+}
+
+// BattleFeedResponse 战斗动态
+type BattleFeedResponse struct {
+	Battles    []BattleSummary `json:"battles"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// GetBattleFeed godoc
+// @Summary 获取全局战斗动态
+// @Description 按时间倒序返回所有战斗的概要，使用 next_cursor 翻页。agent_id 和 wallet 匹配任意一名参战者
+// @Tags Battle
+// @Produce json
+// @Param outcome query string false "结果，多个用逗号分隔: TOTAL_VICTORY, NARROW_VICTORY, NARROW_DEFEAT, CRUSHING_DEFEAT, DRAW"
+// @Param type query string false "战斗类型，多个用逗号分隔: PRICE_INCREASE, ATH_BREAKOUT, TOURNAMENT, CHALLENGE, TEAM, GRADUATION"
+// @Param agent_id query int false "参战 Agent ID"
+// @Param wallet query string false "参战 Agent 所有者的钱包地址"
+// @Param from query string false "起始时间 (RFC3339)"
+// @Param to query string false "结束时间 (RFC3339)"
+// @Param cursor query string false "上一页返回的 next_cursor"
+// @Param limit query int false "每页条数(默认为20，最大100)"
+// @Success 200 {object} BattleFeedResponse "成功返回战斗动态"
+// @Failure 400 {object} errors.APIError "请求参数错误"
+// @Failure 500 {object} errors.APIError "服务器错误"
+// @Router /api/battles/feed [get]
+func (s *BattleService) GetBattleFeed(c *gin.Context) {
+	page, apiErr := parseBattlePage(c)
+	if apiErr != nil {
+		c.Error(apiErr)
+		return
+	}
+
+	query := s.db.Model(&models.Battle{}).Preload("Participants", func(db *gorm.DB) *gorm.DB {
+		return db.Order("side ASC, slot ASC")
+	})
+	if param := c.Query("outcome"); param != "" {
+		outcomes := strings.Split(param, ",")
+		for _, outcome := range outcomes {
+			if !models.BattleOutcome(outcome).Valid() {
+				c.Error(errors.NewAPIError(errors.ErrValidation, "Invalid outcome", outcome))
+				return
+			}
+		}
+		query = query.Where("battles.outcome IN ?", outcomes)
+	}
+	if param := c.Query("type"); param != "" {
+		types := strings.Split(param, ",")
+		for _, battleType := range types {
+			if !models.BattleType(battleType).Valid() {
+				c.Error(errors.NewAPIError(errors.ErrValidation, "Invalid type", battleType))
+				return
+			}
+		}
+		query = query.Where("battles.type IN ?", types)
+	}
+	if param := c.Query("agent_id"); param != "" {
+		agentID, err := strconv.ParseUint(param, 10, 64)
+		if err != nil {
+			c.Error(errors.NewAPIError(errors.ErrValidation, "Invalid agent_id", err.Error()))
+			return
+		}
+		query = query.Where("battles.id IN (?)", s.db.Model(&models.BattleParticipant{}).Select("battle_id").Where("agent_id = ?", agentID))
+	}
+	if wallet := c.Query("wallet"); wallet != "" {
+		query = query.Where("battles.id IN (?)", s.db.Table("battle_participants p").
+			Select("p.battle_id").
+			Joins("JOIN agents a ON a.id = p.agent_id").
+			Where("a.user_wallet_address = ?", wallet))
+	}
+	for _, bound := range []struct {
+		param string
+		cond  string
+	}{{"from", "battles.created_at >= ?"}, {"to", "battles.created_at <= ?"}} {
+		if param := c.Query(bound.param); param != "" {
+			t, err := time.Parse(time.RFC3339, param)
+			if err != nil {
+				c.Error(errors.NewAPIError(errors.ErrValidation, "Invalid "+bound.param+" time", err.Error()))
+				return
+			}
+			query = query.Where(bound.cond, t)
+		}
+	}
+
+	var battles []models.Battle
+	if err := page.apply(query).Find(&battles).Error; err != nil {
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to retrieve battles", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("GetBattleFeed: failed to retrieve battles", zap.Error(err))
+		return
+	}
+	battles, next := page.trim(battles)
+
+	summaries, err := s.summarizeBattles(battles)
+	if err != nil {
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to retrieve agents", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("GetBattleFeed: failed to retrieve agents", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, BattleFeedResponse{Battles: summaries, NextCursor: next})
+}
+
+// summarizeBattles 用一次查询加载所有参战者的概要，已删除的 Agent 也会展示
+func (s *BattleService) summarizeBattles(battles []models.Battle) ([]BattleSummary, error) {
+	var ids []uint
+	for _, battle := range battles {
+		ids = append(ids, battle.AttackerID, battle.DefenderID)
+		for _, participant := range battle.Participants {
+			ids = append(ids, participant.AgentID)
+		}
+	}
+
+	var agents []AgentSummary
+	if len(ids) > 0 {
+		if err := s.db.Unscoped().Model(&models.Agent{}).
+			Select("id", "name", "ticker", "image_url", "user_wallet_address", "rating").
+			Where("id IN ?", ids).
+			Scan(&agents).Error; err != nil {
+			return nil, err
+		}
+	}
+	byID := make(map[uint]AgentSummary, len(agents))
+	for _, agent := range agents {
+		byID[agent.ID] = agent
+	}
+
+	summaries := make([]BattleSummary, len(battles))
+	for i, battle := range battles {
+		participants := make([]ParticipantSummary, len(battle.Participants))
+		for j, participant := range battle.Participants {
+			participants[j] = ParticipantSummary{Agent: byID[participant.AgentID], Side: participant.Side, Slot: participant.Slot}
+		}
+		summaries[i] = BattleSummary{
+			ID:           battle.ID,
+			Type:         battle.Type,
+			Outcome:      battle.Outcome,
+			Margin:       battle.Margin,
+			Description:  battle.Description,
+			TeamSize:     battle.TeamSize,
+			SeasonID:     battle.SeasonID,
+			TournamentID: battle.TournamentID,
+			Attacker:     byID[battle.AttackerID],
+			Defender:     byID[battle.DefenderID],
+			Participants: participants,
+			CreatedAt:    battle.CreatedAt,
+		}
+	}
+	return summaries, nil
+}
@@ -0,0 +1,402 @@
+package handlers
+
+import (
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/errors"
+	"github.com/GabbyWorld/all-time-high-backend/internal/logger"
+	"github.com/GabbyWorld/all-time-high-backend/internal/models"
+	"github.com/GabbyWorld/all-time-high-backend/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxJobBackoff 重试等待时间的上限
+const maxJobBackoff = time.Hour
+
+// enqueueBattle 在 tx 中为攻击者写入一条待执行的战斗任务
+func (s *BattleService) enqueueBattle(tx *gorm.DB, attacker models.Agent, trigger battleTrigger) error {
+	job := models.BattleJob{
+		AttackerID:  attacker.ID,
+		Type:        trigger.Type,
+		AthEventID:  trigger.AthEventID,
+		DefenderID:  trigger.DefenderID,
+		Status:      models.BattleJobPending,
+		MaxAttempts: s.Config.Battle.JobMaxAttempts,
+		NextRunAt:   time.Now(),
+	}
+	return tx.Create(&job).Error
+}
+
+// StartBattleWorkers 启动固定数量的 worker 执行战斗任务，worker 数量即并发上限
+func (s *BattleService) StartBattleWorkers() {
+	workers := s.Config.Battle.JobWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go s.runBattleWorker(i)
+	}
+
+	// 定期回收中断的任务（例如进程在执行过程中退出）
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.requeueStaleJobs()
+		}
+	}()
+}
+
+func (s *BattleService) runBattleWorker(worker int) {
+	ticker := time.NewTicker(s.Config.Battle.JobPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		// 一次轮询内持续领取，直到队列为空
+		for {
+			job, err := s.claimBattleJob()
+			if err != nil {
+				logger.Logger.Error("Failed to claim battle job", zap.Int("worker", worker), zap.Error(err))
+				break
+			}
+			if job == nil {
+				break
+			}
+			s.runBattleJob(job)
+		}
+	}
+}
+
+// claimBattleJob 领取一条到期的 pending 任务并标记为 running，没有任务时返回 nil
+func (s *BattleService) claimBattleJob() (*models.BattleJob, error) {
+	var job models.BattleJob
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_run_at <= ?", models.BattleJobPending, time.Now()).
+			Order("next_run_at ASC, id ASC").
+			Limit(1).
+			Find(&job)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		now := time.Now()
+		job.Status = models.BattleJobRunning
+		job.Attempts++
+		job.StartedAt = &now
+		return tx.Model(&job).Updates(map[string]interface{}{
+			"status":     job.Status,
+			"attempts":   job.Attempts,
+			"started_at": job.StartedAt,
+		}).Error
+	})
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// errJobLeaseLost 任务的租约已过期并被重新放回队列（或已由其他 worker 领取），本次执行的结果作废
+var errJobLeaseLost = stderrors.New("battle job lease lost")
+
+// runBattleJob 执行任务并根据结果更新状态。成功的任务在写入战斗的事务中标记完成，
+// 其余状态更新只在任务仍处于本次领取的 running 状态时生效，租约过期后的结果不会覆盖新的执行
+func (s *BattleService) runBattleJob(job *models.BattleJob) {
+	_, err := s.executeBattleJob(job)
+	now := time.Now()
+
+	if err == nil {
+		return
+	}
+	if stderrors.Is(err, errJobLeaseLost) {
+		logger.Logger.Warn("Battle job lease lost, discarding result", zap.Uint("jobId", job.ID), zap.Int("attempts", job.Attempts))
+		return
+	}
+
+	// 被公平性规则跳过的任务直接取消，重试也不会改变结果
+	if skip, ok := asBattleSkip(err); ok {
+		if dbErr := claimedJobUpdate(s.db, job, map[string]interface{}{
+			"status":      models.BattleJobCancelled,
+			"finished_at": now,
+			"last_error":  skip.Error(),
+		}); dbErr != nil {
+			logger.Logger.Error("Failed to cancel skipped battle job", zap.Uint("jobId", job.ID), zap.Error(dbErr))
+		}
+		logger.Logger.Info("Battle job skipped", zap.Uint("jobId", job.ID), zap.String("rule", skip.Rule), zap.String("detail", skip.Detail))
+		return
+	}
+
+	updates := map[string]interface{}{"last_error": err.Error()}
+	if job.Attempts >= job.MaxAttempts {
+		updates["status"] = models.BattleJobFailed
+		updates["finished_at"] = now
+		logger.Logger.Error("Battle job failed permanently",
+			zap.Uint("jobId", job.ID),
+			zap.Int("attempts", job.Attempts),
+			zap.Error(err))
+	} else {
+		backoff := jobBackoff(s.Config.Battle.JobBackoff, job.Attempts)
+		updates["status"] = models.BattleJobPending
+		updates["next_run_at"] = now.Add(backoff)
+		logger.Logger.Warn("Battle job failed, will retry",
+			zap.Uint("jobId", job.ID),
+			zap.Int("attempts", job.Attempts),
+			zap.Duration("backoff", backoff),
+			zap.Error(err))
+	}
+	if dbErr := claimedJobUpdate(s.db, job, updates); dbErr != nil {
+		logger.Logger.Error("Failed to update battle job", zap.Uint("jobId", job.ID), zap.Error(dbErr))
+	}
+}
+
+// claimedJobUpdate 更新本次领取的任务，任务已不处于本次领取的 running 状态时返回 errJobLeaseLost
+func claimedJobUpdate(db *gorm.DB, job *models.BattleJob, updates map[string]interface{}) error {
+	result := db.Model(&models.BattleJob{}).
+		Where("id = ? AND status = ? AND attempts = ?", job.ID, models.BattleJobRunning, job.Attempts).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errJobLeaseLost
+	}
+	return nil
+}
+
+// completeJob 返回在战斗事务中把任务标记为成功的 attach，租约已丢失时整场战斗回滚，避免重复记录
+func completeJob(job *models.BattleJob) func(tx *gorm.DB, battle *models.Battle) error {
+	return func(tx *gorm.DB, battle *models.Battle) error {
+		return claimedJobUpdate(tx, job, map[string]interface{}{
+			"status":      models.BattleJobSucceeded,
+			"battle_id":   battle.ID,
+			"finished_at": time.Now(),
+			"last_error":  "",
+		})
+	}
+}
+
+func (s *BattleService) executeBattleJob(job *models.BattleJob) (*models.Battle, error) {
+	if len(job.AttackerIDs) > 0 {
+		return s.executeTeamBattleJob(job)
+	}
+
+	var attacker models.Agent
+	if err := s.db.First(&attacker, job.AttackerID).Error; err != nil {
+		return nil, fmt.Errorf("load attacker: %w", err)
+	}
+	return s.triggerBattle(attacker, battleTrigger{Type: job.Type, AthEventID: job.AthEventID, DefenderID: job.DefenderID}, battleRun{job: job, attach: completeJob(job)})
+}
+
+// jobBackoff 计算第 attempts 次失败后的等待时间：base * 2^(attempts-1)，不超过 maxJobBackoff
+func jobBackoff(base time.Duration, attempts int) time.Duration {
+	backoff := base
+	for i := 1; i < attempts && backoff < maxJobBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxJobBackoff {
+		backoff = maxJobBackoff
+	}
+	return backoff
+}
+
+// jobLease 任务租约：BATTLE_JOB_LEASE_TIMEOUT 与一场战斗最坏耗时中较大者。
+// 最坏耗时按每个回合和每个裁判都用满重试次数、每次请求都等到超时估算
+func (s *BattleService) jobLease() time.Duration {
+	cfg := s.Config.Battle
+	calls := (cfg.Rounds + len(cfg.JudgePanel)) * maxVerdictAttempts
+	worst := time.Duration(calls)*utils.CompletionTimeout + time.Minute
+	return max(cfg.JobLeaseTimeout, worst)
+}
+
+// requeueStaleJobs 把超过租约时间仍处于 running 的任务放回队列
+func (s *BattleService) requeueStaleJobs() {
+	result := s.db.Model(&models.BattleJob{}).
+		Where("status = ? AND started_at < ?", models.BattleJobRunning, time.Now().Add(-s.jobLease())).
+		Updates(map[string]interface{}{
+			"status":      models.BattleJobPending,
+			"next_run_at": time.Now(),
+			"last_error":  "lease expired",
+		})
+	if result.Error != nil {
+		logger.Logger.Error("Failed to requeue stale battle jobs", zap.Error(result.Error))
+		return
+	}
+	if result.RowsAffected > 0 {
+		logger.Logger.Warn("Requeued stale battle jobs", zap.Int64("count", result.RowsAffected))
+	}
+}
+
+// BattleJobsResponse 战斗任务列表
+type BattleJobsResponse struct {
+	Jobs     []models.BattleJob `json:"jobs"`
+	Total    int64              `json:"total"`
+	Page     int                `json:"page"`
+	PageSize int                `json:"page_size"`
+}
+
+// ListBattleJobs godoc
+// @Summary 获取战斗任务列表
+// @Description 管理员按状态查看战斗任务（分页）
+// @Tags Admin
+// @Produce json
+// @Param status query string false "任务状态: pending, running, succeeded, failed, cancelled"
+// @Param attacker_id query int false "攻击者 Agent ID"
+// @Param page query int false "页码(默认为1)"
+// @Param page_size query int false "每页大小(默认为4)"
+// @Success 200 {object} BattleJobsResponse "成功返回任务列表"
+// @Failure 400 {object} errors.APIError "请求参数错误"
+// @Failure 401 {object} errors.APIError "未授权"
+// @Failure 403 {object} errors.APIError "无权限"
+// @Failure 500 {object} errors.APIError "服务器错误"
+// @Security BearerAuth
+// @Router /api/admin/battle_jobs [get]
+func (s *BattleService) ListBattleJobs(c *gin.Context) {
+	page, err := utils.ParsePage(c.Query("page"))
+	if err != nil {
+		page = 1
+	}
+	pageSize, err := utils.ParsePageSize(c.Query("page_size"))
+	if err != nil {
+		pageSize = utils.DefaultPageSize
+	}
+
+	query := s.db.Model(&models.BattleJob{})
+	if status := c.Query("status"); status != "" {
+		if !models.BattleJobStatus(status).Valid() {
+			c.Error(errors.NewAPIError(errors.ErrValidation, "Invalid status", status))
+			return
+		}
+		query = query.Where("status = ?", status)
+	}
+	if attackerID := c.Query("attacker_id"); attackerID != "" {
+		query = query.Where("attacker_id = ?", attackerID)
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to count battle jobs", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("ListBattleJobs: failed to count battle jobs", zap.Error(err))
+		return
+	}
+
+	jobs := []models.BattleJob{}
+	if err := query.Order("created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&jobs).Error; err != nil {
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to retrieve battle jobs", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("ListBattleJobs: failed to retrieve battle jobs", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, BattleJobsResponse{
+		Jobs:     jobs,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	})
+}
+
+// RetryBattleJob godoc
+// @Summary 重试战斗任务
+// @Description 管理员将 failed 或 cancelled 的任务重新放回队列，并重置尝试次数
+// @Tags Admin
+// @Produce json
+// @Param id path int true "任务 ID"
+// @Success 200 {object} models.BattleJob "任务已重新排队"
+// @Failure 404 {object} errors.APIError "未找到"
+// @Failure 409 {object} errors.APIError "任务状态不允许重试"
+// @Failure 500 {object} errors.APIError "服务器错误"
+// @Security BearerAuth
+// @Router /api/admin/battle_jobs/{id}/retry [post]
+func (s *BattleService) RetryBattleJob(c *gin.Context) {
+	s.transitionBattleJob(c, "RetryBattleJob",
+		[]models.BattleJobStatus{models.BattleJobFailed, models.BattleJobCancelled},
+		map[string]interface{}{
+			"status":      models.BattleJobPending,
+			"attempts":    0,
+			"next_run_at": time.Now(),
+			"finished_at": nil,
+		})
+}
+
+// CancelBattleJob godoc
+// @Summary 取消战斗任务
+// @Description 管理员取消 pending 或 failed 的任务，running 中的任务无法取消
+// @Tags Admin
+// @Produce json
+// @Param id path int true "任务 ID"
+// @Success 200 {object} models.BattleJob "任务已取消"
+// @Failure 404 {object} errors.APIError "未找到"
+// @Failure 409 {object} errors.APIError "任务状态不允许取消"
+// @Failure 500 {object} errors.APIError "服务器错误"
+// @Security BearerAuth
+// @Router /api/admin/battle_jobs/{id}/cancel [post]
+func (s *BattleService) CancelBattleJob(c *gin.Context) {
+	s.transitionBattleJob(c, "CancelBattleJob",
+		[]models.BattleJobStatus{models.BattleJobPending, models.BattleJobFailed},
+		map[string]interface{}{
+			"status":      models.BattleJobCancelled,
+			"finished_at": time.Now(),
+		})
+}
+
+// transitionBattleJob 仅当任务处于 from 中的状态时才应用 updates
+func (s *BattleService) transitionBattleJob(c *gin.Context, action string, from []models.BattleJobStatus, updates map[string]interface{}) {
+	jobID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		apiErr := errors.NewAPIError(errors.ErrValidation, "Invalid job ID", err.Error())
+		c.Error(apiErr)
+		return
+	}
+
+	var job models.BattleJob
+	if err := s.db.First(&job, jobID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apiErr := errors.NewAPIError(errors.ErrNotFound, "Battle job not found")
+			c.Error(apiErr)
+			return
+		}
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to retrieve battle job", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error(action+": failed to retrieve battle job", zap.Error(err))
+		return
+	}
+
+	// 带状态条件更新，避免与 worker 并发修改
+	result := s.db.Model(&job).Where("status IN ?", from).Updates(updates)
+	if result.Error != nil {
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to update battle job", result.Error.Error())
+		c.Error(apiErr)
+		logger.Logger.Error(action+": failed to update battle job", zap.Error(result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		apiErr := errors.NewAPIError(errors.ErrConflict, "Battle job cannot be changed in its current status", string(job.Status))
+		c.Error(apiErr)
+		return
+	}
+
+	if err := s.db.First(&job, jobID).Error; err != nil {
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to retrieve battle job", err.Error())
+		c.Error(apiErr)
+		return
+	}
+
+	logger.Logger.Info(action+": battle job updated", zap.Uint("jobId", job.ID), zap.String("status", string(job.Status)))
+	c.JSON(http.StatusOK, job)
+}
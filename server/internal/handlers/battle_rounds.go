@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/logger"
+	"github.com/GabbyWorld/all-time-high-backend/internal/models"
+	"github.com/GabbyWorld/all-time-high-backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// fightRounds 依次生成多回合战斗的每个回合并在完成时广播（带上本次执行的 run），回合由裁判团中第一个裁判的模型叙述。
+// 任一回合多次无法解析时返回错误，整场战斗交由任务重试
+func (s *BattleService) fightRounds(run BattleRunRef, attackers, defenders []models.Agent) ([]models.BattleRound, []utils.BattleRoundResult, error) {
+	total := s.Config.Battle.Rounds
+	narrator := s.Config.Battle.JudgePanel[0]
+	opts := utils.JudgeOptions{Model: narrator.Model, Temperature: narrator.Temperature}
+	attackerTeam, defenderTeam := combatants(attackers), combatants(defenders)
+
+	rounds := make([]models.BattleRound, 0, total)
+	results := make([]utils.BattleRoundResult, 0, total)
+	var attackerScore, defenderScore int
+	for round := 1; round <= total; round++ {
+		var result *utils.BattleRoundResult
+		var err error
+		for attempt := 1; attempt <= maxVerdictAttempts; attempt++ {
+			result, err = utils.GenerateBattleRound(
+				s.Config.OpenAI.APIKey,
+				s.Config.OpenAI.CompletionsEndpoint,
+				opts,
+				attackerTeam,
+				defenderTeam,
+				round,
+				total,
+				results,
+			)
+			if err == nil || !errors.Is(err, utils.ErrInvalidVerdict) {
+				break
+			}
+			logger.Logger.Warn("Narrator returned an invalid round, retrying",
+				zap.Int("round", round),
+				zap.Int("attempt", attempt),
+				zap.Uint("attacker", attackers[0].ID),
+				zap.Uint("defender", defenders[0].ID),
+				zap.Error(err))
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("generate round %d: %w", round, err)
+		}
+
+		attackerScore += result.AttackerPoints
+		defenderScore += result.DefenderPoints
+		battleRound := models.BattleRound{
+			Round:          round,
+			Narrative:      result.Narrative,
+			AttackerPoints: result.AttackerPoints,
+			DefenderPoints: result.DefenderPoints,
+			AttackerScore:  attackerScore,
+			DefenderScore:  defenderScore,
+		}
+		rounds = append(rounds, battleRound)
+		results = append(results, *result)
+
+		s.wsHandler.BroadcastBattleRound(run, attackers[0].ID, defenders[0].ID, total, battleRound)
+	}
+	return rounds, results, nil
+}
@@ -105,28 +105,140 @@ func (h *BattleWebSocketHandler) HandleBattleWebSocket(c *gin.Context) {
 
 // BroadcastBattleResult sends battle results to relevant clients
 func (h *BattleWebSocketHandler) BroadcastBattleResult(result models.Battle) {
-	h.ClientsMux.RLock()
-	defer h.ClientsMux.RUnlock()
-
 	message := struct {
-		Type string `json:"type"`
+		Type string        `json:"type"`
 		Data models.Battle `json:"battle"`
 	}{
 		Type: "BATTLE_RESULT",
 		Data: result,
 	}
+	h.broadcast(message)
+}
+
+// BattleRunRef identifies one execution of a battle so clients can group its rounds before the battle exists.
+// Battles run from the job queue carry the job ID and attempt; a retried job sends its rounds again under a new run ID
+type BattleRunRef struct {
+	RunID   string `json:"run_id"`
+	JobID   *uint  `json:"job_id,omitempty"`
+	Attempt int    `json:"attempt,omitempty"`
+}
+
+// BroadcastBattleRound sends a completed round of a multi-round battle. The battle has no ID yet,
+// so clients group rounds by run ID until BATTLE_RUN_FINISHED reports the battle or the abort
+func (h *BattleWebSocketHandler) BroadcastBattleRound(run BattleRunRef, attackerID, defenderID uint, rounds int, round models.BattleRound) {
+	message := struct {
+		Type string `json:"type"`
+		BattleRunRef
+		AttackerID uint               `json:"attacker_id"`
+		DefenderID uint               `json:"defender_id"`
+		Rounds     int                `json:"rounds"`
+		Data       models.BattleRound `json:"round"`
+	}{
+		Type:         "BATTLE_ROUND",
+		BattleRunRef: run,
+		AttackerID:   attackerID,
+		DefenderID:   defenderID,
+		Rounds:       rounds,
+		Data:         round,
+	}
+	h.broadcast(message)
+}
 
+// BroadcastBattleRunFinished ends a multi-round battle run: status is "completed" with the created battle ID,
+// or "aborted" with the reason, in which case the rounds already sent for this run should be discarded
+func (h *BattleWebSocketHandler) BroadcastBattleRunFinished(run BattleRunRef, status string, battleID *uint, reason string) {
+	message := struct {
+		Type string `json:"type"`
+		BattleRunRef
+		Status   string `json:"status"`
+		BattleID *uint  `json:"battle_id,omitempty"`
+		Reason   string `json:"reason,omitempty"`
+	}{
+		Type:         "BATTLE_RUN_FINISHED",
+		BattleRunRef: run,
+		Status:       status,
+		BattleID:     battleID,
+		Reason:       reason,
+	}
+	h.broadcast(message)
+}
+
+// BroadcastAthEvent notifies clients that an agent's token broke its all-time high
+func (h *BattleWebSocketHandler) BroadcastAthEvent(event models.AthEvent, agent models.Agent) {
+	type athAgent struct {
+		ID       uint   `json:"id"`
+		Name     string `json:"name"`
+		Ticker   string `json:"ticker"`
+		ImageURL string `json:"image_url"`
+	}
+	message := struct {
+		Type  string          `json:"type"`
+		Data  models.AthEvent `json:"ath_event"`
+		Agent athAgent        `json:"agent"`
+	}{
+		Type: "ATH_BREAKOUT",
+		Data: event,
+		Agent: athAgent{
+			ID:       agent.ID,
+			Name:     agent.Name,
+			Ticker:   agent.Ticker,
+			ImageURL: agent.ImageURL,
+		},
+	}
+	h.broadcast(message)
+}
+
+// BroadcastGraduation notifies clients that an agent's token completed its bonding curve
+func (h *BattleWebSocketHandler) BroadcastGraduation(event GraduationEvent) {
+	message := struct {
+		Type string          `json:"type"`
+		Data GraduationEvent `json:"graduation"`
+	}{
+		Type: "TOKEN_GRADUATED",
+		Data: event,
+	}
+	h.broadcast(message)
+}
+
+// BroadcastTournamentRound notifies clients of the results of a tournament round
+func (h *BattleWebSocketHandler) BroadcastTournamentRound(tournament models.Tournament, round int, matches []models.TournamentMatch) {
+	message := struct {
+		Type         string                   `json:"type"`
+		TournamentID uint                     `json:"tournament_id"`
+		Name         string                   `json:"name"`
+		Status       models.TournamentStatus  `json:"status"`
+		Round        int                      `json:"round"`
+		WinnerID     *uint                    `json:"winner_id,omitempty"`
+		Matches      []models.TournamentMatch `json:"matches"`
+	}{
+		Type:         "TOURNAMENT_ROUND",
+		TournamentID: tournament.ID,
+		Name:         tournament.Name,
+		Status:       tournament.Status,
+		Round:        round,
+		WinnerID:     tournament.WinnerID,
+		Matches:      matches,
+	}
+	h.broadcast(message)
+}
+
+// broadcast marshals the message and sends it to all clients
+func (h *BattleWebSocketHandler) broadcast(message interface{}) {
 	payload, err := json.Marshal(message)
 	if err != nil {
-		logger.Logger.Error("Failed to marshal battle result", zap.Error(err))
+		logger.Logger.Error("Failed to marshal battle websocket message", zap.Error(err))
 		return
 	}
 
+	// Writes must not run concurrently on the same connection, so hold the exclusive lock
+	h.ClientsMux.Lock()
+	defer h.ClientsMux.Unlock()
+
 	// Send to all clients
 	for _, clientConn := range h.Clients {
 		err := clientConn.WriteMessage(websocket.TextMessage, payload)
 		if err != nil {
-			logger.Logger.Error("Failed to send battle result to client",
+			logger.Logger.Error("Failed to send battle websocket message to client",
 				zap.Error(err))
 		}
 	}
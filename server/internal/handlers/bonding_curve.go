@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"context"
+	stderrors "errors"
+	"time"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/config"
+	"github.com/GabbyWorld/all-time-high-backend/internal/logger"
+	"github.com/GabbyWorld/all-time-high-backend/internal/models"
+	"github.com/GabbyWorld/all-time-high-backend/pkg/utils"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// curveBatchSize 单次 getMultipleAccounts 读取的联合曲线数量上限
+const curveBatchSize = 100
+
+// WebhookEventGraduation 代币毕业事件在 webhook 中的类型
+const WebhookEventGraduation = "token.graduated"
+
+// GraduationEvent 代币联合曲线完成（毕业）事件，通过 websocket 和 webhook 推送
+type GraduationEvent struct {
+	AgentID         uint      `json:"agent_id"`
+	Name            string    `json:"name"`
+	Ticker          string    `json:"ticker"`
+	ImageURL        string    `json:"image_url"`
+	TokenAddress    string    `json:"token_address"`
+	RealSOLReserves uint64    `json:"real_sol_reserves"` // 毕业时曲线中的 SOL（lamports）
+	GraduatedAt     time.Time `json:"graduated_at"`
+}
+
+// BondingCurveService 定期读取 Agent 代币的 pump.fun 联合曲线，记录进度并处理毕业
+type BondingCurveService struct {
+	db       *gorm.DB
+	reader   *utils.BondingCurveReader
+	battles  *BattleService
+	webhooks *utils.WebhookNotifier
+	Config   *config.Config
+}
+
+func NewBondingCurveService(db *gorm.DB, reader *utils.BondingCurveReader, battles *BattleService, webhooks *utils.WebhookNotifier, config *config.Config) *BondingCurveService {
+	return &BondingCurveService{db: db, reader: reader, battles: battles, webhooks: webhooks, Config: config}
+}
+
+// Start 按 BONDING_CURVE_REFRESH_INTERVAL 刷新尚未毕业的 Agent 的联合曲线
+func (s *BondingCurveService) Start() {
+	go func() {
+		ticker := time.NewTicker(s.Config.Price.CurveRefreshInterval)
+		defer ticker.Stop()
+		for ; true; <-ticker.C {
+			var agents []models.Agent
+			if err := s.db.Where("token_address <> '' AND graduated = ?", false).Find(&agents).Error; err != nil {
+				logger.Logger.Error("Failed to fetch agents for bonding curve refresh", zap.Error(err))
+				continue
+			}
+			s.Refresh(context.Background(), agents)
+		}
+	}()
+}
+
+// Refresh 读取 agents 的联合曲线并写入进度，曲线完成时记录毕业
+func (s *BondingCurveService) Refresh(ctx context.Context, agents []models.Agent) {
+	for start := 0; start < len(agents); start += curveBatchSize {
+		batch := agents[start:min(start+curveBatchSize, len(agents))]
+		mints := make([]string, len(batch))
+		for i, agent := range batch {
+			mints[i] = agent.TokenAddress
+		}
+
+		curves, failures, err := s.reader.GetBondingCurves(ctx, mints)
+		if err != nil {
+			logger.Logger.Error("Failed to read bonding curves", zap.Int("count", len(mints)), zap.Error(err))
+			continue
+		}
+		for mint, err := range failures {
+			// 没有联合曲线账户的代币（例如模拟创建的代币）不是错误
+			if !stderrors.Is(err, utils.ErrNoPrice) {
+				logger.Logger.Warn("Failed to decode bonding curve", zap.String("tokenAddress", mint), zap.Error(err))
+			}
+		}
+
+		now := time.Now()
+		for _, agent := range batch {
+			if curve, ok := curves[agent.TokenAddress]; ok {
+				s.applyCurve(agent, curve, now)
+			}
+		}
+	}
+}
+
+// applyCurve 写入一次联合曲线读数。第一次读取时已完成的曲线只记录状态，不推送毕业事件
+func (s *BondingCurveService) applyCurve(agent models.Agent, curve *utils.BondingCurve, now time.Time) {
+	updates := map[string]interface{}{
+		"curve_virtual_token_reserves": curve.VirtualTokenReserves,
+		"curve_virtual_sol_reserves":   curve.VirtualSOLReserves,
+		"curve_real_token_reserves":    curve.RealTokenReserves,
+		"curve_real_sol_reserves":      curve.RealSOLReserves,
+		"curve_progress":               curve.Progress(),
+		"curve_updated_at":             now,
+	}
+	if !curve.Complete || agent.Graduated {
+		if err := s.db.Model(&models.Agent{}).Where("id = ?", agent.ID).UpdateColumns(updates).Error; err != nil {
+			logger.Logger.Error("Failed to update agent bonding curve", zap.Uint("agentId", agent.ID), zap.Error(err))
+		}
+		return
+	}
+
+	// 按 graduated = false 条件更新，保证每个代币只处理一次毕业
+	updates["graduated"] = true
+	updates["graduated_at"] = now
+	result := s.db.Model(&models.Agent{}).Where("id = ? AND graduated = ?", agent.ID, false).UpdateColumns(updates)
+	if result.Error != nil {
+		logger.Logger.Error("Failed to record agent graduation", zap.Uint("agentId", agent.ID), zap.Error(result.Error))
+		return
+	}
+	if result.RowsAffected == 0 || agent.CurveUpdatedAt == nil {
+		return
+	}
+
+	logger.Logger.Info("Agent token graduated", zap.Uint("agentId", agent.ID), zap.String("tokenAddress", agent.TokenAddress))
+	agent.Graduated = true
+	agent.GraduatedAt = &now
+	s.announceGraduation(agent, curve, now)
+}
+
+// announceGraduation 推送毕业事件，并在开启 BATTLE_TRIGGER_ON_GRADUATION 时触发一场战斗
+func (s *BondingCurveService) announceGraduation(agent models.Agent, curve *utils.BondingCurve, now time.Time) {
+	event := GraduationEvent{
+		AgentID:         agent.ID,
+		Name:            agent.Name,
+		Ticker:          agent.Ticker,
+		ImageURL:        agent.ImageURL,
+		TokenAddress:    agent.TokenAddress,
+		RealSOLReserves: curve.RealSOLReserves,
+		GraduatedAt:     now,
+	}
+	s.battles.wsHandler.BroadcastGraduation(event)
+
+	if s.webhooks.Enabled() {
+		go func() {
+			for url, err := range s.webhooks.Notify(context.Background(), WebhookEventGraduation, event) {
+				logger.Logger.Error("Failed to deliver graduation webhook", zap.Uint("agentId", agent.ID), zap.String("url", url), zap.Error(err))
+			}
+		}()
+	}
+
+	if s.Config.Battle.TriggerOnGraduation {
+		var skip *battleSkipError
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			skip, err = s.battles.enqueueTriggeredBattle(tx, agent, battleTrigger{Type: models.BattleTypeGraduation})
+			return err
+		})
+		if err != nil {
+			logger.Logger.Error("Failed to enqueue graduation battle", zap.Uint("agentId", agent.ID), zap.Error(err))
+		} else if skip != nil {
+			s.battles.reportTriggerSkip(agent.ID, models.BattleTypeGraduation, skip)
+		}
+	}
+}
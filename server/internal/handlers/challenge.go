@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/errors"
+	"github.com/GabbyWorld/all-time-high-backend/internal/logger"
+	"github.com/GabbyWorld/all-time-high-backend/internal/models"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ChallengeRequest 发起挑战的请求
+type ChallengeRequest struct {
+	AttackerID uint `json:"attacker_id" binding:"required"`
+	DefenderID uint `json:"defender_id" binding:"required"`
+}
+
+// ChallengeBattle godoc
+// @Summary 发起挑战
+// @Description Agent 的所有者指定对手发起一场挑战。挑战进入战斗任务队列，由裁判团判定，结果通过战斗 WebSocket 推送。
+// @Description 同一 Agent 两次挑战之间需要间隔 BATTLE_CHALLENGE_COOLDOWN
+// @Tags Battle
+// @Accept json
+// @Produce json
+// @Param challenge body ChallengeRequest true "挑战双方"
+// @Success 202 {object} models.BattleJob "挑战已排队"
+// @Failure 400 {object} errors.APIError "请求参数错误或对手不可参战"
+// @Failure 403 {object} errors.APIError "不是攻击方 Agent 的所有者"
+// @Failure 404 {object} errors.APIError "Agent 不存在"
+// @Failure 429 {object} errors.APIError "挑战冷却中"
+// @Failure 500 {object} errors.APIError "服务器错误"
+// @Security BearerAuth
+// @Router /api/battle/challenge [post]
+func (s *BattleService) ChallengeBattle(c *gin.Context) {
+	var req ChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiErr := errors.NewAPIError(errors.ErrValidation, "Request validation failed", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("ChallengeBattle: validation failed", zap.Error(err))
+		return
+	}
+	if req.AttackerID == req.DefenderID {
+		apiErr := errors.NewAPIError(errors.ErrValidation, "An agent cannot challenge itself")
+		c.Error(apiErr)
+		return
+	}
+
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		apiErr := errors.NewAPIError(errors.ErrUnauthorized, "User ID not found in context")
+		c.Error(apiErr)
+		logger.Logger.Error("ChallengeBattle: userID not found in context")
+		return
+	}
+	userID, ok := userIDInterface.(uint)
+	if !ok {
+		apiErr := errors.NewAPIError(errors.ErrInternal, "Invalid user ID format")
+		c.Error(apiErr)
+		logger.Logger.Error("ChallengeBattle: userID format incorrect", zap.Any("userID", userIDInterface))
+		return
+	}
+
+	var job models.BattleJob
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// 锁住攻击方，保证并发请求下冷却检查和入队是原子的
+		var attacker models.Agent
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&attacker, req.AttackerID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errors.NewAPIError(errors.ErrNotFound, "Attacker agent not found")
+			}
+			return err
+		}
+		if attacker.UserID != userID {
+			return errors.NewAPIError(errors.ErrForbidden, "Only the agent owner can issue a challenge")
+		}
+
+		var defender models.Agent
+		if err := tx.First(&defender, req.DefenderID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errors.NewAPIError(errors.ErrNotFound, "Defender agent not found")
+			}
+			return err
+		}
+		var available int64
+		if err := activeOpponents(tx, attacker, nil).Where("id = ?", defender.ID).Count(&available).Error; err != nil {
+			return err
+		}
+		if available == 0 {
+			return errors.NewAPIError(errors.ErrValidation, "Defender agent is not available for battles")
+		}
+
+		if wait, err := s.challengeCooldownRemaining(tx, attacker.ID); err != nil {
+			return err
+		} else if wait > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			return errors.NewAPIError(errors.ErrRateLimited, "Agent is on challenge cooldown", fmt.Sprintf("retry after %s", wait.Round(time.Second)))
+		}
+
+		// 挑战同样受公平性规则约束，提前拒绝而不是排队后取消
+		skip, err := s.checkAttacker(s.db, attacker.ID, false)
+		if err != nil {
+			return err
+		}
+		if skip == nil {
+			ineligible, err := s.ineligibleDefenders(attacker)
+			if err != nil {
+				return err
+			}
+			skip = ineligible[defender.ID]
+		}
+		if skip != nil {
+			return errors.NewAPIError(errors.ErrRateLimited, "Challenge blocked by battle fairness rules", skip.Error())
+		}
+
+		job = models.BattleJob{
+			AttackerID:  attacker.ID,
+			DefenderID:  &defender.ID,
+			Type:        models.BattleTypeChallenge,
+			Status:      models.BattleJobPending,
+			MaxAttempts: s.Config.Battle.JobMaxAttempts,
+			NextRunAt:   time.Now(),
+		}
+		return tx.Create(&job).Error
+	})
+	if err != nil {
+		apiErr, ok := err.(*errors.APIError)
+		if !ok {
+			apiErr = errors.NewAPIError(errors.ErrDatabase, "Failed to create challenge", err.Error())
+			logger.Logger.Error("ChallengeBattle: failed to create challenge", zap.Error(err))
+		}
+		c.Error(apiErr)
+		return
+	}
+
+	logger.Logger.Info("Challenge queued",
+		zap.Uint("jobId", job.ID),
+		zap.Uint("attacker", job.AttackerID),
+		zap.Uint("defender", *job.DefenderID),
+	)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// challengeCooldownRemaining 返回攻击方还需等待多久才能再次发起挑战，团队战以队长计入，取消的挑战不计入冷却
+func (s *BattleService) challengeCooldownRemaining(db *gorm.DB, attackerID uint) (time.Duration, error) {
+	var last models.BattleJob
+	result := db.Where("attacker_id = ? AND type IN ? AND status <> ?", attackerID,
+		[]models.BattleType{models.BattleTypeChallenge, models.BattleTypeTeam}, models.BattleJobCancelled).
+		Order("created_at DESC").
+		Limit(1).
+		Find(&last)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, nil
+	}
+	return time.Until(last.CreatedAt.Add(s.Config.Battle.ChallengeCooldown)), nil
+}
@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/errors"
+	"github.com/GabbyWorld/all-time-high-backend/internal/logger"
+	"github.com/GabbyWorld/all-time-high-backend/internal/models"
+	"github.com/GabbyWorld/all-time-high-backend/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 公平性规则，记录在 BattleSkip.Rule 中。规则适用于价格、ATH、毕业、挑战和团队战触发的战斗；
+// 锦标赛对阵由赛程决定，不受这些规则限制，但锦标赛战斗同样计入之后的冷却和每小时上限
+const (
+	ruleQueued           = "queued"
+	ruleAttackCooldown   = "attack_cooldown"
+	ruleDefenderCooldown = "defender_cooldown"
+	ruleHourlyLimit      = "hourly_limit"
+	rulePairRematch      = "pair_rematch"
+	// ruleExcluded 一次挑选对手时被排除的全部候选者，按规则汇总在 BattleSkip.Excluded 中
+	ruleExcluded = "excluded"
+)
+
+// battleSkipError 战斗因公平性规则被跳过，对应的任务直接取消而不是重试
+type battleSkipError struct {
+	Rule   string
+	Detail string
+}
+
+func (e *battleSkipError) Error() string {
+	return fmt.Sprintf("battle skipped by %s rule: %s", e.Rule, e.Detail)
+}
+
+// asBattleSkip 判断错误是否为公平性规则导致的跳过
+func asBattleSkip(err error) (*battleSkipError, bool) {
+	var skip *battleSkipError
+	ok := stderrors.As(err, &skip)
+	return skip, ok
+}
+
+// checkAttacker 在 db 中检查 Agent 当前能否发起攻击，queued 为 true 时已排队未执行的任务也视为占用。
+// 冷却和每小时上限按 battle_participants 统计，团队战中的每名成员都计入
+func (s *BattleService) checkAttacker(db *gorm.DB, agentID uint, queued bool) (*battleSkipError, error) {
+	cfg := s.Config.Battle
+	now := time.Now()
+
+	if queued {
+		var outstanding int64
+		if err := db.Model(&models.BattleJob{}).
+			Where("attacker_id = ? AND status IN ?", agentID, []models.BattleJobStatus{models.BattleJobPending, models.BattleJobRunning}).
+			Count(&outstanding).Error; err != nil {
+			return nil, err
+		}
+		if outstanding > 0 {
+			return &battleSkipError{Rule: ruleQueued, Detail: fmt.Sprintf("%d battle jobs already queued", outstanding)}, nil
+		}
+	}
+
+	if cfg.AttackCooldown > 0 {
+		var last models.Battle
+		result := db.Model(&models.Battle{}).
+			Select("battles.id", "battles.created_at").
+			Joins("JOIN battle_participants p ON p.battle_id = battles.id").
+			Where("p.agent_id = ? AND p.side = ? AND battles.created_at >= ?", agentID, models.SideAttacker, now.Add(-cfg.AttackCooldown)).
+			Order("battles.created_at DESC").
+			Limit(1).
+			Find(&last)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected > 0 {
+			return &battleSkipError{
+				Rule:   ruleAttackCooldown,
+				Detail: fmt.Sprintf("attacked %s ago, cooldown %s", now.Sub(last.CreatedAt).Round(time.Second), cfg.AttackCooldown),
+			}, nil
+		}
+	}
+
+	if cfg.MaxBattlesPerHour > 0 {
+		var recent int64
+		if err := db.Model(&models.Battle{}).
+			Joins("JOIN battle_participants p ON p.battle_id = battles.id").
+			Where("p.agent_id = ? AND battles.created_at >= ?", agentID, now.Add(-time.Hour)).
+			Count(&recent).Error; err != nil {
+			return nil, err
+		}
+		if recent >= int64(cfg.MaxBattlesPerHour) {
+			return &battleSkipError{
+				Rule:   ruleHourlyLimit,
+				Detail: fmt.Sprintf("%d battles in the last hour, limit %d", recent, cfg.MaxBattlesPerHour),
+			}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// ineligibleDefenders 返回当前不能作为 attacker 对手的 Agent 及原因，每个 Agent 只记录第一条命中的规则，团队战的成员与队长同样计入
+func (s *BattleService) ineligibleDefenders(attacker models.Agent) (map[uint]*battleSkipError, error) {
+	cfg := s.Config.Battle
+	now := time.Now()
+	skipped := make(map[uint]*battleSkipError)
+	mark := func(ids []uint, skip *battleSkipError) {
+		for _, id := range ids {
+			if _, ok := skipped[id]; !ok && id != attacker.ID {
+				skipped[id] = skip
+			}
+		}
+	}
+
+	if cfg.PairRematchWindow > 0 {
+		var ids []uint
+		if err := s.db.Table("battle_participants AS me").
+			Select("DISTINCT opponent.agent_id").
+			Joins("JOIN battle_participants AS opponent ON opponent.battle_id = me.battle_id AND opponent.side <> me.side").
+			Joins("JOIN battles ON battles.id = me.battle_id").
+			Where("me.agent_id = ? AND battles.created_at >= ?", attacker.ID, now.Add(-cfg.PairRematchWindow)).
+			Scan(&ids).Error; err != nil {
+			return nil, err
+		}
+		mark(ids, &battleSkipError{Rule: rulePairRematch, Detail: fmt.Sprintf("met within %s", cfg.PairRematchWindow)})
+	}
+
+	if cfg.DefenderCooldown > 0 {
+		var ids []uint
+		if err := s.db.Table("battle_participants p").
+			Joins("JOIN battles ON battles.id = p.battle_id").
+			Where("p.side = ? AND battles.created_at >= ?", models.SideDefender, now.Add(-cfg.DefenderCooldown)).
+			Distinct().
+			Pluck("p.agent_id", &ids).Error; err != nil {
+			return nil, err
+		}
+		mark(ids, &battleSkipError{Rule: ruleDefenderCooldown, Detail: fmt.Sprintf("defended within %s", cfg.DefenderCooldown)})
+	}
+
+	if cfg.MaxBattlesPerHour > 0 {
+		var ids []uint
+		if err := s.db.Table("battle_participants p").
+			Select("p.agent_id").
+			Joins("JOIN battles ON battles.id = p.battle_id").
+			Where("battles.created_at >= ?", now.Add(-time.Hour)).
+			Group("p.agent_id").
+			Having("COUNT(*) >= ?", cfg.MaxBattlesPerHour).
+			Scan(&ids).Error; err != nil {
+			return nil, err
+		}
+		mark(ids, &battleSkipError{Rule: ruleHourlyLimit, Detail: fmt.Sprintf("reached %d battles in the last hour", cfg.MaxBattlesPerHour)})
+	}
+
+	return skipped, nil
+}
+
+// recordAttackerSkip 记录攻击者被跳过的原因
+func (s *BattleService) recordAttackerSkip(agentID uint, battleType models.BattleType, skip *battleSkipError) {
+	s.recordSkips([]models.BattleSkip{{
+		AgentID: agentID,
+		Role:    "attacker",
+		Rule:    skip.Rule,
+		Detail:  skip.Detail,
+		Type:    battleType,
+	}})
+}
+
+// recordDefenderSkips 为 attacker 的一次挑选对手写入一条记录，被排除的候选者按规则汇总
+func (s *BattleService) recordDefenderSkips(attackerID uint, battleType models.BattleType, skipped map[uint]*battleSkipError) {
+	if len(skipped) == 0 {
+		return
+	}
+	excluded := make(map[string][]uint)
+	for agentID, skip := range skipped {
+		excluded[skip.Rule] = append(excluded[skip.Rule], agentID)
+	}
+	summary := make([]string, 0, len(excluded))
+	for rule, ids := range excluded {
+		slices.Sort(ids)
+		summary = append(summary, fmt.Sprintf("%s: %d", rule, len(ids)))
+	}
+	slices.Sort(summary)
+
+	s.recordSkips([]models.BattleSkip{{
+		AgentID:  attackerID,
+		Role:     "candidates",
+		Rule:     ruleExcluded,
+		Detail:   strings.Join(summary, "; "),
+		Excluded: excluded,
+		Type:     battleType,
+	}})
+}
+
+func (s *BattleService) recordSkips(skips []models.BattleSkip) {
+	if len(skips) == 0 {
+		return
+	}
+	if err := s.db.Create(&skips).Error; err != nil {
+		logger.Logger.Error("Failed to record battle skips", zap.Int("count", len(skips)), zap.Error(err))
+	}
+}
+
+// BattleSkipsResponse 公平性跳过记录列表
+type BattleSkipsResponse struct {
+	Skips    []models.BattleSkip `json:"skips"`
+	Total    int64               `json:"total"`
+	Page     int                 `json:"page"`
+	PageSize int                 `json:"page_size"`
+}
+
+// ListBattleSkips godoc
+// @Summary 获取公平性跳过记录
+// @Description 管理员查看因冷却、每小时上限或重复交手限制而被跳过的攻击者和候选防御者（分页）。
+// @Description 每次挑选对手写入一条 candidates 记录，被排除的候选者按规则汇总在 excluded 中；按 agent_id 或 rule 过滤时也会匹配其中的候选者
+// @Tags Admin
+// @Produce json
+// @Param agent_id query int false "Agent ID"
+// @Param rule query string false "规则: queued, attack_cooldown, defender_cooldown, hourly_limit, pair_rematch"
+// @Param role query string false "角色: attacker 或 candidates"
+// @Param page query int false "页码(默认为1)"
+// @Param page_size query int false "每页大小(默认为4)"
+// @Success 200 {object} BattleSkipsResponse "成功返回跳过记录"
+// @Failure 400 {object} errors.APIError "请求参数错误"
+// @Failure 401 {object} errors.APIError "未授权"
+// @Failure 403 {object} errors.APIError "无权限"
+// @Failure 500 {object} errors.APIError "服务器错误"
+// @Security BearerAuth
+// @Router /api/admin/battle_skips [get]
+func (s *BattleService) ListBattleSkips(c *gin.Context) {
+	page, err := utils.ParsePage(c.Query("page"))
+	if err != nil {
+		page = 1
+	}
+	pageSize, err := utils.ParsePageSize(c.Query("page_size"))
+	if err != nil {
+		pageSize = utils.DefaultPageSize
+	}
+
+	query := s.db.Model(&models.BattleSkip{})
+	if param := c.Query("agent_id"); param != "" {
+		agentID, err := strconv.ParseUint(param, 10, 64)
+		if err != nil {
+			c.Error(errors.NewAPIError(errors.ErrValidation, "Invalid agent ID", param))
+			return
+		}
+		query = query.Where("agent_id = ? OR EXISTS (SELECT 1 FROM jsonb_each(excluded) e WHERE e.value @> jsonb_build_array(?::bigint))", agentID, agentID)
+	}
+	if rule := c.Query("rule"); rule != "" {
+		query = query.Where("rule = ? OR jsonb_exists(excluded, ?)", rule, rule)
+	}
+	if role := c.Query("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to count battle skips", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("ListBattleSkips: failed to count battle skips", zap.Error(err))
+		return
+	}
+
+	skips := []models.BattleSkip{}
+	if err := query.Order("created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&skips).Error; err != nil {
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to retrieve battle skips", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("ListBattleSkips: failed to retrieve battle skips", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, BattleSkipsResponse{
+		Skips:    skips,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	})
+}
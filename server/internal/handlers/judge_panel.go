@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/config"
+	"github.com/GabbyWorld/all-time-high-backend/internal/logger"
+	"github.com/GabbyWorld/all-time-high-backend/internal/models"
+	"github.com/GabbyWorld/all-time-high-backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// 裁判团的判决类型
+const (
+	decisionUnanimous = "unanimous"
+	decisionSplit     = "split"
+	decisionTie       = "tie"
+)
+
+// panelVerdict 裁判团汇总后的判决
+type panelVerdict struct {
+	Outcome     models.BattleOutcome
+	Margin      int
+	Narrative   string
+	Reasoning   string
+	Aggregation string
+	Decision    string
+	Votes       []models.JudgeVote
+}
+
+// judgeBattle 让裁判团中每个裁判独立判决并汇总。单个裁判无法解析的判决会重试，
+// 成功投票的裁判不足半数时返回错误，不记录战斗。每一方的第一个 Agent 为队长，
+// 多回合战斗的 rounds 交给每个裁判作为判决依据
+func (s *BattleService) judgeBattle(attackers, defenders []models.Agent, rounds []utils.BattleRoundResult) (*panelVerdict, error) {
+	panel := s.Config.Battle.JudgePanel
+	attacker, defender := attackers[0], defenders[0]
+	votes := make([]*models.JudgeVote, len(panel))
+	errs := make([]error, len(panel))
+
+	var wg sync.WaitGroup
+	for i, judge := range panel {
+		wg.Add(1)
+		go func(i int, judge config.JudgeSpec) {
+			defer wg.Done()
+			votes[i], errs[i] = s.askJudge(i, judge, attackers, defenders, rounds)
+		}(i, judge)
+	}
+	wg.Wait()
+
+	var cast []models.JudgeVote
+	for i, vote := range votes {
+		if vote != nil {
+			cast = append(cast, *vote)
+			continue
+		}
+		logger.Logger.Warn("Judge did not vote",
+			zap.Int("judge", i),
+			zap.String("model", panel[i].Model),
+			zap.Uint("attacker", attacker.ID),
+			zap.Uint("defender", defender.ID),
+			zap.Error(errs[i]))
+	}
+	if len(cast)*2 <= len(panel) {
+		return nil, fmt.Errorf("only %d of %d judges voted: %w", len(cast), len(panel), errors.Join(errs...))
+	}
+
+	return aggregateVotes(cast, s.Config.Battle.JudgeAggregation), nil
+}
+
+// askJudge 调用单个裁判，无法解析的判决最多尝试 maxVerdictAttempts 次
+func (s *BattleService) askJudge(index int, judge config.JudgeSpec, attackers, defenders []models.Agent, rounds []utils.BattleRoundResult) (*models.JudgeVote, error) {
+	opts := utils.JudgeOptions{Model: judge.Model, Temperature: judge.Temperature}
+	attackerTeam, defenderTeam := combatants(attackers), combatants(defenders)
+
+	var lastErr error
+	for attempt := 1; attempt <= maxVerdictAttempts; attempt++ {
+		verdict, err := utils.GenerateBattleOutcome(
+			s.Config.OpenAI.APIKey,
+			s.Config.OpenAI.CompletionsEndpoint,
+			opts,
+			attackerTeam,
+			defenderTeam,
+			rounds,
+		)
+		if err == nil {
+			return &models.JudgeVote{
+				Judge:       index,
+				Model:       judge.Model,
+				Temperature: judge.Temperature,
+				Outcome:     verdict.Outcome,
+				Margin:      verdict.Margin,
+				Narrative:   verdict.Narrative,
+				Reasoning:   verdict.Reasoning,
+			}, nil
+		}
+		lastErr = err
+		if !errors.Is(err, utils.ErrInvalidVerdict) {
+			return nil, err
+		}
+		logger.Logger.Warn("Judge returned an invalid verdict, retrying",
+			zap.Int("judge", index),
+			zap.Int("attempt", attempt),
+			zap.Uint("attacker", attackers[0].ID),
+			zap.Uint("defender", defenders[0].ID),
+			zap.Error(err))
+	}
+	return nil, fmt.Errorf("verdict flagged after %d attempts: %w", maxVerdictAttempts, lastErr)
+}
+
+// combatants 把一方的 Agent 转换为裁判提示词中的参战者
+func combatants(agents []models.Agent) []utils.Combatant {
+	team := make([]utils.Combatant, len(agents))
+	for i, agent := range agents {
+		team[i] = utils.Combatant{Name: agent.Name, Prompt: agent.Prompt}
+	}
+	return team
+}
+
+// signedMargin 以攻击者为正方向的差距
+func signedMargin(vote models.JudgeVote) float64 {
+	if vote.Outcome.DefenderWon() {
+		return -float64(vote.Margin)
+	}
+	return float64(vote.Margin)
+}
+
+// aggregateVotes 按 majority 或 mean_margin 汇总投票。
+// 双方票数相同（或平均差距为 0）判为 DRAW；非全票的判决记为 split，且不会判为压倒性结果
+func aggregateVotes(votes []models.JudgeVote, mode string) *panelVerdict {
+	var attackerVotes, defenderVotes, decisiveVotes int
+	var sum float64
+	for _, vote := range votes {
+		if vote.Outcome.AttackerWon() {
+			attackerVotes++
+		} else {
+			defenderVotes++
+		}
+		if vote.Outcome.Decisive() {
+			decisiveVotes++
+		}
+		sum += signedMargin(vote)
+	}
+	mean := sum / float64(len(votes))
+
+	decision := decisionSplit
+	if attackerVotes == 0 || defenderVotes == 0 {
+		decision = decisionUnanimous
+	}
+
+	// 正数表示攻击者获胜，负数表示防御者获胜，0 为平局
+	var direction float64
+	var decisive bool
+	switch mode {
+	case "mean_margin":
+		direction = mean
+		decisive = math.Abs(mean) >= utils.DecisiveMargin
+	default:
+		direction = float64(attackerVotes - defenderVotes)
+		decisive = decisiveVotes*2 > len(votes)
+	}
+
+	verdict := &panelVerdict{
+		Aggregation: mode,
+		Decision:    decision,
+		Margin:      panelMargin(votes, mode, mean, direction),
+		Votes:       votes,
+	}
+	switch {
+	case direction == 0:
+		verdict.Outcome = models.OutcomeDraw
+		verdict.Decision = decisionTie
+	case direction > 0 && decisive && decision == decisionUnanimous:
+		verdict.Outcome = models.OutcomeTotalVictory
+	case direction > 0:
+		verdict.Outcome = models.OutcomeNarrowVictory
+	case decisive && decision == decisionUnanimous:
+		verdict.Outcome = models.OutcomeCrushingDefeat
+	default:
+		verdict.Outcome = models.OutcomeNarrowDefeat
+	}
+
+	// 选用与汇总结果最接近的裁判的故事作为战斗描述
+	representative := votes[0]
+	for _, vote := range votes[1:] {
+		if math.Abs(signedMargin(vote)-mean) < math.Abs(signedMargin(representative)-mean) {
+			representative = vote
+		}
+	}
+	verdict.Narrative = representative.Narrative
+	verdict.Reasoning = representative.Reasoning
+
+	// 差距与结果保持在同一档位：压倒性结果不低于 DecisiveMargin，险胜低于该值
+	if verdict.Outcome.Decisive() {
+		verdict.Margin = max(verdict.Margin, utils.DecisiveMargin)
+	} else {
+		verdict.Margin = min(verdict.Margin, utils.DecisiveMargin-1)
+	}
+	return verdict
+}
+
+// panelMargin 汇总后的差距。mean_margin 取平均差距的绝对值；majority 只取获胜一方裁判的平均差距，
+// 少数派的差距不会让结果与差距方向相反。平局为 0
+func panelMargin(votes []models.JudgeVote, mode string, mean, direction float64) int {
+	if direction == 0 {
+		return 0
+	}
+	if mode == "mean_margin" {
+		return int(math.Round(math.Abs(mean)))
+	}
+	var sum float64
+	var count int
+	for _, vote := range votes {
+		if vote.Outcome.AttackerWon() == (direction > 0) {
+			sum += math.Abs(signedMargin(vote))
+			count++
+		}
+	}
+	return int(math.Round(sum / float64(count)))
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/models"
+)
+
+func TestAggregateVotesMajorityMarginFromWinners(t *testing.T) {
+	// 两票险胜、一票压倒性失败：平均差距为负，但多数判攻击者获胜
+	votes := []models.JudgeVote{
+		{Outcome: models.OutcomeNarrowVictory, Margin: 10},
+		{Outcome: models.OutcomeNarrowVictory, Margin: 20},
+		{Outcome: models.OutcomeCrushingDefeat, Margin: 90},
+	}
+	verdict := aggregateVotes(votes, "majority")
+	if verdict.Outcome != models.OutcomeNarrowVictory || verdict.Decision != decisionSplit {
+		t.Fatalf("verdict = %s (%s), want a split narrow victory", verdict.Outcome, verdict.Decision)
+	}
+	if verdict.Margin != 15 {
+		t.Errorf("margin = %d, want 15 from the winning votes", verdict.Margin)
+	}
+
+	// 少数派不影响差距，获胜一方的差距超过压倒性档位时险胜仍保持在险胜档位内
+	votes = []models.JudgeVote{
+		{Outcome: models.OutcomeTotalVictory, Margin: 80},
+		{Outcome: models.OutcomeTotalVictory, Margin: 70},
+		{Outcome: models.OutcomeNarrowDefeat, Margin: 5},
+	}
+	verdict = aggregateVotes(votes, "majority")
+	if verdict.Outcome != models.OutcomeNarrowVictory || verdict.Margin != 49 {
+		t.Errorf("verdict = %s by %d, want NARROW_VICTORY by 49", verdict.Outcome, verdict.Margin)
+	}
+}
+
+func TestAggregateVotesMarginMatchesOutcome(t *testing.T) {
+	cases := []struct {
+		name    string
+		mode    string
+		votes   []models.JudgeVote
+		outcome models.BattleOutcome
+		margin  int
+	}{
+		{
+			name: "unanimous decisive",
+			mode: "majority",
+			votes: []models.JudgeVote{
+				{Outcome: models.OutcomeCrushingDefeat, Margin: 60},
+				{Outcome: models.OutcomeCrushingDefeat, Margin: 70},
+				{Outcome: models.OutcomeNarrowDefeat, Margin: 10},
+			},
+			outcome: models.OutcomeCrushingDefeat,
+			margin:  50,
+		},
+		{
+			name: "tie",
+			mode: "majority",
+			votes: []models.JudgeVote{
+				{Outcome: models.OutcomeTotalVictory, Margin: 90},
+				{Outcome: models.OutcomeNarrowDefeat, Margin: 10},
+			},
+			outcome: models.OutcomeDraw,
+			margin:  0,
+		},
+		{
+			name: "mean margin",
+			mode: "mean_margin",
+			votes: []models.JudgeVote{
+				{Outcome: models.OutcomeNarrowVictory, Margin: 30},
+				{Outcome: models.OutcomeNarrowVictory, Margin: 40},
+			},
+			outcome: models.OutcomeNarrowVictory,
+			margin:  35,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			verdict := aggregateVotes(tc.votes, tc.mode)
+			if verdict.Outcome != tc.outcome || verdict.Margin != tc.margin {
+				t.Errorf("verdict = %s by %d, want %s by %d", verdict.Outcome, verdict.Margin, tc.outcome, tc.margin)
+			}
+		})
+	}
+}
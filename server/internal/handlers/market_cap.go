@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/config"
+	"github.com/GabbyWorld/all-time-high-backend/internal/logger"
+	"github.com/GabbyWorld/all-time-high-backend/internal/models"
+	"github.com/GabbyWorld/all-time-high-backend/pkg/utils"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// MarketCapService 读取代币的链上供应量并定期计算 Agent 的 SOL/USD 市值
+type MarketCapService struct {
+	db       *gorm.DB
+	prices   *utils.PriceCache
+	supplies utils.SupplyProvider
+	Config   *config.Config
+}
+
+func NewMarketCapService(db *gorm.DB, prices *utils.PriceCache, supplies utils.SupplyProvider, config *config.Config) *MarketCapService {
+	return &MarketCapService{db: db, prices: prices, supplies: supplies, Config: config}
+}
+
+// Start 按 MARKET_CAP_REFRESH_INTERVAL 刷新所有 Agent 的市值
+func (s *MarketCapService) Start() {
+	go func() {
+		ticker := time.NewTicker(s.Config.Price.MarketCapInterval)
+		defer ticker.Stop()
+		for ; true; <-ticker.C {
+			var agents []models.Agent
+			if err := s.db.Where("token_address <> ''").Find(&agents).Error; err != nil {
+				logger.Logger.Error("Failed to fetch agents for market cap refresh", zap.Error(err))
+				continue
+			}
+			s.Refresh(context.Background(), agents)
+		}
+	}()
+}
+
+// Refresh 为供应量过期的 Agent 重新读取链上供应量，再按最新报价计算并写入市值。
+// 传入的 agents 会被就地更新；读取失败的 Agent 保留原有数据
+func (s *MarketCapService) Refresh(ctx context.Context, agents []models.Agent) {
+	now := time.Now()
+	for i := range agents {
+		agent := &agents[i]
+		if agent.TokenAddress == "" || (agent.SupplyUpdatedAt != nil && now.Sub(*agent.SupplyUpdatedAt) < s.Config.Price.SupplyTTL) {
+			continue
+		}
+		if err := s.refreshSupply(ctx, agent, now); err != nil {
+			logger.Logger.Warn("Failed to refresh token supply", zap.Uint("agentId", agent.ID), zap.String("tokenAddress", agent.TokenAddress), zap.Error(err))
+		}
+	}
+
+	mints := make([]string, 0, len(agents))
+	for _, agent := range agents {
+		if agent.TokenSupply > 0 {
+			mints = append(mints, agent.TokenAddress)
+		}
+	}
+	if len(mints) == 0 {
+		return
+	}
+	solQuotes := s.prices.Quotes(ctx, mints, utils.SOLMint)
+	usdQuotes := s.prices.Quotes(ctx, mints, "")
+
+	for i := range agents {
+		agent := &agents[i]
+		if agent.TokenSupply <= 0 {
+			continue
+		}
+		// 上游故障时的旧价格不写入，保留上一次的市值
+		updates := map[string]interface{}{}
+		if quote, ok := solQuotes[agent.TokenAddress]; ok && !quote.Stale {
+			agent.MarketCapSOL = quote.Price * agent.TokenSupply
+			updates["market_cap_sol"] = agent.MarketCapSOL
+		}
+		if quote, ok := usdQuotes[agent.TokenAddress]; ok && !quote.Stale {
+			agent.MarketCap = quote.Price * agent.TokenSupply
+			updates["market_cap"] = agent.MarketCap
+		}
+		if len(updates) == 0 {
+			continue
+		}
+		agent.MarketCapUpdatedAt = now
+		updates["market_cap_updated_at"] = now
+		if err := s.db.Model(&models.Agent{}).Where("id = ?", agent.ID).UpdateColumns(updates).Error; err != nil {
+			logger.Logger.Error("Failed to update agent market cap", zap.Uint("agentId", agent.ID), zap.Error(err))
+		}
+	}
+}
+
+func (s *MarketCapService) refreshSupply(ctx context.Context, agent *models.Agent, now time.Time) error {
+	supply, err := s.supplies.GetTokenSupply(ctx, agent.TokenAddress)
+	if err != nil {
+		return err
+	}
+	err = s.db.Model(&models.Agent{}).Where("id = ?", agent.ID).UpdateColumns(map[string]interface{}{
+		"token_supply":      supply.Amount,
+		"token_decimals":    supply.Decimals,
+		"supply_updated_at": now,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("save token supply: %w", err)
+	}
+	agent.TokenSupply = supply.Amount
+	agent.TokenDecimals = supply.Decimals
+	agent.SupplyUpdatedAt = &now
+	return nil
+}
+
+// liveMarketCap 用最新的 USD 报价和缓存的供应量计算市值；没有报价或供应量时返回后台任务最近一次写入的市值
+func liveMarketCap(agent models.Agent, quote utils.PriceQuote, ok bool) (float64, time.Time) {
+	if ok && quote.Price > 0 && agent.TokenSupply > 0 {
+		return quote.Price * agent.TokenSupply, quote.UpdatedAt
+	}
+	return agent.MarketCap, agent.MarketCapUpdatedAt
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/config"
+	"github.com/GabbyWorld/all-time-high-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// MatchResult 匹配结果，记录对手以及产生该配对的候选池
+type MatchResult struct {
+	Defender models.Agent
+	Pool     string
+	PoolSize int64
+}
+
+// Matchmaker 为攻击者挑选防御者，excluded 中的 Agent 不会被选中
+type Matchmaker interface {
+	Name() string
+	FindOpponent(db *gorm.DB, attacker models.Agent, excluded []uint) (*MatchResult, error)
+}
+
+// NewMatchmaker 根据配置创建匹配策略
+func NewMatchmaker(cfg config.BattleConfig) (Matchmaker, error) {
+	switch cfg.MatchmakingStrategy {
+	case "", "random":
+		return RandomMatchmaker{}, nil
+	case "rating_band":
+		return RatingBandMatchmaker{Band: cfg.RatingBand}, nil
+	case "market_cap_band":
+		return MarketCapBandMatchmaker{Ratio: cfg.MarketCapBand}, nil
+	case "avoid_rematch":
+		return AvoidRematchMatchmaker{Window: cfg.RematchWindow}, nil
+	default:
+		return nil, fmt.Errorf("unknown matchmaking strategy: %s", cfg.MatchmakingStrategy)
+	}
+}
+
+// activeOpponents 返回除攻击者和 excluded 外所有可参战的 Agent（已删除的由 gorm 自动排除，
+// 没有代币地址或从未获取到价格的视为不活跃）
+func activeOpponents(db *gorm.DB, attacker models.Agent, excluded []uint) *gorm.DB {
+	query := db.Model(&models.Agent{}).
+		Where("id <> ?", attacker.ID).
+		Where("token_address <> ''").
+		Where("previous_price > 0")
+	if len(excluded) > 0 {
+		query = query.Where("id NOT IN ?", excluded)
+	}
+	return query
+}
+
+// pickRandom 从候选池中随机挑选一个对手
+func pickRandom(query *gorm.DB, pool string) (*MatchResult, error) {
+	var size int64
+	if err := query.Session(&gorm.Session{}).Count(&size).Error; err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var defender models.Agent
+	if err := query.Session(&gorm.Session{}).Order("RANDOM()").First(&defender).Error; err != nil {
+		return nil, err
+	}
+	return &MatchResult{Defender: defender, Pool: pool, PoolSize: size}, nil
+}
+
+// pickWithFallback 先在限定候选池中挑选，为空时退回到全部活跃对手
+func pickWithFallback(db *gorm.DB, attacker models.Agent, excluded []uint, narrowed *gorm.DB, pool string) (*MatchResult, error) {
+	result, err := pickRandom(narrowed, pool)
+	if err == gorm.ErrRecordNotFound {
+		return pickRandom(activeOpponents(db, attacker, excluded), "fallback:all_active")
+	}
+	return result, err
+}
+
+// RandomMatchmaker 在所有活跃 Agent 中均匀随机匹配
+type RandomMatchmaker struct{}
+
+func (RandomMatchmaker) Name() string { return "random" }
+
+func (RandomMatchmaker) FindOpponent(db *gorm.DB, attacker models.Agent, excluded []uint) (*MatchResult, error) {
+	return pickRandom(activeOpponents(db, attacker, excluded), "all_active")
+}
+
+// RatingBandMatchmaker 匹配分数在 ±Band 之内的对手
+type RatingBandMatchmaker struct {
+	Band float64
+}
+
+func (RatingBandMatchmaker) Name() string { return "rating_band" }
+
+func (m RatingBandMatchmaker) FindOpponent(db *gorm.DB, attacker models.Agent, excluded []uint) (*MatchResult, error) {
+	low, high := attacker.Rating-m.Band, attacker.Rating+m.Band
+	narrowed := activeOpponents(db, attacker, excluded).Where("rating BETWEEN ? AND ?", low, high)
+	return pickWithFallback(db, attacker, excluded, narrowed, fmt.Sprintf("rating:%.0f-%.0f", low, high))
+}
+
+// MarketCapBandMatchmaker 匹配 SOL 市值在攻击者 1/Ratio 到 Ratio 倍之间的对手。
+// 市值由后台任务按链上供应量计算，攻击者尚无市值时随机匹配
+type MarketCapBandMatchmaker struct {
+	Ratio float64
+}
+
+func (MarketCapBandMatchmaker) Name() string { return "market_cap_band" }
+
+func (m MarketCapBandMatchmaker) FindOpponent(db *gorm.DB, attacker models.Agent, excluded []uint) (*MatchResult, error) {
+	if m.Ratio <= 1 || attacker.MarketCapSOL <= 0 {
+		return pickRandom(activeOpponents(db, attacker, excluded), "all_active")
+	}
+	low, high := attacker.MarketCapSOL/m.Ratio, attacker.MarketCapSOL*m.Ratio
+	narrowed := activeOpponents(db, attacker, excluded).Where("market_cap_sol BETWEEN ? AND ?", low, high)
+	return pickWithFallback(db, attacker, excluded, narrowed, fmt.Sprintf("market_cap:x%g", m.Ratio))
+}
+
+// AvoidRematchMatchmaker 排除在 Window 时间内已与攻击者交手过的对手（包括团队战中对方的所有成员），
+// 全部交手过时退回到全部活跃对手
+type AvoidRematchMatchmaker struct {
+	Window time.Duration
+}
+
+func (AvoidRematchMatchmaker) Name() string { return "avoid_rematch" }
+
+func (m AvoidRematchMatchmaker) FindOpponent(db *gorm.DB, attacker models.Agent, excluded []uint) (*MatchResult, error) {
+	since := time.Now().Add(-m.Window)
+	recent := db.Table("battle_participants AS me").
+		Select("opponent.agent_id").
+		Joins("JOIN battle_participants AS opponent ON opponent.battle_id = me.battle_id AND opponent.side <> me.side").
+		Joins("JOIN battles ON battles.id = me.battle_id").
+		Where("me.agent_id = ? AND battles.created_at >= ?", attacker.ID, since)
+	narrowed := activeOpponents(db, attacker, excluded).Where("id NOT IN (?)", recent)
+	return pickWithFallback(db, attacker, excluded, narrowed, fmt.Sprintf("no_rematch:%s", m.Window))
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/errors"
+	"github.com/GabbyWorld/all-time-high-backend/internal/logger"
+	"github.com/GabbyWorld/all-time-high-backend/internal/models"
+	"github.com/GabbyWorld/all-time-high-backend/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// MatchupRecord Agent 对阵某个对手的战绩（从该 Agent 的视角）。
+// 胜负按压倒性（Total Victory / Crushing Defeat）和险胜险负拆分，AvgMargin 以该 Agent 获胜为正
+type MatchupRecord struct {
+	OpponentID     uint      `json:"opponent_id"`
+	OpponentName   string    `json:"opponent_name"`
+	Total          int       `json:"total"`
+	Wins           int       `json:"wins"`
+	Losses         int       `json:"losses"`
+	Draws          int       `json:"draws"`
+	WinRate        float64   `json:"win_rate"`
+	DecisiveWins   int       `json:"decisive_wins"`
+	NarrowWins     int       `json:"narrow_wins"`
+	NarrowLosses   int       `json:"narrow_losses"`
+	DecisiveLosses int       `json:"decisive_losses"`
+	AvgMargin      float64   `json:"avg_margin"`
+	LastBattleAt   time.Time `json:"last_battle_at"`
+}
+
+// MatchupsResponse Agent 对每个对手的战绩
+type MatchupsResponse struct {
+	AgentID  uint            `json:"agent_id"`
+	Matchups []MatchupRecord `json:"matchups"`
+}
+
+// HeadToHeadResponse 两个 Agent 的交手战绩和战斗记录
+type HeadToHeadResponse struct {
+	AgentID    uint            `json:"agent_id"`
+	OpponentID uint            `json:"opponent_id"`
+	Record     MatchupRecord   `json:"record"`
+	Battles    []models.Battle `json:"battles"`
+	Total      int64           `json:"total"`
+	Page       int             `json:"page"`
+	PageSize   int             `json:"page_size"`
+}
+
+// matchupSQL 以 p 为本方、o 为对方参战者聚合战绩，团队战中对方每名成员都算作一次交手
+const matchupSQL = `
+	SELECT o.agent_id AS opponent_id, a.name AS opponent_name,
+		COUNT(*) AS total,
+		SUM(CASE WHEN (p.side = @attacker AND b.outcome IN @victories) OR (p.side = @defender AND b.outcome IN @defeats) THEN 1 ELSE 0 END) AS wins,
+		SUM(CASE WHEN (p.side = @attacker AND b.outcome IN @defeats) OR (p.side = @defender AND b.outcome IN @victories) THEN 1 ELSE 0 END) AS losses,
+		SUM(CASE WHEN b.outcome = @draw THEN 1 ELSE 0 END) AS draws,
+		SUM(CASE WHEN (p.side = @attacker AND b.outcome = @totalVictory) OR (p.side = @defender AND b.outcome = @crushingDefeat) THEN 1 ELSE 0 END) AS decisive_wins,
+		SUM(CASE WHEN (p.side = @attacker AND b.outcome = @narrowVictory) OR (p.side = @defender AND b.outcome = @narrowDefeat) THEN 1 ELSE 0 END) AS narrow_wins,
+		SUM(CASE WHEN (p.side = @attacker AND b.outcome = @narrowDefeat) OR (p.side = @defender AND b.outcome = @narrowVictory) THEN 1 ELSE 0 END) AS narrow_losses,
+		SUM(CASE WHEN (p.side = @attacker AND b.outcome = @crushingDefeat) OR (p.side = @defender AND b.outcome = @totalVictory) THEN 1 ELSE 0 END) AS decisive_losses,
+		AVG(CASE
+			WHEN (p.side = @attacker AND b.outcome IN @victories) OR (p.side = @defender AND b.outcome IN @defeats) THEN b.margin
+			WHEN (p.side = @attacker AND b.outcome IN @defeats) OR (p.side = @defender AND b.outcome IN @victories) THEN -b.margin
+			ELSE 0 END) AS avg_margin,
+		MAX(b.created_at) AS last_battle_at
+	FROM battle_participants p
+	JOIN battle_participants o ON o.battle_id = p.battle_id AND o.side <> p.side
+	JOIN battles b ON b.id = p.battle_id
+	JOIN agents a ON a.id = o.agent_id
+	WHERE p.agent_id = @agent %s
+	GROUP BY o.agent_id, a.name
+	ORDER BY total DESC, o.agent_id ASC`
+
+// matchupRecords 聚合 agentID 对各个对手的战绩，opponentID 不为空时只统计该对手
+func matchupRecords(db *gorm.DB, agentID uint, opponentID *uint) ([]MatchupRecord, error) {
+	args := map[string]interface{}{
+		"agent":          agentID,
+		"attacker":       models.SideAttacker,
+		"defender":       models.SideDefender,
+		"victories":      []models.BattleOutcome{models.OutcomeTotalVictory, models.OutcomeNarrowVictory},
+		"defeats":        []models.BattleOutcome{models.OutcomeNarrowDefeat, models.OutcomeCrushingDefeat},
+		"draw":           models.OutcomeDraw,
+		"totalVictory":   models.OutcomeTotalVictory,
+		"narrowVictory":  models.OutcomeNarrowVictory,
+		"narrowDefeat":   models.OutcomeNarrowDefeat,
+		"crushingDefeat": models.OutcomeCrushingDefeat,
+	}
+	filter := ""
+	if opponentID != nil {
+		filter = "AND o.agent_id = @opponent"
+		args["opponent"] = *opponentID
+	}
+
+	records := []MatchupRecord{}
+	if err := db.Raw(fmt.Sprintf(matchupSQL, filter), args).Scan(&records).Error; err != nil {
+		return nil, err
+	}
+	for i := range records {
+		if records[i].Total > 0 {
+			records[i].WinRate = float64(records[i].Wins) / float64(records[i].Total) * 100
+		}
+	}
+	return records, nil
+}
+
+// GetMatchups godoc
+// @Summary 获取 Agent 对各个对手的战绩
+// @Description 按交手次数降序返回 Agent 对每个对手的胜负平、压倒性与险胜的拆分以及平均差距，团队战中对方每名成员都计入
+// @Tags Agent
+// @Produce json
+// @Param id path int true "Agent ID"
+// @Success 200 {object} MatchupsResponse "成功返回对阵战绩"
+// @Failure 400 {object} errors.APIError "请求参数错误"
+// @Failure 404 {object} errors.APIError "Agent 不存在"
+// @Failure 500 {object} errors.APIError "服务器错误"
+// @Router /api/agents/{id}/matchups [get]
+func (s *BattleService) GetMatchups(c *gin.Context) {
+	agentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		apiErr := errors.NewAPIError(errors.ErrValidation, "Invalid agent ID", err.Error())
+		c.Error(apiErr)
+		return
+	}
+
+	key := strconv.FormatUint(agentID, 10)
+	if cached, ok := s.matchupCache.Get(key); ok {
+		c.JSON(http.StatusOK, cached)
+		return
+	}
+
+	if apiErr := s.ensureAgent(uint(agentID)); apiErr != nil {
+		c.Error(apiErr)
+		return
+	}
+
+	records, err := matchupRecords(s.db, uint(agentID), nil)
+	if err != nil {
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to retrieve matchups", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("GetMatchups: failed to retrieve matchups", zap.Error(err))
+		return
+	}
+
+	response := &MatchupsResponse{AgentID: uint(agentID), Matchups: records}
+	s.matchupCache.Set(key, response)
+	c.JSON(http.StatusOK, response)
+}
+
+// GetHeadToHead godoc
+// @Summary 获取两个 Agent 的交手记录
+// @Description 返回 Agent 对指定对手的战绩（从前者视角）以及双方在对立阵营中的全部战斗（分页，按时间倒序）
+// @Tags Agent
+// @Produce json
+// @Param id path int true "Agent ID"
+// @Param opponent_id path int true "对手 Agent ID"
+// @Param page query int false "页码(默认为1)"
+// @Param page_size query int false "每页大小(默认为4)"
+// @Success 200 {object} HeadToHeadResponse "成功返回交手记录"
+// @Failure 400 {object} errors.APIError "请求参数错误"
+// @Failure 404 {object} errors.APIError "Agent 不存在"
+// @Failure 500 {object} errors.APIError "服务器错误"
+// @Router /api/agents/{id}/vs/{opponent_id} [get]
+func (s *BattleService) GetHeadToHead(c *gin.Context) {
+	agentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		apiErr := errors.NewAPIError(errors.ErrValidation, "Invalid agent ID", err.Error())
+		c.Error(apiErr)
+		return
+	}
+	opponentID, err := strconv.ParseUint(c.Param("opponent_id"), 10, 64)
+	if err != nil {
+		apiErr := errors.NewAPIError(errors.ErrValidation, "Invalid opponent ID", err.Error())
+		c.Error(apiErr)
+		return
+	}
+	page, err := utils.ParsePage(c.Query("page"))
+	if err != nil {
+		page = 1
+	}
+	pageSize, err := utils.ParsePageSize(c.Query("page_size"))
+	if err != nil {
+		pageSize = utils.DefaultPageSize
+	}
+
+	key := fmt.Sprintf("%d:%d:%d:%d", agentID, opponentID, page, pageSize)
+	if cached, ok := s.headToHeadCache.Get(key); ok {
+		c.JSON(http.StatusOK, cached)
+		return
+	}
+
+	for _, id := range []uint64{agentID, opponentID} {
+		if apiErr := s.ensureAgent(uint(id)); apiErr != nil {
+			c.Error(apiErr)
+			return
+		}
+	}
+
+	opponent := uint(opponentID)
+	records, err := matchupRecords(s.db, uint(agentID), &opponent)
+	if err != nil {
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to retrieve head-to-head record", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("GetHeadToHead: failed to retrieve record", zap.Error(err))
+		return
+	}
+	record := MatchupRecord{OpponentID: opponent}
+	if len(records) > 0 {
+		record = records[0]
+	}
+
+	battleIDs := s.db.Table("battle_participants p").
+		Select("p.battle_id").
+		Joins("JOIN battle_participants o ON o.battle_id = p.battle_id AND o.side <> p.side").
+		Where("p.agent_id = ? AND o.agent_id = ?", agentID, opponentID)
+	battles := []models.Battle{}
+	if err := preloadBattle(s.db).
+		Where("id IN (?)", battleIDs).
+		Order("created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&battles).Error; err != nil {
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to retrieve head-to-head battles", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("GetHeadToHead: failed to retrieve battles", zap.Error(err))
+		return
+	}
+
+	response := &HeadToHeadResponse{
+		AgentID:    uint(agentID),
+		OpponentID: opponent,
+		Record:     record,
+		Battles:    battles,
+		Total:      int64(record.Total),
+		Page:       page,
+		PageSize:   pageSize,
+	}
+	s.headToHeadCache.Set(key, response)
+	c.JSON(http.StatusOK, response)
+}
+
+// ensureAgent 确认 Agent 存在
+func (s *BattleService) ensureAgent(agentID uint) *errors.APIError {
+	var count int64
+	if err := s.db.Model(&models.Agent{}).Where("id = ?", agentID).Count(&count).Error; err != nil {
+		return errors.NewAPIError(errors.ErrDatabase, "Failed to retrieve agent", err.Error())
+	}
+	if count == 0 {
+		return errors.NewAPIError(errors.ErrNotFound, "Agent not found", strconv.FormatUint(uint64(agentID), 10))
+	}
+	return nil
+}
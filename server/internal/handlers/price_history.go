@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/errors"
+	"github.com/GabbyWorld/all-time-high-backend/internal/logger"
+	"github.com/GabbyWorld/all-time-high-backend/internal/models"
+	"github.com/GabbyWorld/all-time-high-backend/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// candleIntervals K 线支持的周期及未指定 from 时默认返回的时间范围
+var candleIntervals = map[string]struct {
+	size   time.Duration
+	window time.Duration
+}{
+	"5m": {5 * time.Minute, 24 * time.Hour},
+	"1h": {time.Hour, 7 * 24 * time.Hour},
+	"1d": {24 * time.Hour, 180 * 24 * time.Hour},
+}
+
+// maxCandles 单次请求最多返回的 K 线数量
+const maxCandles = 1000
+
+// priceHistoryLockKey 合并原始快照使用的 Postgres advisory lock，多个实例同时维护时不会重复合并同一小时
+const priceHistoryLockKey int64 = 0x41544850 // "ATHP"
+
+// ohlcColumns 把一组快照聚合为 OHLC，原始采样与按小时合并的快照可以一起聚合
+const ohlcColumns = `
+	(array_agg(open_sol ORDER BY created_at ASC))[1] AS open_sol,
+	MAX(high_sol) AS high_sol,
+	MIN(low_sol) AS low_sol,
+	(array_agg(price_sol ORDER BY created_at DESC))[1] AS close_sol,
+	(array_agg(open_usd ORDER BY created_at ASC) FILTER (WHERE open_usd IS NOT NULL))[1] AS open_usd,
+	MAX(high_usd) AS high_usd,
+	MIN(low_usd) AS low_usd,
+	(array_agg(price_usd ORDER BY created_at DESC) FILTER (WHERE price_usd IS NOT NULL))[1] AS close_usd`
+
+// OHLC 一个周期内的开高低收价格
+type OHLC struct {
+	Open  float64 `json:"open"`
+	High  float64 `json:"high"`
+	Low   float64 `json:"low"`
+	Close float64 `json:"close"`
+}
+
+// Candle 一根 K 线，USD 价格缺失时 usd 为空
+type Candle struct {
+	Time time.Time `json:"time"` // 周期起点
+	SOL  OHLC      `json:"sol"`
+	USD  *OHLC     `json:"usd,omitempty"`
+}
+
+// CandlesResponse Agent 代币价格 K 线
+type CandlesResponse struct {
+	AgentID  uint      `json:"agent_id"`
+	Interval string    `json:"interval"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Candles  []Candle  `json:"candles"`
+}
+
+type candleRow struct {
+	Time     time.Time
+	OpenSOL  float64
+	HighSOL  float64
+	LowSOL   float64
+	CloseSOL float64
+	OpenUSD  *float64
+	HighUSD  *float64
+	LowUSD   *float64
+	CloseUSD *float64
+}
+
+// GetCandles godoc
+// @Summary 获取 Agent 代币价格 K 线
+// @Description 按周期聚合价格快照，返回 SOL 和 USD 计价的 OHLC。早于 PRICE_SNAPSHOT_RAW_RETENTION 的快照已按小时合并，
+// @Description 该范围内 5m 周期的 K 线为每小时一根
+// @Tags Agent
+// @Produce json
+// @Param id path int true "Agent ID"
+// @Param interval query string false "周期：5m, 1h, 1d" default(1h)
+// @Param from query string false "起始时间 (RFC3339)，默认按周期取最近一段时间"
+// @Param to query string false "结束时间 (RFC3339)，默认当前时间"
+// @Success 200 {object} CandlesResponse "成功返回 K 线"
+// @Failure 400 {object} errors.APIError "请求参数错误"
+// @Failure 404 {object} errors.APIError "未找到"
+// @Failure 500 {object} errors.APIError "服务器错误"
+// @Router /api/agents/{id}/candles [get]
+func (h *AgentHandler) GetCandles(c *gin.Context) {
+	agentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		apiErr := errors.NewAPIError(errors.ErrValidation, "Invalid agent ID", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("GetCandles: invalid agent ID", zap.Error(err))
+		return
+	}
+
+	interval := c.DefaultQuery("interval", "1h")
+	spec, ok := candleIntervals[interval]
+	if !ok {
+		c.Error(errors.NewAPIError(errors.ErrValidation, "Invalid interval", "interval must be one of 5m, 1h, 1d"))
+		return
+	}
+
+	to := time.Now()
+	if param := c.Query("to"); param != "" {
+		if to, err = time.Parse(time.RFC3339, param); err != nil {
+			c.Error(errors.NewAPIError(errors.ErrValidation, "Invalid to time", err.Error()))
+			return
+		}
+	}
+	from := to.Add(-spec.window)
+	if param := c.Query("from"); param != "" {
+		if from, err = time.Parse(time.RFC3339, param); err != nil {
+			c.Error(errors.NewAPIError(errors.ErrValidation, "Invalid from time", err.Error()))
+			return
+		}
+	}
+	if !from.Before(to) {
+		c.Error(errors.NewAPIError(errors.ErrValidation, "Invalid time range", "from must be before to"))
+		return
+	}
+	if to.Sub(from)/spec.size > maxCandles {
+		c.Error(errors.NewAPIError(errors.ErrValidation, "Time range too large", fmt.Sprintf("at most %d candles per request", maxCandles)))
+		return
+	}
+
+	var count int64
+	if err := h.DB.Model(&models.Agent{}).Where("id = ?", agentID).Count(&count).Error; err != nil {
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to retrieve agent", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("GetCandles: failed to retrieve agent", zap.Error(err))
+		return
+	}
+	if count == 0 {
+		c.Error(errors.NewAPIError(errors.ErrNotFound, "Agent not found", strconv.FormatUint(agentID, 10)))
+		return
+	}
+
+	var rows []candleRow
+	err = h.DB.Raw(`SELECT to_timestamp(floor(extract(epoch FROM created_at) / @seconds) * @seconds) AS time,`+ohlcColumns+`
+		FROM price_snapshots
+		WHERE agent_id = @agent AND created_at >= @from AND created_at < @to
+		GROUP BY 1
+		ORDER BY 1`,
+		map[string]interface{}{"seconds": int64(spec.size.Seconds()), "agent": agentID, "from": from, "to": to},
+	).Scan(&rows).Error
+	if err != nil {
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to retrieve price history", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("GetCandles: failed to aggregate price snapshots", zap.Error(err))
+		return
+	}
+
+	candles := make([]Candle, len(rows))
+	for i, row := range rows {
+		candles[i] = Candle{
+			Time: row.Time,
+			SOL:  OHLC{Open: row.OpenSOL, High: row.HighSOL, Low: row.LowSOL, Close: row.CloseSOL},
+		}
+		if row.OpenUSD != nil && row.HighUSD != nil && row.LowUSD != nil && row.CloseUSD != nil {
+			candles[i].USD = &OHLC{Open: *row.OpenUSD, High: *row.HighUSD, Low: *row.LowUSD, Close: *row.CloseUSD}
+		}
+	}
+
+	c.JSON(http.StatusOK, CandlesResponse{
+		AgentID:  uint(agentID),
+		Interval: interval,
+		From:     from,
+		To:       to,
+		Candles:  candles,
+	})
+}
+
+// recordPriceSnapshots 为本次采样到 SOL 价格的 Agent 写入价格快照，sources 记录每个价格来自哪个来源
+func (s *BattleService) recordPriceSnapshots(agents []models.Agent, solPrices, usdPrices map[string]float64, solSources, usdSources map[string]string) {
+	snapshots := make([]models.PriceSnapshot, 0, len(agents))
+	for _, agent := range agents {
+		price, ok := solPrices[agent.TokenAddress]
+		if !ok {
+			continue
+		}
+		snapshot := models.PriceSnapshot{
+			AgentID:   agent.ID,
+			OpenSOL:   price,
+			HighSOL:   price,
+			LowSOL:    price,
+			PriceSOL:  price,
+			SourceSOL: solSources[agent.TokenAddress],
+		}
+		if usd, ok := usdPrices[agent.TokenAddress]; ok {
+			snapshot.OpenUSD, snapshot.HighUSD, snapshot.LowUSD, snapshot.PriceUSD = &usd, &usd, &usd, &usd
+			snapshot.SourceUSD = usdSources[agent.TokenAddress]
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	if len(snapshots) == 0 {
+		return
+	}
+	if err := s.db.CreateInBatches(snapshots, 500).Error; err != nil {
+		logger.Logger.Error("Failed to record price snapshots", zap.Error(err))
+	}
+}
+
+// StartPriceHistoryMaintenance 每小时把超过 PRICE_SNAPSHOT_RAW_RETENTION 的原始快照按小时合并，
+// 并删除超过 PRICE_SNAPSHOT_RETENTION 的快照
+func (s *BattleService) StartPriceHistoryMaintenance() {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for ; true; <-ticker.C {
+			if err := s.maintainPriceHistory(time.Now()); err != nil {
+				logger.Logger.Error("Failed to maintain price history", zap.Error(err))
+			}
+		}
+	}()
+}
+
+func (s *BattleService) maintainPriceHistory(now time.Time) error {
+	cfg := s.Config.Price
+	if cfg.SnapshotRawRetention > 0 {
+		// 截止到整点，保证同一小时的原始采样一次合并完
+		cutoff := now.Add(-cfg.SnapshotRawRetention).Truncate(time.Hour)
+		var merged int64
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			// 拿到锁后再合并，先完成的实例已删除的原始快照不会再次合并
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", priceHistoryLockKey).Error; err != nil {
+				return fmt.Errorf("lock price history: %w", err)
+			}
+			result := tx.Exec(`INSERT INTO price_snapshots
+				(agent_id, resolution, open_sol, high_sol, low_sol, price_sol, open_usd, high_usd, low_usd, price_usd, created_at)
+				SELECT agent_id, @resolution,
+					open_sol, high_sol, low_sol, close_sol, open_usd, high_usd, low_usd, close_usd, bucket
+				FROM (
+					SELECT agent_id, date_trunc('hour', created_at) AS bucket,`+ohlcColumns+`
+					FROM price_snapshots
+					WHERE resolution = 0 AND created_at < @cutoff
+					GROUP BY agent_id, bucket
+				) merged`,
+				map[string]interface{}{"resolution": models.PriceResolutionHour, "cutoff": cutoff})
+			if result.Error != nil {
+				return fmt.Errorf("merge raw snapshots: %w", result.Error)
+			}
+			merged = result.RowsAffected
+			return tx.Where("resolution = 0 AND created_at < ?", cutoff).Delete(&models.PriceSnapshot{}).Error
+		})
+		if err != nil {
+			return err
+		}
+		if merged > 0 {
+			logger.Logger.Info("Downsampled price snapshots", zap.Int64("hourlyRows", merged), zap.Time("before", cutoff))
+		}
+	}
+
+	if cfg.SnapshotRetention > 0 {
+		if err := s.db.Where("created_at < ?", now.Add(-cfg.SnapshotRetention)).Delete(&models.PriceSnapshot{}).Error; err != nil {
+			return fmt.Errorf("delete expired snapshots: %w", err)
+		}
+	}
+	return nil
+}
+
+// PriceSourcesResponse 价格来源健康状况
+type PriceSourcesResponse struct {
+	Provider string               `json:"provider"`
+	Sources  []utils.SourceHealth `json:"sources"`
+}
+
+// ListPriceSources godoc
+// @Summary 获取价格来源健康状况
+// @Description 管理员查看组合价格来源中各来源的熔断状态、健康分数和最近错误（按优先级排列）；非组合价格来源时列表为空
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} PriceSourcesResponse "成功返回价格来源健康状况"
+// @Failure 401 {object} errors.APIError "未授权"
+// @Failure 403 {object} errors.APIError "无权限"
+// @Security BearerAuth
+// @Router /api/admin/price_sources [get]
+func (s *BattleService) ListPriceSources(c *gin.Context) {
+	sources := []utils.SourceHealth{}
+	if composite, ok := s.prices.(interface{ Health() []utils.SourceHealth }); ok {
+		sources = composite.Health()
+	}
+	c.JSON(http.StatusOK, PriceSourcesResponse{
+		Provider: s.Config.Price.Provider,
+		Sources:  sources,
+	})
+}
@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/errors"
+	"github.com/GabbyWorld/all-time-high-backend/internal/logger"
+	"github.com/GabbyWorld/all-time-high-backend/internal/models"
+	"github.com/GabbyWorld/all-time-high-backend/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// seasonLockKey 赛季切换使用的 Postgres advisory lock，多个实例同时切换时只有一个能执行
+const seasonLockKey int64 = 0x41544853 // "ATHS"
+
+// activeSeason 返回当前进行中的赛季，必要时先归档已结束的赛季并开启新赛季
+func activeSeason(db *gorm.DB, length time.Duration) (*models.Season, error) {
+	now := time.Now()
+	season, err := currentSeason(db, now)
+	if err != nil {
+		return nil, err
+	}
+	if season != nil {
+		var ended int64
+		if err := db.Model(&models.Season{}).Where("archived_at IS NULL AND ends_at <= ?", now).Count(&ended).Error; err != nil {
+			return nil, err
+		}
+		if ended == 0 {
+			return season, nil
+		}
+	}
+
+	// 需要切换时在事务中持有 advisory lock，拿到锁后重新检查，其他实例已完成的切换不会重复执行
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", seasonLockKey).Error; err != nil {
+			return fmt.Errorf("lock seasons: %w", err)
+		}
+		if err := rolloverSeasons(tx, length, now); err != nil {
+			return err
+		}
+		season, err = currentSeason(tx, now)
+		if err != nil || season != nil {
+			return err
+		}
+		// 还没有任何赛季，从现在开始第一个赛季
+		season, err = createSeason(tx, now, length)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return season, nil
+}
+
+// lockSeason 在 tx 中以共享模式持有赛季切换锁并返回 now 所在的未归档赛季，事务提交前该赛季不会被归档
+func lockSeason(tx *gorm.DB, now time.Time) (*models.Season, error) {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock_shared(?)", seasonLockKey).Error; err != nil {
+		return nil, fmt.Errorf("lock seasons: %w", err)
+	}
+	return currentSeason(tx, now)
+}
+
+// currentSeason 返回 now 所在的未归档赛季，没有时返回 nil
+func currentSeason(db *gorm.DB, now time.Time) (*models.Season, error) {
+	var season models.Season
+	result := db.Where("archived_at IS NULL AND starts_at <= ? AND ends_at > ?", now, now).
+		Order("starts_at DESC").
+		Limit(1).
+		Find(&season)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &season, nil
+}
+
+// rolloverSeasons 归档所有已结束的赛季，并紧接着开启下一个赛季
+func rolloverSeasons(db *gorm.DB, length time.Duration, now time.Time) error {
+	var ended []models.Season
+	if err := db.Where("archived_at IS NULL AND ends_at <= ?", now).
+		Order("ends_at ASC").
+		Find(&ended).Error; err != nil {
+		return err
+	}
+
+	for _, season := range ended {
+		if err := archiveSeason(db, season); err != nil {
+			return fmt.Errorf("archive season %d: %w", season.ID, err)
+		}
+		logger.Logger.Info("Season archived", zap.Uint("seasonId", season.ID), zap.String("name", season.Name))
+	}
+
+	if len(ended) == 0 {
+		return nil
+	}
+
+	// 服务停机跨过了整个赛季时，新赛季从现在开始
+	startsAt := ended[len(ended)-1].EndsAt
+	if !startsAt.Add(length).After(now) {
+		startsAt = now
+	}
+	_, err := createSeason(db, startsAt, length)
+	return err
+}
+
+func createSeason(db *gorm.DB, startsAt time.Time, length time.Duration) (*models.Season, error) {
+	var count int64
+	if err := db.Model(&models.Season{}).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	season := models.Season{
+		Name:     fmt.Sprintf("Season %d", count+1),
+		StartsAt: startsAt,
+		EndsAt:   startsAt.Add(length),
+	}
+	if err := db.Create(&season).Error; err != nil {
+		return nil, err
+	}
+	logger.Logger.Info("Season started", zap.Uint("seasonId", season.ID), zap.String("name", season.Name), zap.Time("endsAt", season.EndsAt))
+	return &season, nil
+}
+
+// archiveSeason 按排行榜规则写入最终排名并标记赛季已归档
+func archiveSeason(db *gorm.DB, season models.Season) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		// 只有把 archived_at 从空改为非空的一方写入最终排名
+		result := tx.Model(&models.Season{}).Where("id = ? AND archived_at IS NULL", season.ID).Update("archived_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		return tx.Exec(`
+			INSERT INTO season_standings (season_id, agent_id, rank, total, wins, losses, draws, win_rate, rating, created_at)
+			SELECT season_id, agent_id,
+				ROW_NUMBER() OVER (ORDER BY wins DESC, win_rate DESC, rating DESC, agent_id ASC),
+				total, wins, losses, draws, win_rate, rating, NOW()
+			FROM agent_season_stats
+			WHERE season_id = ?`, season.ID).Error
+	})
+}
+
+// resolveSeason 解析 season 参数："current" 表示当前赛季，否则为赛季 ID
+func resolveSeason(db *gorm.DB, length time.Duration, param string) (*models.Season, error) {
+	if param == "current" {
+		return activeSeason(db, length)
+	}
+	seasonID, err := strconv.ParseUint(param, 10, 64)
+	if err != nil {
+		return nil, errors.NewAPIError(errors.ErrValidation, "Invalid season", param)
+	}
+	var season models.Season
+	if err := db.First(&season, seasonID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewAPIError(errors.ErrNotFound, "Season not found", param)
+		}
+		return nil, err
+	}
+	return &season, nil
+}
+
+// StartSeasonRollover 定期检查赛季是否结束并完成归档与切换
+func (s *BattleService) StartSeasonRollover() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for ; true; <-ticker.C {
+			if _, err := activeSeason(s.db, s.Config.Battle.SeasonLength); err != nil {
+				logger.Logger.Error("Failed to roll over seasons", zap.Error(err))
+			}
+		}
+	}()
+}
+
+// updateSeasonStats 在 tx 中把一场战斗的结果计入每个参战者的赛季战绩，赛季分数与总分数使用相同的 Elo 规则。
+// 赛季战绩行与总战绩一样先加行锁，战绩列按增量更新
+func (s *BattleService) updateSeasonStats(tx *gorm.DB, battle *models.Battle, attackerScore float64) error {
+	if battle.SeasonID == nil {
+		return nil
+	}
+
+	initial := models.SeasonRecord{Rating: utils.DefaultRating}
+	rows := make([]models.AgentSeasonStats, len(battle.Participants))
+	ids := make([]uint, len(battle.Participants))
+	for i, participant := range battle.Participants {
+		rows[i] = models.AgentSeasonStats{SeasonID: *battle.SeasonID, AgentID: participant.AgentID, SeasonRecord: initial}
+		ids[i] = participant.AgentID
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error; err != nil {
+		return fmt.Errorf("create season stats: %w", err)
+	}
+
+	var locked []models.AgentSeasonStats
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("season_id = ? AND agent_id IN ?", *battle.SeasonID, ids).
+		Order("agent_id ASC").
+		Find(&locked).Error; err != nil {
+		return fmt.Errorf("lock season stats: %w", err)
+	}
+	byAgent := make(map[uint]*models.AgentSeasonStats, len(locked))
+	for i := range locked {
+		byAgent[locked[i].AgentID] = &locked[i]
+	}
+
+	var attackers, defenders []*models.AgentSeasonStats
+	for _, participant := range battle.Participants {
+		stats, ok := byAgent[participant.AgentID]
+		if !ok {
+			return fmt.Errorf("season stats of agent %d missing", participant.AgentID)
+		}
+		if participant.Side == models.SideAttacker {
+			attackers = append(attackers, stats)
+		} else {
+			defenders = append(defenders, stats)
+		}
+	}
+
+	// 团队战中每名成员按对方队伍的平均赛季分数计算
+	average := func(team []*models.AgentSeasonStats) float64 {
+		var sum float64
+		for _, stats := range team {
+			sum += stats.SeasonRecord.Rating
+		}
+		return sum / float64(len(team))
+	}
+	attackerAvg, defenderAvg := average(attackers), average(defenders)
+	for _, side := range []struct {
+		members     []*models.AgentSeasonStats
+		score       float64
+		opponentAvg float64
+	}{
+		{attackers, attackerScore, defenderAvg},
+		{defenders, 1 - attackerScore, attackerAvg},
+	} {
+		win, loss, draw := resultIncrements(side.score)
+		for _, stats := range side.members {
+			rating := stats.SeasonRecord.Rating + utils.EloDelta(stats.SeasonRecord.Rating, side.opponentAvg, side.score, battle.Outcome.Decisive())
+			if err := tx.Model(&models.AgentSeasonStats{}).Where("id = ?", stats.ID).Updates(map[string]interface{}{
+				"total":    gorm.Expr("total + 1"),
+				"wins":     gorm.Expr("wins + ?", win),
+				"losses":   gorm.Expr("losses + ?", loss),
+				"draws":    gorm.Expr("draws + ?", draw),
+				"win_rate": gorm.Expr("(wins + ?) * 100.0 / (total + 1)", win),
+				"rating":   rating,
+			}).Error; err != nil {
+				return fmt.Errorf("update season stats of agent %d: %w", stats.AgentID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// SeasonsResponse 赛季列表
+type SeasonsResponse struct {
+	Seasons []models.Season `json:"seasons"`
+}
+
+// GetSeasons godoc
+// @Summary 获取赛季列表
+// @Description 按开始时间倒序返回所有赛季，未归档的为当前赛季
+// @Tags Battle
+// @Produce json
+// @Success 200 {object} SeasonsResponse "成功返回赛季列表"
+// @Failure 500 {object} errors.APIError "服务器错误"
+// @Router /api/seasons [get]
+func (s *BattleService) GetSeasons(c *gin.Context) {
+	seasons := []models.Season{}
+	if err := s.db.Order("starts_at DESC").Find(&seasons).Error; err != nil {
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to retrieve seasons", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("GetSeasons: failed to retrieve seasons", zap.Error(err))
+		return
+	}
+	c.JSON(http.StatusOK, SeasonsResponse{Seasons: seasons})
+}
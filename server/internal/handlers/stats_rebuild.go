@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/errors"
+	"github.com/GabbyWorld/all-time-high-backend/internal/logger"
+	"github.com/GabbyWorld/all-time-high-backend/internal/models"
+	"github.com/GabbyWorld/all-time-high-backend/internal/stats"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 战绩重建任务的心跳：执行期间按 statsRebuildHeartbeat 刷新 updated_at，
+// 超过 statsRebuildStaleAfter 未刷新的 running 任务视为已中断，不再阻止新的重建
+const (
+	statsRebuildHeartbeat  = 30 * time.Second
+	statsRebuildStaleAfter = 3 * statsRebuildHeartbeat
+)
+
+// statsRebuildLockKey 领取战绩重建使用的 Postgres advisory lock，保证同一时间只有一个重建
+const statsRebuildLockKey int64 = 0x41544852 // "ATHR"
+
+// RebuildStats godoc
+// @Summary 重建 Agent 战绩
+// @Description 管理员在后台从战斗记录重放全部战斗，重新计算 Agent 的总战绩和 Elo 分数，并重写与重放结果不一致的分数历史，
+// @Description 与命令行 server stats rebuild 相同。立即返回任务，通过 GET /api/admin/stats/rebuild/{id} 查询进度和结果。
+// @Description 写回模式在执行期间锁定 Agent 行，战斗结算和价格更新会等待；dry_run 不加锁
+// @Tags Admin
+// @Produce json
+// @Param agent_id query int false "只写回该 Agent"
+// @Param dry_run query bool false "只计算差异，不写入"
+// @Success 202 {object} models.StatsRebuildJob "任务已开始"
+// @Failure 400 {object} errors.APIError "请求参数错误"
+// @Failure 404 {object} errors.APIError "Agent 不存在"
+// @Failure 409 {object} errors.APIError "已有重建正在执行"
+// @Failure 500 {object} errors.APIError "服务器错误"
+// @Security BearerAuth
+// @Router /api/admin/stats/rebuild [post]
+func (s *BattleService) RebuildStats(c *gin.Context) {
+	var opts stats.Options
+	if param := c.Query("agent_id"); param != "" {
+		agentID, err := strconv.ParseUint(param, 10, 64)
+		if err != nil {
+			apiErr := errors.NewAPIError(errors.ErrValidation, "Invalid agent_id", err.Error())
+			c.Error(apiErr)
+			return
+		}
+		id := uint(agentID)
+		opts.AgentID = &id
+
+		var count int64
+		if err := s.db.Model(&models.Agent{}).Where("id = ?", id).Count(&count).Error; err != nil {
+			apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to retrieve agent", err.Error())
+			c.Error(apiErr)
+			logger.Logger.Error("RebuildStats: failed to retrieve agent", zap.Error(err))
+			return
+		}
+		if count == 0 {
+			c.Error(errors.NewAPIError(errors.ErrNotFound, "Agent not found", param))
+			return
+		}
+	}
+	if param := c.Query("dry_run"); param != "" {
+		dryRun, err := strconv.ParseBool(param)
+		if err != nil {
+			apiErr := errors.NewAPIError(errors.ErrValidation, "Invalid dry_run", err.Error())
+			c.Error(apiErr)
+			return
+		}
+		opts.DryRun = dryRun
+	}
+
+	job := models.StatsRebuildJob{AgentID: opts.AgentID, DryRun: opts.DryRun, Status: models.StatsRebuildRunning}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", statsRebuildLockKey).Error; err != nil {
+			return err
+		}
+		var running int64
+		if err := tx.Model(&models.StatsRebuildJob{}).
+			Where("status = ? AND updated_at >= ?", models.StatsRebuildRunning, time.Now().Add(-statsRebuildStaleAfter)).
+			Count(&running).Error; err != nil {
+			return err
+		}
+		if running > 0 {
+			return errors.NewAPIError(errors.ErrConflict, "A stats rebuild is already running")
+		}
+		return tx.Create(&job).Error
+	})
+	if err != nil {
+		apiErr, ok := err.(*errors.APIError)
+		if !ok {
+			apiErr = errors.NewAPIError(errors.ErrDatabase, "Failed to start stats rebuild", err.Error())
+			logger.Logger.Error("RebuildStats: failed to start stats rebuild", zap.Error(err))
+		}
+		c.Error(apiErr)
+		return
+	}
+
+	go s.runStatsRebuild(job, opts)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// runStatsRebuild 执行战绩重建并把结果写回任务
+func (s *BattleService) runStatsRebuild(job models.StatsRebuildJob, opts stats.Options) {
+	done := make(chan struct{})
+	defer close(done)
+	jobID := job.ID
+	go func() {
+		ticker := time.NewTicker(statsRebuildHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := s.db.Model(&models.StatsRebuildJob{}).Where("id = ?", jobID).Update("updated_at", time.Now()).Error; err != nil {
+					logger.Logger.Warn("Failed to refresh stats rebuild heartbeat", zap.Uint("jobId", jobID), zap.Error(err))
+				}
+			}
+		}
+	}()
+
+	report, err := stats.Rebuild(s.db, opts)
+	now := time.Now()
+	job.FinishedAt = &now
+	if err != nil {
+		job.Status = models.StatsRebuildFailed
+		job.Error = err.Error()
+		logger.Logger.Error("Stats rebuild failed", zap.Uint("jobId", job.ID), zap.Error(err))
+	} else {
+		job.Status = models.StatsRebuildSucceeded
+		job.Battles = report.Battles
+		job.Agents = report.Agents
+		job.Changed = report.Changed
+		job.HistoryRewritten = report.HistoryRewritten
+		logger.Logger.Info("Stats rebuilt",
+			zap.Uint("jobId", job.ID),
+			zap.Bool("dryRun", report.DryRun),
+			zap.Int("battles", report.Battles),
+			zap.Int("changed", len(report.Changed)),
+			zap.Int("historyRewritten", report.HistoryRewritten),
+		)
+	}
+	if err := s.db.Model(&job).
+		Select("status", "error", "battles", "agents", "changed", "history_rewritten", "finished_at").
+		Updates(&job).Error; err != nil {
+		logger.Logger.Error("Failed to save stats rebuild result", zap.Uint("jobId", job.ID), zap.Error(err))
+	}
+	s.matchupCache.Purge()
+	s.headToHeadCache.Purge()
+}
+
+// GetStatsRebuild godoc
+// @Summary 查询战绩重建任务
+// @Description 返回战绩重建任务的状态；完成后包含重放的战斗数、战绩发生变化的 Agent 和重写分数历史的 Agent 数
+// @Tags Admin
+// @Produce json
+// @Param id path int true "任务 ID"
+// @Success 200 {object} models.StatsRebuildJob "任务状态"
+// @Failure 400 {object} errors.APIError "请求参数错误"
+// @Failure 404 {object} errors.APIError "未找到"
+// @Failure 500 {object} errors.APIError "服务器错误"
+// @Security BearerAuth
+// @Router /api/admin/stats/rebuild/{id} [get]
+func (s *BattleService) GetStatsRebuild(c *gin.Context) {
+	jobID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		apiErr := errors.NewAPIError(errors.ErrValidation, "Invalid job ID", err.Error())
+		c.Error(apiErr)
+		return
+	}
+
+	var job models.StatsRebuildJob
+	if err := s.db.First(&job, jobID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.NewAPIError(errors.ErrNotFound, "Stats rebuild not found"))
+			return
+		}
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to retrieve stats rebuild", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("GetStatsRebuild: failed to retrieve stats rebuild", zap.Error(err))
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/errors"
+	"github.com/GabbyWorld/all-time-high-backend/internal/logger"
+	"github.com/GabbyWorld/all-time-high-backend/internal/models"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 团队战每方的人数范围
+const (
+	minTeamSize = 2
+	maxTeamSize = 3
+)
+
+// TeamBattleRequest 发起团队战的请求，每方第一个 Agent 为队长
+type TeamBattleRequest struct {
+	AttackerIDs []uint `json:"attacker_ids" binding:"required"`
+	DefenderIDs []uint `json:"defender_ids" binding:"required"`
+}
+
+// validate 检查双方人数相同、在 2v2 到 3v3 之间，且没有 Agent 重复出场
+func (r TeamBattleRequest) validate() error {
+	if len(r.AttackerIDs) != len(r.DefenderIDs) {
+		return errors.NewAPIError(errors.ErrValidation, "Both teams must have the same number of agents")
+	}
+	if len(r.AttackerIDs) < minTeamSize || len(r.AttackerIDs) > maxTeamSize {
+		return errors.NewAPIError(errors.ErrValidation, "Invalid team size", fmt.Sprintf("teams must have %d to %d agents", minTeamSize, maxTeamSize))
+	}
+	seen := make(map[uint]bool, len(r.AttackerIDs)+len(r.DefenderIDs))
+	for _, id := range append(append([]uint{}, r.AttackerIDs...), r.DefenderIDs...) {
+		if seen[id] {
+			return errors.NewAPIError(errors.ErrValidation, "An agent can only appear once in a team battle", fmt.Sprintf("agent %d", id))
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// TeamBattle godoc
+// @Summary 发起团队战
+// @Description 用户以自己持有的 2 或 3 个 Agent 组队，挑战同样人数的一支临时队伍。团队战进入战斗任务队列，由裁判团判定，
+// @Description 每名参战者都会计入战绩，结果通过战斗 WebSocket 推送。攻击方队长受 BATTLE_CHALLENGE_COOLDOWN 限制
+// @Tags Battle
+// @Accept json
+// @Produce json
+// @Param team body TeamBattleRequest true "双方队伍"
+// @Success 202 {object} models.BattleJob "团队战已排队"
+// @Failure 400 {object} errors.APIError "请求参数错误或对手不可参战"
+// @Failure 403 {object} errors.APIError "攻击方存在不属于当前用户的 Agent"
+// @Failure 404 {object} errors.APIError "Agent 不存在"
+// @Failure 429 {object} errors.APIError "冷却中或受公平性规则限制"
+// @Failure 500 {object} errors.APIError "服务器错误"
+// @Security BearerAuth
+// @Router /api/battle/team [post]
+func (s *BattleService) TeamBattle(c *gin.Context) {
+	var req TeamBattleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiErr := errors.NewAPIError(errors.ErrValidation, "Request validation failed", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("TeamBattle: validation failed", zap.Error(err))
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.Error(err)
+		return
+	}
+
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		apiErr := errors.NewAPIError(errors.ErrUnauthorized, "User ID not found in context")
+		c.Error(apiErr)
+		logger.Logger.Error("TeamBattle: userID not found in context")
+		return
+	}
+	userID, ok := userIDInterface.(uint)
+	if !ok {
+		apiErr := errors.NewAPIError(errors.ErrInternal, "Invalid user ID format")
+		c.Error(apiErr)
+		logger.Logger.Error("TeamBattle: userID format incorrect", zap.Any("userID", userIDInterface))
+		return
+	}
+
+	var job models.BattleJob
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// 锁住攻击方队伍，保证并发请求下冷却检查和入队是原子的
+		attackers, err := loadTeam(tx.Clauses(clause.Locking{Strength: "UPDATE"}), req.AttackerIDs)
+		if err != nil {
+			return err
+		}
+		for _, attacker := range attackers {
+			if attacker.UserID != userID {
+				return errors.NewAPIError(errors.ErrForbidden, "Only agents you own can form the attacking team", fmt.Sprintf("agent %d", attacker.ID))
+			}
+		}
+
+		defenders, err := loadTeam(tx, req.DefenderIDs)
+		if err != nil {
+			return err
+		}
+		var available int64
+		if err := activeOpponents(tx, attackers[0], req.AttackerIDs).Where("id IN ?", req.DefenderIDs).Count(&available).Error; err != nil {
+			return err
+		}
+		if available != int64(len(defenders)) {
+			return errors.NewAPIError(errors.ErrValidation, "Some defending agents are not available for battles")
+		}
+
+		if wait, err := s.challengeCooldownRemaining(tx, attackers[0].ID); err != nil {
+			return err
+		} else if wait > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			return errors.NewAPIError(errors.ErrRateLimited, "Team captain is on challenge cooldown", fmt.Sprintf("retry after %s", wait.Round(time.Second)))
+		}
+
+		// 团队战同样受公平性规则约束，提前拒绝而不是排队后取消
+		skip, _, err := s.checkTeams(attackers, defenders)
+		if err != nil {
+			return err
+		}
+		if skip != nil {
+			return errors.NewAPIError(errors.ErrRateLimited, "Team battle blocked by battle fairness rules", skip.Error())
+		}
+
+		job = models.BattleJob{
+			AttackerID:  attackers[0].ID,
+			DefenderID:  &defenders[0].ID,
+			AttackerIDs: req.AttackerIDs,
+			DefenderIDs: req.DefenderIDs,
+			Type:        models.BattleTypeTeam,
+			Status:      models.BattleJobPending,
+			MaxAttempts: s.Config.Battle.JobMaxAttempts,
+			NextRunAt:   time.Now(),
+		}
+		return tx.Create(&job).Error
+	})
+	if err != nil {
+		apiErr, ok := err.(*errors.APIError)
+		if !ok {
+			apiErr = errors.NewAPIError(errors.ErrDatabase, "Failed to create team battle", err.Error())
+			logger.Logger.Error("TeamBattle: failed to create team battle", zap.Error(err))
+		}
+		c.Error(apiErr)
+		return
+	}
+
+	logger.Logger.Info("Team battle queued",
+		zap.Uint("jobId", job.ID),
+		zap.Uints("attackers", job.AttackerIDs),
+		zap.Uints("defenders", job.DefenderIDs),
+	)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// loadTeam 按给定顺序加载队伍成员，任一 Agent 不存在时返回 404
+func loadTeam(db *gorm.DB, ids []uint) ([]models.Agent, error) {
+	var agents []models.Agent
+	if err := db.Where("id IN ?", ids).Find(&agents).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.Agent, len(agents))
+	for _, agent := range agents {
+		byID[agent.ID] = agent
+	}
+
+	team := make([]models.Agent, len(ids))
+	for i, id := range ids {
+		agent, ok := byID[id]
+		if !ok {
+			return nil, errors.NewAPIError(errors.ErrNotFound, "Agent not found", fmt.Sprintf("agent %d", id))
+		}
+		team[i] = agent
+	}
+	return team, nil
+}
+
+// checkTeams 对攻击方每名成员检查攻击限制，对防御方每名成员检查能否作为攻击方队长的对手。
+// 返回第一条命中的规则及被跳过的 Agent
+func (s *BattleService) checkTeams(attackers, defenders []models.Agent) (*battleSkipError, uint, error) {
+	for _, attacker := range attackers {
+		skip, err := s.checkAttacker(s.db, attacker.ID, false)
+		if err != nil || skip != nil {
+			return skip, attacker.ID, err
+		}
+	}
+	ineligible, err := s.ineligibleDefenders(attackers[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, defender := range defenders {
+		if skip := ineligible[defender.ID]; skip != nil {
+			return skip, defender.ID, nil
+		}
+	}
+	return nil, 0, nil
+}
+
+// executeTeamBattleJob 加载任务中的双方队伍，再次检查公平性规则后执行团队战
+func (s *BattleService) executeTeamBattleJob(job *models.BattleJob) (*models.Battle, error) {
+	attackers, err := loadTeam(s.db, job.AttackerIDs)
+	if err != nil {
+		return nil, fmt.Errorf("load attacking team: %w", err)
+	}
+	defenders, err := loadTeam(s.db, job.DefenderIDs)
+	if err != nil {
+		return nil, fmt.Errorf("load defending team: %w", err)
+	}
+
+	// 排队期间成员可能已参加其他战斗
+	skip, agentID, err := s.checkTeams(attackers, defenders)
+	if err != nil {
+		return nil, fmt.Errorf("check team fairness: %w", err)
+	}
+	if skip != nil {
+		if containsAgent(attackers, agentID) {
+			s.recordAttackerSkip(agentID, job.Type, skip)
+		} else {
+			s.recordDefenderSkips(attackers[0].ID, job.Type, map[uint]*battleSkipError{agentID: skip})
+		}
+		return nil, skip
+	}
+
+	return s.runTeamBattle(attackers, defenders, models.Battle{
+		MatchStrategy:     "team",
+		CandidatePool:     "team",
+		CandidatePoolSize: int64(len(defenders)),
+		Type:              job.Type,
+	}, battleRun{job: job, attach: completeJob(job)})
+}
+
+func containsAgent(team []models.Agent, agentID uint) bool {
+	for _, agent := range team {
+		if agent.ID == agentID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,654 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/errors"
+	"github.com/GabbyWorld/all-time-high-backend/internal/logger"
+	"github.com/GabbyWorld/all-time-high-backend/internal/models"
+	"github.com/GabbyWorld/all-time-high-backend/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// startTournament 按 Elo 分数排种子、计算轮数并生成第一轮对阵
+func (s *BattleService) startTournament(tournamentID uint) (*models.Tournament, error) {
+	var tournament models.Tournament
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&tournament, tournamentID).Error; err != nil {
+			return err
+		}
+		if tournament.Status != models.TournamentRegistration {
+			return errors.NewAPIError(errors.ErrConflict, "Tournament has already started", string(tournament.Status))
+		}
+
+		var entries []models.TournamentEntry
+		if err := tx.Joins("Agent").
+			Where("tournament_entries.tournament_id = ?", tournament.ID).
+			Order(`"Agent".rating DESC, tournament_entries.created_at ASC`).
+			Find(&entries).Error; err != nil {
+			return err
+		}
+		if len(entries) < 2 {
+			return errors.NewAPIError(errors.ErrValidation, "A tournament needs at least 2 registered agents")
+		}
+		for i := range entries {
+			entries[i].Seed = i + 1
+			if err := tx.Model(&entries[i]).Update("seed", entries[i].Seed).Error; err != nil {
+				return err
+			}
+		}
+
+		var matches []models.TournamentMatch
+		switch tournament.Format {
+		case models.TournamentSingleElimination:
+			tournament.Rounds = eliminationRounds(len(entries))
+			matches = firstEliminationRound(entries)
+		case models.TournamentSwiss:
+			if tournament.Rounds <= 0 {
+				tournament.Rounds = eliminationRounds(len(entries))
+			}
+			matches = swissPairings(entries, nil, 1)
+		}
+		if err := s.createRoundMatches(tx, &tournament, matches); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		tournament.Status = models.TournamentInProgress
+		tournament.CurrentRound = 1
+		tournament.StartedAt = &now
+		return tx.Save(&tournament).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Logger.Info("Tournament started",
+		zap.Uint("tournamentId", tournament.ID),
+		zap.String("format", string(tournament.Format)),
+		zap.Int("rounds", tournament.Rounds),
+	)
+	return &tournament, nil
+}
+
+// createRoundMatches 写入一轮对阵，轮空直接判定晋级（瑞士轮记 1 分）
+func (s *BattleService) createRoundMatches(tx *gorm.DB, tournament *models.Tournament, matches []models.TournamentMatch) error {
+	for i := range matches {
+		matches[i].TournamentID = tournament.ID
+		matches[i].Status = models.TournamentMatchPending
+		if !matches[i].IsBye() {
+			continue
+		}
+
+		winner := matches[i].AttackerID
+		matches[i].Status = models.TournamentMatchCompleted
+		matches[i].WinnerID = &winner
+		if tournament.Format == models.TournamentSwiss {
+			if err := tx.Model(&models.TournamentEntry{}).
+				Where("tournament_id = ? AND agent_id = ?", tournament.ID, winner).
+				Updates(map[string]interface{}{
+					"points":  gorm.Expr("points + 1"),
+					"had_bye": true,
+				}).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Create(&matches).Error
+}
+
+// errTournamentMatchPlayed 对阵已由其他执行记录结果，本次战斗回滚
+var errTournamentMatchPlayed = fmt.Errorf("tournament match has already been played")
+
+// claimTournamentRound 在数据库中领取锦标赛当前轮的执行权，已被其他执行领取且未超过租约时间时返回 false
+func (s *BattleService) claimTournamentRound(tournamentID uint) (bool, error) {
+	now := time.Now()
+	result := s.db.Model(&models.Tournament{}).
+		Where("id = ? AND status = ?", tournamentID, models.TournamentInProgress).
+		Where("round_claimed_at IS NULL OR round_claimed_at < ?", now.Add(-s.Config.Battle.JobLeaseTimeout)).
+		Update("round_claimed_at", now)
+	return result.RowsAffected > 0, result.Error
+}
+
+// runTournamentRound 依次执行当前轮中未完成的对阵，全部完成后推进到下一轮或结束锦标赛。
+// 单场失败时保留为 pending，管理员可以再次执行该轮
+func (s *BattleService) runTournamentRound(tournamentID uint) {
+	claimed, err := s.claimTournamentRound(tournamentID)
+	if err != nil {
+		logger.Logger.Error("Failed to claim tournament round", zap.Uint("tournamentId", tournamentID), zap.Error(err))
+		return
+	}
+	if !claimed {
+		logger.Logger.Info("Tournament round is already running", zap.Uint("tournamentId", tournamentID))
+		return
+	}
+	defer func() {
+		if err := s.db.Model(&models.Tournament{}).Where("id = ?", tournamentID).Update("round_claimed_at", nil).Error; err != nil {
+			logger.Logger.Error("Failed to release tournament round", zap.Uint("tournamentId", tournamentID), zap.Error(err))
+		}
+	}()
+
+	var tournament models.Tournament
+	if err := s.db.First(&tournament, tournamentID).Error; err != nil {
+		logger.Logger.Error("Failed to load tournament", zap.Uint("tournamentId", tournamentID), zap.Error(err))
+		return
+	}
+	round := tournament.CurrentRound
+
+	var pending []models.TournamentMatch
+	if err := s.db.Where("tournament_id = ? AND round = ? AND status = ?", tournament.ID, round, models.TournamentMatchPending).
+		Order("slot ASC").
+		Find(&pending).Error; err != nil {
+		logger.Logger.Error("Failed to load tournament matches", zap.Uint("tournamentId", tournament.ID), zap.Error(err))
+		return
+	}
+
+	for i := range pending {
+		if err := s.playTournamentMatch(&tournament, &pending[i]); err != nil {
+			logger.Logger.Error("Tournament match failed",
+				zap.Uint("tournamentId", tournament.ID),
+				zap.Uint("matchId", pending[i].ID),
+				zap.Error(err),
+			)
+		}
+		// 每场结束后续租，长的轮次不会被其他实例当作中断
+		if err := s.db.Model(&models.Tournament{}).Where("id = ?", tournament.ID).Update("round_claimed_at", time.Now()).Error; err != nil {
+			logger.Logger.Warn("Failed to renew tournament round claim", zap.Uint("tournamentId", tournament.ID), zap.Error(err))
+		}
+	}
+
+	var matches []models.TournamentMatch
+	if err := s.db.Where("tournament_id = ? AND round = ?", tournament.ID, round).
+		Order("slot ASC").
+		Find(&matches).Error; err != nil {
+		logger.Logger.Error("Failed to load tournament matches", zap.Uint("tournamentId", tournament.ID), zap.Error(err))
+		return
+	}
+	for _, match := range matches {
+		if match.Status != models.TournamentMatchCompleted {
+			logger.Logger.Warn("Tournament round incomplete", zap.Uint("tournamentId", tournament.ID), zap.Int("round", round))
+			s.wsHandler.BroadcastTournamentRound(tournament, round, matches)
+			return
+		}
+	}
+
+	if err := s.advanceTournament(&tournament, matches); err != nil {
+		logger.Logger.Error("Failed to advance tournament", zap.Uint("tournamentId", tournament.ID), zap.Error(err))
+	}
+	s.wsHandler.BroadcastTournamentRound(tournament, round, matches)
+}
+
+// playTournamentMatch 通过裁判团执行一场对阵，胜者和报名成绩与战斗记录在同一事务中写入。
+// 对阵由赛程决定，不检查攻击冷却、防御冷却和每小时上限等公平性规则
+func (s *BattleService) playTournamentMatch(tournament *models.Tournament, match *models.TournamentMatch) error {
+	var attacker, defender models.Agent
+	if err := s.db.First(&attacker, match.AttackerID).Error; err != nil {
+		return fmt.Errorf("load attacker: %w", err)
+	}
+	if err := s.db.First(&defender, *match.DefenderID).Error; err != nil {
+		return fmt.Errorf("load defender: %w", err)
+	}
+
+	round := match.Round
+	_, err := s.runBattle(attacker, defender, models.Battle{
+		MatchStrategy:   "tournament",
+		CandidatePool:   fmt.Sprintf("tournament:%d:round:%d", tournament.ID, round),
+		Type:            models.BattleTypeTournament,
+		TournamentID:    &tournament.ID,
+		TournamentRound: &round,
+	}, battleRun{attach: func(tx *gorm.DB, battle *models.Battle) error {
+		return s.recordTournamentMatch(tx, tournament, match, battle)
+	}})
+	return err
+}
+
+// recordTournamentMatch 在 tx 中锁定对阵并记录胜者和双方成绩，对阵已有结果时返回 errTournamentMatchPlayed
+func (s *BattleService) recordTournamentMatch(tx *gorm.DB, tournament *models.Tournament, match *models.TournamentMatch, battle *models.Battle) error {
+	var current models.TournamentMatch
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, match.ID).Error; err != nil {
+		return err
+	}
+	if current.Status != models.TournamentMatchPending {
+		return errTournamentMatchPlayed
+	}
+
+	attackerID, defenderID := match.AttackerID, *match.DefenderID
+	var entries []models.TournamentEntry
+	if err := tx.Where("tournament_id = ? AND agent_id IN ?", tournament.ID, []uint{attackerID, defenderID}).
+		Find(&entries).Error; err != nil {
+		return err
+	}
+	seeds := make(map[uint]int, len(entries))
+	for _, entry := range entries {
+		seeds[entry.AgentID] = entry.Seed
+	}
+
+	var winner, loser *uint
+	switch {
+	case battle.Outcome.AttackerWon():
+		winner, loser = &attackerID, &defenderID
+	case battle.Outcome.DefenderWon():
+		winner, loser = &defenderID, &attackerID
+	case tournament.Format == models.TournamentSingleElimination:
+		// 淘汰赛打平时高种子晋级
+		winner, loser = &attackerID, &defenderID
+		if seeds[defenderID] < seeds[attackerID] {
+			winner, loser = &defenderID, &attackerID
+		}
+	}
+
+	match.Status = models.TournamentMatchCompleted
+	match.BattleID = &battle.ID
+	match.WinnerID = winner
+	if err := tx.Save(match).Error; err != nil {
+		return err
+	}
+
+	if battle.Outcome == models.OutcomeDraw {
+		if err := tx.Model(&models.TournamentEntry{}).
+			Where("tournament_id = ? AND agent_id IN ?", tournament.ID, []uint{attackerID, defenderID}).
+			Updates(map[string]interface{}{
+				"draws":  gorm.Expr("draws + 1"),
+				"points": gorm.Expr("points + 0.5"),
+			}).Error; err != nil {
+			return err
+		}
+	} else {
+		if err := tx.Model(&models.TournamentEntry{}).
+			Where("tournament_id = ? AND agent_id = ?", tournament.ID, *winner).
+			Updates(map[string]interface{}{
+				"wins":   gorm.Expr("wins + 1"),
+				"points": gorm.Expr("points + 1"),
+			}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.TournamentEntry{}).
+			Where("tournament_id = ? AND agent_id = ?", tournament.ID, *loser).
+			Update("losses", gorm.Expr("losses + 1")).Error; err != nil {
+			return err
+		}
+	}
+
+	if tournament.Format == models.TournamentSingleElimination {
+		return tx.Model(&models.TournamentEntry{}).
+			Where("tournament_id = ? AND agent_id = ?", tournament.ID, *loser).
+			Update("eliminated", true).Error
+	}
+	return nil
+}
+
+// advanceTournament 在一轮全部完成后生成下一轮对阵，最后一轮结束时确定冠军
+func (s *BattleService) advanceTournament(tournament *models.Tournament, matches []models.TournamentMatch) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		// 锁定锦标赛后确认仍处于这一轮，避免同一轮被推进两次
+		var current models.Tournament
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, tournament.ID).Error; err != nil {
+			return err
+		}
+		if current.Status != models.TournamentInProgress || current.CurrentRound != tournament.CurrentRound {
+			return nil
+		}
+
+		var entries []models.TournamentEntry
+		if err := tx.Where("tournament_id = ?", tournament.ID).Order("seed ASC").Find(&entries).Error; err != nil {
+			return err
+		}
+
+		if tournament.CurrentRound >= tournament.Rounds {
+			var winner uint
+			switch tournament.Format {
+			case models.TournamentSingleElimination:
+				winner = *matches[0].WinnerID
+			case models.TournamentSwiss:
+				winner = swissStandings(entries)[0].AgentID
+			}
+			now := time.Now()
+			tournament.Status = models.TournamentCompleted
+			tournament.WinnerID = &winner
+			tournament.CompletedAt = &now
+			logger.Logger.Info("Tournament completed", zap.Uint("tournamentId", tournament.ID), zap.Uint("winner", winner))
+			return tx.Save(tournament).Error
+		}
+
+		next := tournament.CurrentRound + 1
+		var pairings []models.TournamentMatch
+		switch tournament.Format {
+		case models.TournamentSingleElimination:
+			pairings = nextEliminationRound(matches, next)
+		case models.TournamentSwiss:
+			var previous []models.TournamentMatch
+			if err := tx.Where("tournament_id = ? AND defender_id IS NOT NULL", tournament.ID).Find(&previous).Error; err != nil {
+				return err
+			}
+			played := make(map[[2]uint]bool, len(previous))
+			for _, match := range previous {
+				played[pairKey(match.AttackerID, *match.DefenderID)] = true
+			}
+			pairings = swissPairings(entries, played, next)
+		}
+		if err := s.createRoundMatches(tx, tournament, pairings); err != nil {
+			return err
+		}
+
+		tournament.CurrentRound = next
+		return tx.Save(tournament).Error
+	})
+}
+
+// loadTournament 解析路径参数中的锦标赛 ID 并加载锦标赛，失败时写入错误
+func (s *BattleService) loadTournament(c *gin.Context, action string) (*models.Tournament, bool) {
+	tournamentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		apiErr := errors.NewAPIError(errors.ErrValidation, "Invalid tournament ID", err.Error())
+		c.Error(apiErr)
+		return nil, false
+	}
+
+	var tournament models.Tournament
+	if err := s.db.First(&tournament, tournamentID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apiErr := errors.NewAPIError(errors.ErrNotFound, "Tournament not found")
+			c.Error(apiErr)
+			return nil, false
+		}
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to retrieve tournament", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error(action+": failed to retrieve tournament", zap.Error(err))
+		return nil, false
+	}
+	return &tournament, true
+}
+
+// CreateTournamentRequest 创建锦标赛的请求
+type CreateTournamentRequest struct {
+	Name   string                  `json:"name" binding:"required,max=100"`
+	Format models.TournamentFormat `json:"format" binding:"required,oneof=single_elimination swiss"`
+	// Rounds 瑞士轮的轮数，不填时按人数计算；单败淘汰赛忽略
+	Rounds int `json:"rounds" binding:"min=0,max=20"`
+}
+
+// CreateTournament godoc
+// @Summary 创建锦标赛
+// @Description 管理员创建单败淘汰赛或瑞士轮锦标赛，创建后进入报名阶段
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param tournament body CreateTournamentRequest true "锦标赛信息"
+// @Success 201 {object} models.Tournament "创建成功"
+// @Failure 400 {object} errors.APIError "请求参数错误"
+// @Failure 500 {object} errors.APIError "服务器错误"
+// @Security BearerAuth
+// @Router /api/admin/tournaments [post]
+func (s *BattleService) CreateTournament(c *gin.Context) {
+	var req CreateTournamentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiErr := errors.NewAPIError(errors.ErrValidation, "Request validation failed", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("CreateTournament: validation failed", zap.Error(err))
+		return
+	}
+
+	tournament := models.Tournament{
+		Name:   req.Name,
+		Format: req.Format,
+		Status: models.TournamentRegistration,
+		Rounds: req.Rounds,
+	}
+	if err := s.db.Create(&tournament).Error; err != nil {
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to create tournament", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("CreateTournament: failed to create tournament", zap.Error(err))
+		return
+	}
+
+	logger.Logger.Info("Tournament created", zap.Uint("tournamentId", tournament.ID), zap.String("format", string(tournament.Format)))
+	c.JSON(http.StatusCreated, tournament)
+}
+
+// RegisterTournamentRequest 报名锦标赛的请求
+type RegisterTournamentRequest struct {
+	AgentID uint `json:"agent_id" binding:"required"`
+}
+
+// RegisterTournamentAgent godoc
+// @Summary 报名锦标赛
+// @Description Agent 的所有者在报名阶段为自己的 Agent 报名
+// @Tags Tournament
+// @Accept json
+// @Produce json
+// @Param id path int true "锦标赛 ID"
+// @Param entry body RegisterTournamentRequest true "报名的 Agent"
+// @Success 201 {object} models.TournamentEntry "报名成功"
+// @Failure 400 {object} errors.APIError "请求参数错误"
+// @Failure 403 {object} errors.APIError "不是 Agent 的所有者"
+// @Failure 404 {object} errors.APIError "未找到"
+// @Failure 409 {object} errors.APIError "已报名或报名已结束"
+// @Failure 500 {object} errors.APIError "服务器错误"
+// @Security BearerAuth
+// @Router /api/tournaments/{id}/entries [post]
+func (s *BattleService) RegisterTournamentAgent(c *gin.Context) {
+	var req RegisterTournamentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiErr := errors.NewAPIError(errors.ErrValidation, "Request validation failed", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("RegisterTournamentAgent: validation failed", zap.Error(err))
+		return
+	}
+
+	tournament, ok := s.loadTournament(c, "RegisterTournamentAgent")
+	if !ok {
+		return
+	}
+	if tournament.Status != models.TournamentRegistration {
+		apiErr := errors.NewAPIError(errors.ErrConflict, "Tournament registration is closed", string(tournament.Status))
+		c.Error(apiErr)
+		return
+	}
+
+	var agent models.Agent
+	if err := s.db.First(&agent, req.AgentID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apiErr := errors.NewAPIError(errors.ErrNotFound, "Agent not found")
+			c.Error(apiErr)
+			return
+		}
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to retrieve agent", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("RegisterTournamentAgent: failed to retrieve agent", zap.Error(err))
+		return
+	}
+	if userID, ok := c.Get("userID"); !ok || userID.(uint) != agent.UserID {
+		apiErr := errors.NewAPIError(errors.ErrForbidden, "Only the agent owner can register it")
+		c.Error(apiErr)
+		return
+	}
+
+	entry := models.TournamentEntry{TournamentID: tournament.ID, AgentID: agent.ID}
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&entry)
+	if result.Error != nil {
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to register agent", result.Error.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("RegisterTournamentAgent: failed to register agent", zap.Error(result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		apiErr := errors.NewAPIError(errors.ErrConflict, "Agent is already registered")
+		c.Error(apiErr)
+		return
+	}
+
+	entry.Agent = agent
+	logger.Logger.Info("Agent registered for tournament", zap.Uint("tournamentId", tournament.ID), zap.Uint("agentId", agent.ID))
+	c.JSON(http.StatusCreated, entry)
+}
+
+// StartTournament godoc
+// @Summary 开始锦标赛
+// @Description 管理员结束报名，按 Elo 分数排种子并生成第一轮对阵
+// @Tags Admin
+// @Produce json
+// @Param id path int true "锦标赛 ID"
+// @Success 200 {object} models.Tournament "锦标赛已开始"
+// @Failure 400 {object} errors.APIError "报名人数不足"
+// @Failure 404 {object} errors.APIError "未找到"
+// @Failure 409 {object} errors.APIError "锦标赛已开始"
+// @Failure 500 {object} errors.APIError "服务器错误"
+// @Security BearerAuth
+// @Router /api/admin/tournaments/{id}/start [post]
+func (s *BattleService) StartTournament(c *gin.Context) {
+	tournament, ok := s.loadTournament(c, "StartTournament")
+	if !ok {
+		return
+	}
+
+	started, err := s.startTournament(tournament.ID)
+	if err != nil {
+		apiErr, ok := err.(*errors.APIError)
+		if !ok {
+			apiErr = errors.NewAPIError(errors.ErrDatabase, "Failed to start tournament", err.Error())
+			logger.Logger.Error("StartTournament: failed to start tournament", zap.Error(err))
+		}
+		c.Error(apiErr)
+		return
+	}
+	c.JSON(http.StatusOK, started)
+}
+
+// RunTournamentRound godoc
+// @Summary 执行锦标赛当前轮
+// @Description 管理员在后台执行当前轮的所有对阵，完成后自动生成下一轮；结果通过战斗 WebSocket 以 TOURNAMENT_ROUND 推送
+// @Tags Admin
+// @Produce json
+// @Param id path int true "锦标赛 ID"
+// @Success 202 {object} models.Tournament "已开始执行"
+// @Failure 404 {object} errors.APIError "未找到"
+// @Failure 409 {object} errors.APIError "锦标赛不在进行中或本轮正在执行"
+// @Failure 500 {object} errors.APIError "服务器错误"
+// @Security BearerAuth
+// @Router /api/admin/tournaments/{id}/run_round [post]
+func (s *BattleService) RunTournamentRound(c *gin.Context) {
+	tournament, ok := s.loadTournament(c, "RunTournamentRound")
+	if !ok {
+		return
+	}
+	if tournament.Status != models.TournamentInProgress {
+		apiErr := errors.NewAPIError(errors.ErrConflict, "Tournament is not in progress", string(tournament.Status))
+		c.Error(apiErr)
+		return
+	}
+	if tournament.RoundClaimedAt != nil && time.Since(*tournament.RoundClaimedAt) < s.Config.Battle.JobLeaseTimeout {
+		apiErr := errors.NewAPIError(errors.ErrConflict, "Tournament round is already running")
+		c.Error(apiErr)
+		return
+	}
+
+	go s.runTournamentRound(tournament.ID)
+	c.JSON(http.StatusAccepted, tournament)
+}
+
+// TournamentsResponse 锦标赛列表
+type TournamentsResponse struct {
+	Tournaments []models.Tournament `json:"tournaments"`
+	Total       int64               `json:"total"`
+	Page        int                 `json:"page"`
+	PageSize    int                 `json:"page_size"`
+}
+
+// GetTournaments godoc
+// @Summary 获取锦标赛列表
+// @Description 按创建时间倒序分页返回锦标赛
+// @Tags Tournament
+// @Produce json
+// @Param status query string false "状态: registration, in_progress, completed"
+// @Param page query int false "页码(默认为1)"
+// @Param page_size query int false "每页大小(默认为4)"
+// @Success 200 {object} TournamentsResponse "成功返回锦标赛列表"
+// @Failure 500 {object} errors.APIError "服务器错误"
+// @Router /api/tournaments [get]
+func (s *BattleService) GetTournaments(c *gin.Context) {
+	page, err := utils.ParsePage(c.Query("page"))
+	if err != nil {
+		page = 1
+	}
+	pageSize, err := utils.ParsePageSize(c.Query("page_size"))
+	if err != nil {
+		pageSize = utils.DefaultPageSize
+	}
+
+	query := s.db.Model(&models.Tournament{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to count tournaments", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("GetTournaments: failed to count tournaments", zap.Error(err))
+		return
+	}
+
+	tournaments := []models.Tournament{}
+	if err := query.Order("created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&tournaments).Error; err != nil {
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to retrieve tournaments", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("GetTournaments: failed to retrieve tournaments", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, TournamentsResponse{
+		Tournaments: tournaments,
+		Total:       total,
+		Page:        page,
+		PageSize:    pageSize,
+	})
+}
+
+// GetTournament godoc
+// @Summary 获取锦标赛详情
+// @Description 返回锦标赛的报名列表（按种子或瑞士轮积分排序）和全部对阵
+// @Tags Tournament
+// @Produce json
+// @Param id path int true "锦标赛 ID"
+// @Success 200 {object} models.Tournament "成功返回锦标赛"
+// @Failure 404 {object} errors.APIError "未找到"
+// @Failure 500 {object} errors.APIError "服务器错误"
+// @Router /api/tournaments/{id} [get]
+func (s *BattleService) GetTournament(c *gin.Context) {
+	tournament, ok := s.loadTournament(c, "GetTournament")
+	if !ok {
+		return
+	}
+
+	if err := s.db.Preload("Agent").Where("tournament_id = ?", tournament.ID).
+		Order("seed ASC, created_at ASC").
+		Find(&tournament.Entries).Error; err != nil {
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to retrieve tournament entries", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("GetTournament: failed to retrieve entries", zap.Error(err))
+		return
+	}
+	if tournament.Format == models.TournamentSwiss {
+		tournament.Entries = swissStandings(tournament.Entries)
+	}
+
+	if err := s.db.Where("tournament_id = ?", tournament.ID).
+		Order("round ASC, slot ASC").
+		Find(&tournament.Matches).Error; err != nil {
+		apiErr := errors.NewAPIError(errors.ErrDatabase, "Failed to retrieve tournament matches", err.Error())
+		c.Error(apiErr)
+		logger.Logger.Error("GetTournament: failed to retrieve matches", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, tournament)
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"math/bits"
+	"sort"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/models"
+)
+
+// eliminationRounds 单败淘汰赛 n 名选手需要的轮数
+func eliminationRounds(n int) int {
+	if n < 2 {
+		return 0
+	}
+	return bits.Len(uint(n - 1))
+}
+
+// bracketOrder 返回 size（2 的幂）人签表中各位置的种子号，
+// 保证 1、2 号种子只会在决赛相遇，前 2^k 号种子在倒数第 k 轮之前不会相遇
+func bracketOrder(size int) []int {
+	order := []int{1}
+	for len(order) < size {
+		next := make([]int, 0, len(order)*2)
+		for _, seed := range order {
+			next = append(next, seed, len(order)*2+1-seed)
+		}
+		order = next
+	}
+	return order
+}
+
+// firstEliminationRound 生成单败淘汰赛第一轮对阵，entries 按种子排序。
+// 人数不足 2 的幂时，高种子轮空直接晋级
+func firstEliminationRound(entries []models.TournamentEntry) []models.TournamentMatch {
+	size := 1 << eliminationRounds(len(entries))
+	order := bracketOrder(size)
+
+	var matches []models.TournamentMatch
+	for slot := 0; slot < size/2; slot++ {
+		high, low := order[slot*2], order[slot*2+1]
+		if high > low {
+			high, low = low, high
+		}
+		match := models.TournamentMatch{Round: 1, Slot: slot, AttackerID: entries[high-1].AgentID}
+		if low <= len(entries) {
+			match.DefenderID = &entries[low-1].AgentID
+		}
+		matches = append(matches, match)
+	}
+	return matches
+}
+
+// nextEliminationRound 由上一轮的胜者生成下一轮对阵，相邻两场的胜者相遇
+func nextEliminationRound(previous []models.TournamentMatch, round int) []models.TournamentMatch {
+	sort.Slice(previous, func(i, j int) bool { return previous[i].Slot < previous[j].Slot })
+
+	var matches []models.TournamentMatch
+	for i := 0; i+1 < len(previous); i += 2 {
+		defender := *previous[i+1].WinnerID
+		matches = append(matches, models.TournamentMatch{
+			Round:      round,
+			Slot:       i / 2,
+			AttackerID: *previous[i].WinnerID,
+			DefenderID: &defender,
+		})
+	}
+	return matches
+}
+
+// swissStandings 按积分、种子排序的瑞士轮排名
+func swissStandings(entries []models.TournamentEntry) []models.TournamentEntry {
+	standings := append([]models.TournamentEntry(nil), entries...)
+	sort.SliceStable(standings, func(i, j int) bool {
+		if standings[i].Points != standings[j].Points {
+			return standings[i].Points > standings[j].Points
+		}
+		return standings[i].Seed < standings[j].Seed
+	})
+	return standings
+}
+
+// swissPairings 生成瑞士轮对阵：积分相近的选手相遇，尽量避免重复交手。
+// 人数为奇数时排名最低且未轮空过的选手轮空
+func swissPairings(entries []models.TournamentEntry, played map[[2]uint]bool, round int) []models.TournamentMatch {
+	standings := swissStandings(entries)
+
+	var matches []models.TournamentMatch
+	if len(standings)%2 == 1 {
+		bye := len(standings) - 1
+		for i := len(standings) - 1; i >= 0; i-- {
+			if !standings[i].HadBye {
+				bye = i
+				break
+			}
+		}
+		matches = append(matches, models.TournamentMatch{Round: round, AttackerID: standings[bye].AgentID})
+		standings = append(standings[:bye], standings[bye+1:]...)
+	}
+
+	paired := make([]bool, len(standings))
+	for i := range standings {
+		if paired[i] {
+			continue
+		}
+		opponent := -1
+		for j := i + 1; j < len(standings); j++ {
+			if paired[j] {
+				continue
+			}
+			if opponent < 0 {
+				opponent = j
+			}
+			if !played[pairKey(standings[i].AgentID, standings[j].AgentID)] {
+				opponent = j
+				break
+			}
+		}
+		paired[i], paired[opponent] = true, true
+		defender := standings[opponent].AgentID
+		matches = append(matches, models.TournamentMatch{Round: round, AttackerID: standings[i].AgentID, DefenderID: &defender})
+	}
+
+	for i := range matches {
+		matches[i].Slot = i
+	}
+	return matches
+}
+
+// pairKey 两个 Agent 的无序配对键
+func pairKey(a, b uint) [2]uint {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]uint{a, b}
+}
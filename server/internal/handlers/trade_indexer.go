@@ -0,0 +1,488 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/config"
+	"github.com/GabbyWorld/all-time-high-backend/internal/logger"
+	"github.com/GabbyWorld/all-time-high-backend/internal/models"
+	"github.com/GabbyWorld/all-time-high-backend/pkg/utils"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxIndexerBackoff 重连等待时间的上限
+const maxIndexerBackoff = time.Minute
+
+// TradeIndexer 通过 websocket logsSubscribe 为每个尚未毕业的 Agent 代币订阅交易日志，把 pump.fun 成交写入 trades 表，
+// 并把成交后的价格直接交给战斗触发逻辑。每次（重新）连接后用 getSignaturesForAddress 补齐断线期间的成交，
+// 没有补完的区间在之后每次同步订阅时继续
+type TradeIndexer struct {
+	db      *gorm.DB
+	reader  *utils.BondingCurveReader
+	battles *BattleService
+	Config  *config.Config
+
+	mu sync.Mutex
+	// live 当前连接已订阅的代币，连接断开时清空
+	live map[string]bool
+	// backfilling 正在补齐的代币，补齐结束时关闭对应的 channel
+	backfilling map[string]chan struct{}
+}
+
+func NewTradeIndexer(db *gorm.DB, reader *utils.BondingCurveReader, battles *BattleService, config *config.Config) *TradeIndexer {
+	return &TradeIndexer{
+		db:          db,
+		reader:      reader,
+		battles:     battles,
+		Config:      config,
+		live:        make(map[string]bool),
+		backfilling: make(map[string]chan struct{}),
+	}
+}
+
+// Indexed 代币的价格当前是否由实时订阅提供，连接断开期间所有代币都返回 false
+func (x *TradeIndexer) Indexed(mint string) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.live[mint]
+}
+
+func (x *TradeIndexer) setLive(mint string, live bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if live {
+		x.live[mint] = true
+	} else {
+		delete(x.live, mint)
+	}
+}
+
+func (x *TradeIndexer) clearLive() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	clear(x.live)
+}
+
+// claimBackfill 登记正在补齐的代币，保证同一代币同一时间只有一个 goroutine 推进补齐区间。
+// 已有其他 goroutine 在补齐时，wait 为 false 直接返回 false，为 true 则等它结束后再登记，ctx 取消时返回 false
+func (x *TradeIndexer) claimBackfill(ctx context.Context, mint string, wait bool) bool {
+	for {
+		x.mu.Lock()
+		done, busy := x.backfilling[mint]
+		if !busy {
+			x.backfilling[mint] = make(chan struct{})
+		}
+		x.mu.Unlock()
+		if !busy {
+			return true
+		}
+		if !wait {
+			return false
+		}
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+func (x *TradeIndexer) releaseBackfill(mint string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	close(x.backfilling[mint])
+	delete(x.backfilling, mint)
+}
+
+// tradeLog 某个代币订阅收到的一条交易日志
+type tradeLog struct {
+	mint   string
+	result *ws.LogResult
+}
+
+// mintSubscription 单个代币的订阅，cancel 用于主动取消时区分连接断开
+type mintSubscription struct {
+	sub    *ws.LogSubscription
+	cancel context.CancelFunc
+}
+
+// Start 在后台运行索引器，连接断开后按指数退避重连
+func (x *TradeIndexer) Start() {
+	go func() {
+		delay := x.Config.Indexer.ReconnectDelay
+		for {
+			connectedAt := time.Now()
+			err := x.run(context.Background())
+			// 连接稳定运行过一段时间后断开，重新从最短等待时间开始
+			if time.Since(connectedAt) > maxIndexerBackoff {
+				delay = x.Config.Indexer.ReconnectDelay
+			}
+			logger.Logger.Warn("Trade indexer disconnected, reconnecting", zap.Duration("delay", delay), zap.Error(err))
+			time.Sleep(delay)
+			delay = min(delay*2, maxIndexerBackoff)
+		}
+	}()
+}
+
+// run 建立一次 websocket 连接并处理订阅，直到连接断开
+func (x *TradeIndexer) run(parent context.Context) error {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	client, err := ws.Connect(ctx, x.Config.Solana.WSRPCEndpoint)
+	if err != nil {
+		return fmt.Errorf("connect websocket: %w", err)
+	}
+	defer client.Close()
+	// 断开后这些代币重新由价格轮询负责
+	defer x.clearLive()
+
+	// 先订阅新建的 Agent，避免加载列表期间创建的 Agent 被遗漏
+	created := GlobalBroadcaster.Subscribe()
+	defer GlobalBroadcaster.Unsubscribe(created)
+
+	logs := make(chan tradeLog, 256)
+	errs := make(chan error, 1)
+	agents := make(map[string]models.Agent)
+	subs := make(map[string]*mintSubscription)
+	lastPrices := make(map[string]float64)
+
+	subscribe := func(agent models.Agent) error {
+		if _, ok := subs[agent.TokenAddress]; ok {
+			return nil
+		}
+		mintKey, err := solana.PublicKeyFromBase58(agent.TokenAddress)
+		if err != nil {
+			logger.Logger.Warn("Trade indexer: skipping invalid token address", zap.Uint("agentId", agent.ID), zap.String("tokenAddress", agent.TokenAddress))
+			subs[agent.TokenAddress] = &mintSubscription{cancel: func() {}}
+			return nil
+		}
+		sub, err := client.LogsSubscribeMentions(mintKey, rpc.CommitmentConfirmed)
+		if err != nil {
+			return fmt.Errorf("subscribe to %s: %w", agent.TokenAddress, err)
+		}
+		subCtx, subCancel := context.WithCancel(ctx)
+		subs[agent.TokenAddress] = &mintSubscription{sub: sub, cancel: subCancel}
+		x.setLive(agent.TokenAddress, true)
+		go func(mint string) {
+			for {
+				result, err := sub.Recv(subCtx)
+				if subCtx.Err() != nil {
+					return
+				}
+				if err != nil || result == nil {
+					if err == nil {
+						err = fmt.Errorf("subscription to %s closed", mint)
+					}
+					select {
+					case errs <- err:
+					default:
+					}
+					return
+				}
+				select {
+				case logs <- tradeLog{mint: mint, result: result}:
+				case <-subCtx.Done():
+					return
+				}
+			}
+		}(agent.TokenAddress)
+		return nil
+	}
+
+	// sync 按数据库中尚未毕业的 Agent 增减订阅，返回新增订阅的 Agent 及每个代币订阅前最后一笔已索引成交的签名
+	sync := func() ([]models.Agent, map[string]string, error) {
+		var current []models.Agent
+		if err := x.db.Where("token_address <> '' AND graduated = ?", false).Find(&current).Error; err != nil {
+			return nil, nil, fmt.Errorf("load agents: %w", err)
+		}
+		wanted := make(map[string]bool, len(current))
+		var added []models.Agent
+		heads := make(map[string]string)
+		for _, agent := range current {
+			wanted[agent.TokenAddress] = true
+			agents[agent.TokenAddress] = agent
+			if _, ok := subs[agent.TokenAddress]; ok {
+				continue
+			}
+			// 在订阅前读取，订阅后实时写入的成交不会成为补齐区间的下界
+			head, err := x.lastIndexedSignature(agent.TokenAddress)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := subscribe(agent); err != nil {
+				return nil, nil, err
+			}
+			heads[agent.TokenAddress] = head
+			added = append(added, agent)
+		}
+		// 已毕业的代币不再在联合曲线上成交，取消订阅
+		for mint, s := range subs {
+			if wanted[mint] {
+				continue
+			}
+			s.cancel()
+			if s.sub != nil {
+				s.sub.Unsubscribe()
+			}
+			x.setLive(mint, false)
+			delete(subs, mint)
+			delete(agents, mint)
+			delete(lastPrices, mint)
+		}
+		return added, heads, nil
+	}
+
+	added, heads, err := sync()
+	if err != nil {
+		return err
+	}
+	logger.Logger.Info("Trade indexer connected", zap.Int("subscriptions", len(subs)))
+	// 订阅建立后再补齐，两者之间没有空档；重复的成交由唯一索引去重
+	go x.backfill(ctx, added, heads)
+
+	var resuming atomic.Bool
+	ticker := time.NewTicker(x.Config.Indexer.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-errs:
+			return err
+		case entry := <-logs:
+			agent, ok := agents[entry.mint]
+			if !ok {
+				continue
+			}
+			price, ok := x.handleLog(agent, entry.result)
+			if !ok || price == lastPrices[entry.mint] {
+				continue
+			}
+			lastPrices[entry.mint] = price
+			x.battles.handlePriceUpdate(agent, price)
+		case agent, ok := <-created:
+			if !ok || agent.TokenAddress == "" {
+				continue
+			}
+			agents[agent.TokenAddress] = agent
+			if _, ok := subs[agent.TokenAddress]; ok {
+				continue
+			}
+			head, err := x.lastIndexedSignature(agent.TokenAddress)
+			if err != nil {
+				return err
+			}
+			if err := subscribe(agent); err != nil {
+				return err
+			}
+			// 创建代币时的首笔买入可能早于订阅
+			go x.backfill(ctx, []models.Agent{agent}, map[string]string{agent.TokenAddress: head})
+		case <-ticker.C:
+			added, heads, err := sync()
+			if err != nil {
+				return err
+			}
+			if len(added) > 0 {
+				go x.backfill(ctx, added, heads)
+			}
+			// 上次没有补完的代币继续补齐，同一时间只有一轮续补在执行；正在补齐的代币由 claimBackfill 跳过
+			if !resuming.Load() {
+				pending, err := x.pendingBackfills(agents)
+				if err != nil {
+					logger.Logger.Warn("Failed to load pending trade backfills", zap.Error(err))
+				} else if len(pending) > 0 {
+					resuming.Store(true)
+					go func() {
+						defer resuming.Store(false)
+						x.backfill(ctx, pending, nil)
+					}()
+				}
+			}
+		}
+	}
+}
+
+// pendingBackfills 返回已订阅且还有未补完区间的 Agent
+func (x *TradeIndexer) pendingBackfills(agents map[string]models.Agent) ([]models.Agent, error) {
+	var mints []string
+	if err := x.db.Model(&models.TradeBackfillCursor{}).Distinct("mint").Pluck("mint", &mints).Error; err != nil {
+		return nil, err
+	}
+	var pending []models.Agent
+	for _, mint := range mints {
+		if agent, ok := agents[mint]; ok {
+			pending = append(pending, agent)
+		}
+	}
+	return pending, nil
+}
+
+// lastIndexedSignature 返回代币最后一笔已索引成交的签名，还没有成交时为空
+func (x *TradeIndexer) lastIndexedSignature(mint string) (string, error) {
+	var last models.Trade
+	if err := x.db.Select("signature").Where("mint = ?", mint).Order("slot DESC").Limit(1).Find(&last).Error; err != nil {
+		return "", fmt.Errorf("load last trade of %s: %w", mint, err)
+	}
+	return last.Signature, nil
+}
+
+// handleLog 记录一条交易日志中属于该代币的成交，返回最后一笔新成交后的价格
+func (x *TradeIndexer) handleLog(agent models.Agent, result *ws.LogResult) (float64, bool) {
+	if result.Value.Err != nil {
+		return 0, false
+	}
+	events := utils.ParseTradeEvents(result.Value.Logs)
+	inserted, err := x.recordTrades(agent, result.Value.Signature.String(), result.Context.Slot, events)
+	if err != nil {
+		logger.Logger.Error("Failed to record trades", zap.Uint("agentId", agent.ID), zap.String("signature", result.Value.Signature.String()), zap.Error(err))
+		return 0, false
+	}
+	if len(inserted) == 0 {
+		return 0, false
+	}
+	return inserted[len(inserted)-1].PriceSOL, true
+}
+
+// recordTrades 写入一笔交易中属于 agent 代币的成交，已存在的成交跳过，返回本次新写入的成交
+func (x *TradeIndexer) recordTrades(agent models.Agent, signature string, slot uint64, events []utils.TradeEvent) ([]models.Trade, error) {
+	var inserted []models.Trade
+	for i, event := range events {
+		if event.Mint.String() != agent.TokenAddress {
+			continue
+		}
+		// EventIndex 为事件在整笔交易中的序号，实时订阅和补齐得到的序号一致
+		trade := models.Trade{
+			AgentID:              agent.ID,
+			Mint:                 agent.TokenAddress,
+			Signature:            signature,
+			EventIndex:           i,
+			Slot:                 slot,
+			Trader:               event.User.String(),
+			IsBuy:                event.IsBuy,
+			SOLAmount:            event.SOLAmount,
+			TokenAmount:          event.TokenAmount,
+			PriceSOL:             event.PriceSOL(),
+			VirtualSOLReserves:   event.VirtualSOLReserves,
+			VirtualTokenReserves: event.VirtualTokenReserves,
+			BlockTime:            event.Time(),
+		}
+		result := x.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&trade)
+		if result.Error != nil {
+			return inserted, result.Error
+		}
+		if result.RowsAffected > 0 {
+			inserted = append(inserted, trade)
+		}
+	}
+	return inserted, nil
+}
+
+// backfill 依次补齐每个代币的成交，每个代币每次最多读取 TRADE_BACKFILL_LIMIT 笔交易，
+// 没有补完的区间记录在 trade_backfill_cursors 中，下次从断点继续。补齐的是历史成交，不触发战斗。
+// heads 为新订阅的代币在订阅前最后一笔已索引成交的签名，这些代币先以它为下界开一个从最新交易开始的区间，
+// 正在补齐时等待其结束；其余代币只继续已有的区间，正在补齐时跳过，留给下一轮续补
+func (x *TradeIndexer) backfill(ctx context.Context, agents []models.Agent, heads map[string]string) {
+	if x.Config.Indexer.BackfillLimit <= 0 {
+		return
+	}
+	for _, agent := range agents {
+		if ctx.Err() != nil {
+			return
+		}
+		head, opening := heads[agent.TokenAddress]
+		if !x.claimBackfill(ctx, agent.TokenAddress, opening) {
+			continue
+		}
+		count, err := x.backfillAgent(ctx, agent, head, opening)
+		x.releaseBackfill(agent.TokenAddress)
+		if err != nil {
+			logger.Logger.Warn("Failed to backfill trades", zap.Uint("agentId", agent.ID), zap.String("tokenAddress", agent.TokenAddress), zap.Int("recorded", count), zap.Error(err))
+			continue
+		}
+		if count > 0 {
+			logger.Logger.Info("Backfilled trades", zap.Uint("agentId", agent.ID), zap.Int("count", count))
+		}
+	}
+}
+
+// backfillAgent 在 opening 时为最新的交易开一个补齐区间（下界为订阅前最后一笔已索引的成交 head），再从新到旧依次推进该代币的所有区间，
+// 直到用完 TRADE_BACKFILL_LIMIT。区间只在一段交易全部写入后才推进，失败时下次重读这一段，重复的成交由唯一索引去重
+func (x *TradeIndexer) backfillAgent(ctx context.Context, agent models.Agent, head string, opening bool) (int, error) {
+	if opening {
+		cursor := models.TradeBackfillCursor{AgentID: agent.ID, Mint: agent.TokenAddress, UntilSignature: head}
+		// 已有从最新交易开始的区间时它已经覆盖了这一段
+		if err := x.db.Clauses(clause.OnConflict{
+			Columns:     []clause.Column{{Name: "mint"}},
+			TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "before_signature = ''"}}},
+			DoNothing:   true,
+		}).Create(&cursor).Error; err != nil {
+			return 0, fmt.Errorf("open backfill cursor: %w", err)
+		}
+	}
+
+	var cursors []models.TradeBackfillCursor
+	if err := x.db.Where("mint = ?", agent.TokenAddress).Order("id DESC").Find(&cursors).Error; err != nil {
+		return 0, fmt.Errorf("load backfill cursors: %w", err)
+	}
+	count := 0
+	budget := x.Config.Indexer.BackfillLimit
+	for _, cursor := range cursors {
+		if budget <= 0 {
+			break
+		}
+		before, err := optionalSignature(cursor.BeforeSignature)
+		if err != nil {
+			return count, fmt.Errorf("parse backfill cursor: %w", err)
+		}
+		until, err := optionalSignature(cursor.UntilSignature)
+		if err != nil {
+			return count, fmt.Errorf("parse backfill cursor: %w", err)
+		}
+		page, err := x.reader.GetTradeSignatures(ctx, agent.TokenAddress, before, until, budget)
+		if err != nil {
+			return count, err
+		}
+		budget -= len(page.Signatures)
+		for _, sig := range page.Signatures {
+			events, err := x.reader.GetTradeEvents(ctx, sig.Signature)
+			if err != nil {
+				return count, err
+			}
+			inserted, err := x.recordTrades(agent, sig.Signature.String(), sig.Slot, events)
+			count += len(inserted)
+			if err != nil {
+				return count, err
+			}
+		}
+
+		if page.Done {
+			err = x.db.Delete(&cursor).Error
+		} else {
+			err = x.db.Model(&cursor).Update("before_signature", page.Oldest.String()).Error
+		}
+		if err != nil {
+			return count, fmt.Errorf("save backfill cursor: %w", err)
+		}
+		// 读满一段仍没有到下界时预算已经用完
+		if !page.Done {
+			break
+		}
+	}
+	return count, nil
+}
+
+// optionalSignature 解析交易签名，空字符串返回零值
+func optionalSignature(s string) (solana.Signature, error) {
+	if s == "" {
+		return solana.Signature{}, nil
+	}
+	return solana.SignatureFromBase58(s)
+}
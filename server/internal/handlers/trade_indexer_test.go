@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTradeIndexerClaimBackfill(t *testing.T) {
+	x := NewTradeIndexer(nil, nil, nil, nil)
+	ctx := context.Background()
+
+	if !x.claimBackfill(ctx, "a", false) {
+		t.Fatal("first claim rejected")
+	}
+	// 续补遇到正在补齐的代币直接跳过，其他代币不受影响
+	if x.claimBackfill(ctx, "a", false) {
+		t.Error("second claim of a mint in flight accepted")
+	}
+	if !x.claimBackfill(ctx, "b", false) {
+		t.Error("claim of another mint rejected")
+	}
+
+	// 新订阅的代币等待正在进行的补齐结束后再登记
+	claimed := make(chan bool)
+	go func() { claimed <- x.claimBackfill(ctx, "a", true) }()
+	select {
+	case <-claimed:
+		t.Fatal("waiting claim returned while the mint is in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+	x.releaseBackfill("a")
+	if !<-claimed {
+		t.Error("waiting claim rejected after release")
+	}
+
+	// 等待期间取消时放弃登记
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if x.claimBackfill(cancelled, "a", true) {
+		t.Error("claim accepted after the context was cancelled")
+	}
+}
+
+func TestTradeIndexerIndexed(t *testing.T) {
+	x := NewTradeIndexer(nil, nil, nil, nil)
+	x.setLive("a", true)
+	x.setLive("b", true)
+	x.setLive("b", false)
+	if !x.Indexed("a") || x.Indexed("b") {
+		t.Errorf("indexed a=%v b=%v, want only a", x.Indexed("a"), x.Indexed("b"))
+	}
+	// 连接断开后所有代币交回价格轮询
+	x.clearLive()
+	if x.Indexed("a") {
+		t.Error("a still indexed after the connection closed")
+	}
+}
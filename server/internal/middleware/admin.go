@@ -0,0 +1,27 @@
+// internal/middleware/admin.go
+package middleware
+
+import (
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/errors"
+	"github.com/GabbyWorld/all-time-high-backend/internal/logger"
+)
+
+// AdminAuthMiddleware 仅允许配置中的管理员钱包访问，需放在 JWTAuthMiddleware 之后
+func AdminAuthMiddleware(adminWallets []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		walletAddress := c.GetString("userWalletAddress")
+		if walletAddress == "" || !slices.Contains(adminWallets, walletAddress) {
+			apiErr := errors.NewAPIError(errors.ErrForbidden, "Admin access required")
+			c.Error(apiErr)
+			logger.Logger.Warn("AdminAuthMiddleware: access denied", zap.String("wallet_address", walletAddress))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
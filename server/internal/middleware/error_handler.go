@@ -48,6 +48,10 @@ func ErrorHandlerMiddleware() gin.HandlerFunc {
 					statusCode = http.StatusForbidden
 				case errors.ErrNotFound:
 					statusCode = http.StatusNotFound
+				case errors.ErrConflict:
+					statusCode = http.StatusConflict
+				case errors.ErrRateLimited:
+					statusCode = http.StatusTooManyRequests
 				default:
 					statusCode = http.StatusInternalServerError
 				}
@@ -19,7 +19,8 @@ type Agent struct {
 	CreatedAt          time.Time      `json:"created_at"`
 	UpdatedAt          time.Time      `json:"updated_at"`
 	DeletedAt          gorm.DeletedAt `gorm:"index" json:"-"`
-	MarketCap          float64        `gorm:"type:double precision" json:"market_cap"`
+	MarketCap          float64        `gorm:"type:double precision" json:"market_cap"` // USD 市值
+	MarketCapSOL       float64        `gorm:"type:double precision" json:"market_cap_sol"`
 	MarketCapUpdatedAt time.Time      `json:"market_cap_updated_at"`
 	HighestPrice       float64        `gorm:"type:double precision" json:"highest_price"`
 	PreviousPrice      float64        `gorm:"type:double precision" json:"previous_price"` // 新增字段
@@ -27,5 +28,22 @@ type Agent struct {
 	Total              int            `gorm:"default:0" json:"total"`
 	Wins               int            `gorm:"default:0" json:"wins"`
 	Losses             int            `gorm:"default:0" json:"losses"`
+	Draws              int            `gorm:"default:0" json:"draws"`
 	WinRate            float64        `gorm:"default:0" json:"win_rate"`
+	Rating             float64        `gorm:"type:double precision;default:1500;index" json:"rating"`
+	// 链上供应量（已按 decimals 换算），0 表示尚未读取
+	TokenSupply     float64    `gorm:"type:double precision;default:0" json:"token_supply"`
+	TokenDecimals   int        `gorm:"default:0" json:"token_decimals"`
+	SupplyUpdatedAt *time.Time `json:"supply_updated_at,omitempty"`
+	// pump.fun 联合曲线状态（储备量为链上最小单位），CurveUpdatedAt 为空表示尚未读取
+	CurveVirtualTokenReserves uint64     `gorm:"default:0" json:"curve_virtual_token_reserves"`
+	CurveVirtualSOLReserves   uint64     `gorm:"default:0" json:"curve_virtual_sol_reserves"`
+	CurveRealTokenReserves    uint64     `gorm:"default:0" json:"curve_real_token_reserves"`
+	CurveRealSOLReserves      uint64     `gorm:"default:0" json:"curve_real_sol_reserves"`
+	CurveProgress             float64    `gorm:"type:double precision;default:0" json:"curve_progress"` // 0-1
+	Graduated                 bool       `gorm:"default:false;index" json:"graduated"`                  // 联合曲线已完成，代币迁移到 AMM
+	GraduatedAt               *time.Time `json:"graduated_at,omitempty"`
+	CurveUpdatedAt            *time.Time `json:"curve_updated_at,omitempty"`
+	// 社区热度，由每日数据快照计算
+	TractionScore float64 `gorm:"type:double precision;default:0;index" json:"traction_score"`
 }
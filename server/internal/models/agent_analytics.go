@@ -0,0 +1,23 @@
+// internal/models/agent_analytics.go
+package models
+
+import "time"
+
+// AgentAnalytics Agent 代币的每日社区数据快照，同一天内多次采集时覆盖当天的记录。
+// 成交数据来自交易索引器，只包含联合曲线上的成交
+type AgentAnalytics struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	AgentID        uint      `gorm:"not null;uniqueIndex:idx_agent_analytics_agent_date" json:"agent_id"`
+	Date           time.Time `gorm:"type:date;not null;uniqueIndex:idx_agent_analytics_agent_date" json:"date"`
+	Holders        int       `gorm:"not null;default:0" json:"holders"`
+	TopHolderShare float64   `gorm:"type:double precision;default:0" json:"top_holder_share"` // 最大持有人占总供应量的比例
+	Top10Share     float64   `gorm:"type:double precision;default:0" json:"top10_share"`      // 前 10 名持有人占总供应量的比例
+	BuyVolumeSOL   float64   `gorm:"type:double precision;default:0" json:"buy_volume_sol"`   // 最近 24 小时
+	SellVolumeSOL  float64   `gorm:"type:double precision;default:0" json:"sell_volume_sol"`  // 最近 24 小时
+	Buys           int       `gorm:"not null;default:0" json:"buys"`
+	Sells          int       `gorm:"not null;default:0" json:"sells"`
+	UniqueTraders  int       `gorm:"not null;default:0" json:"unique_traders"` // 最近 24 小时
+	TractionScore  float64   `gorm:"type:double precision;default:0" json:"traction_score"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
@@ -0,0 +1,13 @@
+// internal/models/ath_event.go
+package models
+
+import "time"
+
+// AthEvent 记录 Agent 代币价格（SOL 计价）突破历史最高价
+type AthEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	AgentID   uint      `gorm:"not null;index" json:"agent_id"`
+	OldHigh   float64   `gorm:"type:double precision" json:"old_high"`
+	NewHigh   float64   `gorm:"type:double precision" json:"new_high"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
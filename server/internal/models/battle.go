@@ -3,13 +3,149 @@ package models
 
 import "time"
 
+// BattleOutcome 战斗结果（从攻击者视角）
+type BattleOutcome string
+
+const (
+	OutcomeTotalVictory   BattleOutcome = "TOTAL_VICTORY"
+	OutcomeNarrowVictory  BattleOutcome = "NARROW_VICTORY"
+	OutcomeNarrowDefeat   BattleOutcome = "NARROW_DEFEAT"
+	OutcomeCrushingDefeat BattleOutcome = "CRUSHING_DEFEAT"
+	// OutcomeDraw 裁判团打平时的结果，单个裁判不会给出
+	OutcomeDraw BattleOutcome = "DRAW"
+)
+
+// JudgeOutcomes 单个裁判可以给出的结果
+var JudgeOutcomes = []BattleOutcome{OutcomeTotalVictory, OutcomeNarrowVictory, OutcomeNarrowDefeat, OutcomeCrushingDefeat}
+
+// Valid 判断结果是否为已知的枚举值
+func (o BattleOutcome) Valid() bool {
+	switch o {
+	case OutcomeTotalVictory, OutcomeNarrowVictory, OutcomeNarrowDefeat, OutcomeCrushingDefeat, OutcomeDraw:
+		return true
+	}
+	return false
+}
+
+// AttackerWon 攻击者是否获胜
+func (o BattleOutcome) AttackerWon() bool {
+	return o == OutcomeTotalVictory || o == OutcomeNarrowVictory
+}
+
+// DefenderWon 防御者是否获胜
+func (o BattleOutcome) DefenderWon() bool {
+	return o == OutcomeNarrowDefeat || o == OutcomeCrushingDefeat
+}
+
+// Decisive 是否为压倒性结果（Total Victory / Crushing Defeat）
+func (o BattleOutcome) Decisive() bool {
+	return o == OutcomeTotalVictory || o == OutcomeCrushingDefeat
+}
+
+// BattleType 战斗的触发类型
+type BattleType string
+
+const (
+	BattleTypePriceIncrease BattleType = "PRICE_INCREASE"
+	BattleTypeAthBreakout   BattleType = "ATH_BREAKOUT"
+	BattleTypeTournament    BattleType = "TOURNAMENT"
+	BattleTypeChallenge     BattleType = "CHALLENGE"
+	BattleTypeTeam          BattleType = "TEAM"
+	BattleTypeGraduation    BattleType = "GRADUATION"
+)
+
+// Valid 判断战斗类型是否为已知的枚举值
+func (t BattleType) Valid() bool {
+	switch t {
+	case BattleTypePriceIncrease, BattleTypeAthBreakout, BattleTypeTournament, BattleTypeChallenge, BattleTypeTeam, BattleTypeGraduation:
+		return true
+	}
+	return false
+}
+
+// Battle 一场战斗。AttackerID/DefenderID 为双方的队长（1v1 即双方本身），
+// 全部参战者记录在 Participants 中。idx_battles_created_id 支持战斗列表按 (created_at, id) 倒序的游标翻页
 type Battle struct {
-	ID          uint      `gorm:"primaryKey" json:"id"`
-	AttackerID  uint      `gorm:"not null;index" json:"attacker_id"`
-	Attacker    Agent     `gorm:"foreignKey:AttackerID" json:"attacker"`
-	DefenderID  uint      `gorm:"not null;index" json:"defender_id"`
-	Defender    Agent     `gorm:"foreignKey:DefenderID" json:"defender"`
-	CreatedAt   time.Time `json:"created_at"`
-	Outcome     string    `gorm:"type:varchar(20);not null" json:"outcome"`
-	Description string    `json:"description"`
+	ID          uint          `gorm:"primaryKey;index:idx_battles_created_id,sort:desc,priority:2" json:"id"`
+	AttackerID  uint          `gorm:"not null;index" json:"attacker_id"`
+	Attacker    Agent         `gorm:"foreignKey:AttackerID" json:"attacker"`
+	DefenderID  uint          `gorm:"not null;index" json:"defender_id"`
+	Defender    Agent         `gorm:"foreignKey:DefenderID" json:"defender"`
+	CreatedAt   time.Time     `gorm:"index:idx_battles_created_id,sort:desc,priority:1" json:"created_at"`
+	Outcome     BattleOutcome `gorm:"type:varchar(20);not null" json:"outcome"`
+	Margin      int           `gorm:"default:0" json:"margin"` // 裁判给出的胜负差距（0-100）
+	Description string        `json:"description"`
+	Reasoning   string        `gorm:"type:text" json:"reasoning"`
+	// 产生该配对的匹配策略和候选池
+	MatchStrategy     string `gorm:"type:varchar(32)" json:"match_strategy"`
+	CandidatePool     string `gorm:"type:varchar(100)" json:"candidate_pool"`
+	CandidatePoolSize int64  `gorm:"default:0" json:"candidate_pool_size"`
+	// 触发类型，ATH 突破触发的战斗关联对应的 AthEvent
+	Type       BattleType `gorm:"type:varchar(20);not null;default:PRICE_INCREASE;index" json:"type"`
+	AthEventID *uint      `gorm:"index" json:"ath_event_id,omitempty"`
+	SeasonID   *uint      `gorm:"index" json:"season_id,omitempty"`
+	// 锦标赛战斗关联的锦标赛和轮次
+	TournamentID    *uint `gorm:"index" json:"tournament_id,omitempty"`
+	TournamentRound *int  `json:"tournament_round,omitempty"`
+	// 裁判团的汇总方式、判决类型（unanimous, split, tie）以及每个裁判的投票
+	Aggregation   string      `gorm:"type:varchar(20)" json:"aggregation"`
+	PanelDecision string      `gorm:"type:varchar(20)" json:"panel_decision"`
+	Votes         []JudgeVote `gorm:"foreignKey:BattleID" json:"votes,omitempty"`
+	// 每方的人数，1 为普通 1v1
+	TeamSize     int                 `gorm:"not null;default:1" json:"team_size"`
+	Participants []BattleParticipant `gorm:"foreignKey:BattleID" json:"participants,omitempty"`
+	// 多回合战斗的回合记录，单回合战斗为空
+	Rounds []BattleRound `gorm:"foreignKey:BattleID" json:"rounds,omitempty"`
+}
+
+// 参战方
+const (
+	SideAttacker = "attacker"
+	SideDefender = "defender"
+)
+
+// BattleParticipant 参与一场战斗的 Agent 及其所属的一方
+type BattleParticipant struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	BattleID  uint      `gorm:"not null;uniqueIndex:idx_battle_participants_battle_agent" json:"battle_id"`
+	AgentID   uint      `gorm:"not null;uniqueIndex:idx_battle_participants_battle_agent;index" json:"agent_id"`
+	Agent     Agent     `gorm:"foreignKey:AgentID" json:"agent"`
+	Side      string    `gorm:"type:varchar(10);not null" json:"side"`
+	Slot      int       `gorm:"not null;default:0" json:"slot"` // 在本方中的顺序，0 为队长
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Won 该参战者所在的一方是否获胜
+func (p BattleParticipant) Won(outcome BattleOutcome) bool {
+	if p.Side == SideAttacker {
+		return outcome.AttackerWon()
+	}
+	return outcome.DefenderWon()
+}
+
+// BattleRound 多回合战斗中的一个回合，AttackerScore/DefenderScore 为截至本回合的累计得分
+type BattleRound struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	BattleID       uint      `gorm:"not null;uniqueIndex:idx_battle_rounds_battle_round" json:"battle_id"`
+	Round          int       `gorm:"not null;uniqueIndex:idx_battle_rounds_battle_round" json:"round"` // 从 1 开始
+	Narrative      string    `gorm:"type:text" json:"narrative"`
+	AttackerPoints int       `json:"attacker_points"`
+	DefenderPoints int       `json:"defender_points"`
+	AttackerScore  int       `json:"attacker_score"`
+	DefenderScore  int       `json:"defender_score"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// JudgeVote 裁判团中单个裁判对一场战斗的投票
+type JudgeVote struct {
+	ID          uint          `gorm:"primaryKey" json:"id"`
+	BattleID    uint          `gorm:"not null;index" json:"battle_id"`
+	Judge       int           `gorm:"not null" json:"judge"`
+	Model       string        `gorm:"type:varchar(50)" json:"model"`
+	Temperature float64       `json:"temperature"`
+	Outcome     BattleOutcome `gorm:"type:varchar(20);not null" json:"outcome"`
+	Margin      int           `json:"margin"`
+	Narrative   string        `gorm:"type:text" json:"narrative"`
+	Reasoning   string        `gorm:"type:text" json:"reasoning"`
+	CreatedAt   time.Time     `json:"created_at"`
 }
@@ -0,0 +1,46 @@
+// internal/models/battle_job.go
+package models
+
+import "time"
+
+// BattleJobStatus 战斗任务状态
+type BattleJobStatus string
+
+const (
+	BattleJobPending   BattleJobStatus = "pending"
+	BattleJobRunning   BattleJobStatus = "running"
+	BattleJobSucceeded BattleJobStatus = "succeeded"
+	BattleJobFailed    BattleJobStatus = "failed"
+	BattleJobCancelled BattleJobStatus = "cancelled"
+)
+
+// Valid 判断状态是否为已知的枚举值
+func (s BattleJobStatus) Valid() bool {
+	switch s {
+	case BattleJobPending, BattleJobRunning, BattleJobSucceeded, BattleJobFailed, BattleJobCancelled:
+		return true
+	}
+	return false
+}
+
+// BattleJob 持久化的战斗触发任务，由后台 worker 领取执行，失败后按退避策略重试
+type BattleJob struct {
+	ID          uint            `gorm:"primaryKey" json:"id"`
+	AttackerID  uint            `gorm:"not null;index" json:"attacker_id"`
+	Attacker    Agent           `gorm:"foreignKey:AttackerID" json:"-"`
+	Type        BattleType      `gorm:"type:varchar(20);not null;default:PRICE_INCREASE" json:"type"`
+	AthEventID  *uint           `json:"ath_event_id,omitempty"`
+	DefenderID  *uint           `json:"defender_id,omitempty"`                                    // 挑战任务指定的防御者，为空时由匹配策略挑选
+	AttackerIDs []uint          `gorm:"serializer:json;type:jsonb" json:"attacker_ids,omitempty"` // 团队战攻击方全部成员（含队长），1v1 为空
+	DefenderIDs []uint          `gorm:"serializer:json;type:jsonb" json:"defender_ids,omitempty"` // 团队战防御方全部成员（含队长），1v1 为空
+	Status      BattleJobStatus `gorm:"type:varchar(20);not null;index:idx_battle_jobs_status_next_run" json:"status"`
+	Attempts    int             `gorm:"not null;default:0" json:"attempts"`
+	MaxAttempts int             `gorm:"not null;default:5" json:"max_attempts"`
+	NextRunAt   time.Time       `gorm:"not null;index:idx_battle_jobs_status_next_run" json:"next_run_at"`
+	LastError   string          `gorm:"type:text" json:"last_error,omitempty"`
+	BattleID    *uint           `gorm:"index" json:"battle_id,omitempty"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
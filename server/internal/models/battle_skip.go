@@ -0,0 +1,18 @@
+// internal/models/battle_skip.go
+package models
+
+import "time"
+
+// BattleSkip 记录因公平性规则被跳过的攻击者或候选防御者，便于排查某个 Agent 为何没有参战。
+// Role 为 attacker 时 AgentID 是被跳过的攻击者；为 candidates 时 AgentID 是正在挑选对手的攻击者，
+// 被排除的候选者按规则汇总在 Excluded 中
+type BattleSkip struct {
+	ID        uint              `gorm:"primaryKey" json:"id"`
+	AgentID   uint              `gorm:"not null;index" json:"agent_id"`
+	Role      string            `gorm:"type:varchar(20);not null" json:"role"` // attacker 或 candidates
+	Rule      string            `gorm:"type:varchar(32);not null;index" json:"rule"`
+	Detail    string            `gorm:"type:varchar(255)" json:"detail"`
+	Excluded  map[string][]uint `gorm:"serializer:json;type:jsonb" json:"excluded,omitempty"` // 规则 -> 被排除的候选者 ID
+	Type      BattleType        `gorm:"type:varchar(20)" json:"type"`
+	CreatedAt time.Time         `gorm:"index" json:"created_at"`
+}
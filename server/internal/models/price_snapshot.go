@@ -0,0 +1,26 @@
+// internal/models/price_snapshot.go
+package models
+
+import "time"
+
+// PriceResolutionHour 按小时合并后的快照
+const PriceResolutionHour = 3600
+
+// PriceSnapshot Agent 代币价格的一次采样。原始采样（Resolution 为 0）的 Open/High/Low 与收盘价相同；
+// 超过保留期的原始采样按小时合并为一行，CreatedAt 为该小时的起点。USD 价格获取失败时为空
+type PriceSnapshot struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	AgentID    uint      `gorm:"not null;index:idx_price_snapshots_agent_time" json:"agent_id"`
+	Resolution int       `gorm:"not null;default:0;index" json:"resolution"` // 覆盖的秒数，0 为原始采样
+	OpenSOL    float64   `gorm:"type:double precision" json:"open_sol"`
+	HighSOL    float64   `gorm:"type:double precision" json:"high_sol"`
+	LowSOL     float64   `gorm:"type:double precision" json:"low_sol"`
+	PriceSOL   float64   `gorm:"type:double precision" json:"price_sol"`
+	OpenUSD    *float64  `gorm:"type:double precision" json:"open_usd"`
+	HighUSD    *float64  `gorm:"type:double precision" json:"high_usd"`
+	LowUSD     *float64  `gorm:"type:double precision" json:"low_usd"`
+	PriceUSD   *float64  `gorm:"type:double precision" json:"price_usd"`
+	SourceSOL  string    `gorm:"type:varchar(32)" json:"source_sol,omitempty"` // 收盘价的来源，合并后为空
+	SourceUSD  string    `gorm:"type:varchar(32)" json:"source_usd,omitempty"`
+	CreatedAt  time.Time `gorm:"index:idx_price_snapshots_agent_time" json:"created_at"`
+}
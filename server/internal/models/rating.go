@@ -0,0 +1,19 @@
+// internal/models/rating.go
+package models
+
+import "time"
+
+// RatingHistory 记录每场战斗带来的 Agent 分数变化
+type RatingHistory struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	AgentID   uint      `gorm:"not null;index" json:"agent_id"`
+	BattleID  uint      `gorm:"not null;index" json:"battle_id"`
+	OldRating float64   `gorm:"type:double precision" json:"old_rating"`
+	NewRating float64   `gorm:"type:double precision" json:"new_rating"`
+	Delta     float64   `gorm:"type:double precision" json:"delta"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+func (RatingHistory) TableName() string {
+	return "rating_history"
+}
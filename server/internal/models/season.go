@@ -0,0 +1,57 @@
+// internal/models/season.go
+package models
+
+import "time"
+
+// Season 赛季，战绩按赛季单独统计，结束时归档最终排名
+type Season struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Name       string     `gorm:"type:varchar(100);not null" json:"name"`
+	StartsAt   time.Time  `gorm:"not null;index" json:"starts_at"`
+	EndsAt     time.Time  `gorm:"not null;index" json:"ends_at"`
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// SeasonRecord 一个赛季内的战绩
+type SeasonRecord struct {
+	Total   int     `gorm:"default:0" json:"total"`
+	Wins    int     `gorm:"default:0" json:"wins"`
+	Losses  int     `gorm:"default:0" json:"losses"`
+	Draws   int     `gorm:"default:0" json:"draws"`
+	WinRate float64 `gorm:"default:0" json:"win_rate"`
+	Rating  float64 `gorm:"type:double precision;default:1500" json:"rating"`
+}
+
+// Record 记录一场战斗的结果，score 为胜 1、平 0.5、负 0
+func (r *SeasonRecord) Record(score float64) {
+	r.Total++
+	switch score {
+	case 1:
+		r.Wins++
+	case 0:
+		r.Losses++
+	default:
+		r.Draws++
+	}
+	r.WinRate = float64(r.Wins) / float64(r.Total) * 100
+}
+
+// AgentSeasonStats Agent 在某个赛季的战绩
+type AgentSeasonStats struct {
+	ID           uint         `gorm:"primaryKey" json:"id"`
+	SeasonID     uint         `gorm:"not null;uniqueIndex:idx_agent_season_stats_season_agent" json:"season_id"`
+	AgentID      uint         `gorm:"not null;uniqueIndex:idx_agent_season_stats_season_agent;index" json:"agent_id"`
+	SeasonRecord SeasonRecord `gorm:"embedded" json:"record"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+}
+
+// SeasonStanding 赛季结束时归档的最终排名
+type SeasonStanding struct {
+	ID           uint         `gorm:"primaryKey" json:"id"`
+	SeasonID     uint         `gorm:"not null;index" json:"season_id"`
+	AgentID      uint         `gorm:"not null;index" json:"agent_id"`
+	Rank         int          `gorm:"not null" json:"rank"`
+	SeasonRecord SeasonRecord `gorm:"embedded" json:"record"`
+	CreatedAt    time.Time    `json:"created_at"`
+}
@@ -0,0 +1,39 @@
+// internal/models/stats_rebuild.go
+package models
+
+import "time"
+
+// StatsRebuildStatus 战绩重建任务状态
+type StatsRebuildStatus string
+
+const (
+	StatsRebuildRunning   StatsRebuildStatus = "running"
+	StatsRebuildSucceeded StatsRebuildStatus = "succeeded"
+	StatsRebuildFailed    StatsRebuildStatus = "failed"
+)
+
+// AgentStatsDiff 一个 Agent 重建前后的战绩
+type AgentStatsDiff struct {
+	AgentID uint         `json:"agent_id"`
+	Name    string       `json:"name"`
+	Before  SeasonRecord `json:"before"`
+	After   SeasonRecord `json:"after"`
+}
+
+// StatsRebuildJob 管理员发起的一次战绩重建，在后台执行，完成后结果写回本表供查询。
+// 执行期间定期刷新 UpdatedAt，长时间未刷新的 running 任务视为已中断
+type StatsRebuildJob struct {
+	ID      uint               `gorm:"primaryKey" json:"id"`
+	AgentID *uint              `json:"agent_id,omitempty"` // 只写回该 Agent，为空时写回全部 Agent
+	DryRun  bool               `gorm:"not null;default:false" json:"dry_run"`
+	Status  StatsRebuildStatus `gorm:"type:varchar(20);not null;index" json:"status"`
+	// 重建结果：重放的战斗数、检查的 Agent 数、战绩变化的 Agent 以及分数历史被重写的 Agent 数
+	Battles          int              `gorm:"default:0" json:"battles"`
+	Agents           int              `gorm:"default:0" json:"agents"`
+	Changed          []AgentStatsDiff `gorm:"serializer:json;type:jsonb" json:"changed"`
+	HistoryRewritten int              `gorm:"default:0" json:"history_rewritten"`
+	Error            string           `gorm:"type:text" json:"error,omitempty"`
+	CreatedAt        time.Time        `json:"created_at"`
+	UpdatedAt        time.Time        `json:"updated_at"`
+	FinishedAt       *time.Time       `json:"finished_at,omitempty"`
+}
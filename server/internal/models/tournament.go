@@ -0,0 +1,86 @@
+// internal/models/tournament.go
+package models
+
+import "time"
+
+// TournamentFormat 赛制
+type TournamentFormat string
+
+const (
+	TournamentSingleElimination TournamentFormat = "single_elimination"
+	TournamentSwiss             TournamentFormat = "swiss"
+)
+
+// TournamentStatus 锦标赛状态
+type TournamentStatus string
+
+const (
+	TournamentRegistration TournamentStatus = "registration"
+	TournamentInProgress   TournamentStatus = "in_progress"
+	TournamentCompleted    TournamentStatus = "completed"
+)
+
+// Tournament 锦标赛。报名结束后按 Elo 分数排种子并生成对阵，逐轮由裁判团判定
+type Tournament struct {
+	ID     uint             `gorm:"primaryKey" json:"id"`
+	Name   string           `gorm:"type:varchar(100);not null" json:"name"`
+	Format TournamentFormat `gorm:"type:varchar(20);not null" json:"format"`
+	Status TournamentStatus `gorm:"type:varchar(20);not null;default:registration;index" json:"status"`
+	// 总轮数，单败淘汰赛在开赛时根据人数计算，瑞士轮由创建时指定
+	Rounds       int `gorm:"not null;default:0" json:"rounds"`
+	CurrentRound int `gorm:"not null;default:0" json:"current_round"`
+	// RoundClaimedAt 当前轮被某个实例领取执行的时间，执行结束后清空；超过租约时间视为中断，可以重新领取
+	RoundClaimedAt *time.Time        `json:"round_claimed_at,omitempty"`
+	WinnerID       *uint             `json:"winner_id,omitempty"`
+	StartedAt      *time.Time        `json:"started_at,omitempty"`
+	CompletedAt    *time.Time        `json:"completed_at,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+	Entries        []TournamentEntry `gorm:"foreignKey:TournamentID" json:"entries,omitempty"`
+	Matches        []TournamentMatch `gorm:"foreignKey:TournamentID" json:"matches,omitempty"`
+}
+
+// TournamentEntry 报名参赛的 Agent 及其在锦标赛中的成绩
+type TournamentEntry struct {
+	ID           uint    `gorm:"primaryKey" json:"id"`
+	TournamentID uint    `gorm:"not null;uniqueIndex:idx_tournament_entries_tournament_agent" json:"tournament_id"`
+	AgentID      uint    `gorm:"not null;uniqueIndex:idx_tournament_entries_tournament_agent;index" json:"agent_id"`
+	Agent        Agent   `gorm:"foreignKey:AgentID" json:"agent"`
+	Seed         int     `gorm:"default:0" json:"seed"`
+	Points       float64 `gorm:"default:0" json:"points"` // 瑞士轮积分：胜 1、平 0.5、轮空 1
+	Wins         int     `gorm:"default:0" json:"wins"`
+	Losses       int     `gorm:"default:0" json:"losses"`
+	Draws        int     `gorm:"default:0" json:"draws"`
+	Eliminated   bool    `gorm:"default:false" json:"eliminated"`
+	// HadBye 瑞士轮中每个 Agent 最多轮空一次
+	HadBye    bool      `gorm:"default:false" json:"had_bye"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TournamentMatchStatus 对阵状态
+type TournamentMatchStatus string
+
+const (
+	TournamentMatchPending   TournamentMatchStatus = "pending"
+	TournamentMatchCompleted TournamentMatchStatus = "completed"
+)
+
+// TournamentMatch 锦标赛某一轮中的一场对阵，DefenderID 为空表示轮空
+type TournamentMatch struct {
+	ID           uint                  `gorm:"primaryKey" json:"id"`
+	TournamentID uint                  `gorm:"not null;index:idx_tournament_matches_round" json:"tournament_id"`
+	Round        int                   `gorm:"not null;index:idx_tournament_matches_round" json:"round"`
+	Slot         int                   `gorm:"not null" json:"slot"` // 在本轮中的位置，单败淘汰赛用于确定下一轮对阵
+	AttackerID   uint                  `gorm:"not null" json:"attacker_id"`
+	DefenderID   *uint                 `json:"defender_id,omitempty"`
+	Status       TournamentMatchStatus `gorm:"type:varchar(20);not null;default:pending" json:"status"`
+	BattleID     *uint                 `json:"battle_id,omitempty"`
+	WinnerID     *uint                 `json:"winner_id,omitempty"`
+	CreatedAt    time.Time             `json:"created_at"`
+	UpdatedAt    time.Time             `json:"updated_at"`
+}
+
+// IsBye 是否为轮空
+func (m TournamentMatch) IsBye() bool {
+	return m.DefenderID == nil
+}
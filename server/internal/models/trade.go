@@ -0,0 +1,24 @@
+// internal/models/trade.go
+package models
+
+import "time"
+
+// Trade pump.fun 联合曲线上的一笔成交，由交易索引器从链上事件写入。
+// 同一笔交易可能包含多个事件，以 Signature + EventIndex 去重
+type Trade struct {
+	ID                   uint      `gorm:"primaryKey" json:"id"`
+	AgentID              uint      `gorm:"not null;index:idx_trades_agent_time" json:"agent_id"`
+	Mint                 string    `gorm:"type:varchar(100);not null;index" json:"mint"`
+	Signature            string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_trades_signature_event" json:"signature"`
+	EventIndex           int       `gorm:"not null;default:0;uniqueIndex:idx_trades_signature_event" json:"event_index"`
+	Slot                 uint64    `gorm:"not null;index" json:"slot"`
+	Trader               string    `gorm:"type:varchar(100);not null" json:"trader"`
+	IsBuy                bool      `gorm:"not null" json:"is_buy"`
+	SOLAmount            uint64    `gorm:"not null" json:"sol_amount"`             // lamports
+	TokenAmount          uint64    `gorm:"not null" json:"token_amount"`           // 代币最小单位
+	PriceSOL             float64   `gorm:"type:double precision" json:"price_sol"` // 成交后的曲线价格
+	VirtualSOLReserves   uint64    `json:"virtual_sol_reserves"`
+	VirtualTokenReserves uint64    `json:"virtual_token_reserves"`
+	BlockTime            time.Time `gorm:"not null;index:idx_trades_agent_time" json:"block_time"`
+	CreatedAt            time.Time `json:"created_at"`
+}
@@ -0,0 +1,17 @@
+// internal/models/trade_backfill.go
+package models
+
+import "time"
+
+// TradeBackfillCursor 一个代币尚未补齐的成交区间：UntilSignature 与 BeforeSignature 之间的交易还没有读取。
+// BeforeSignature 为空表示从最新的交易开始，UntilSignature 为空表示一直补到代币的第一笔交易。
+// 每次补齐从 BeforeSignature 继续向前翻页并推进它，读到 UntilSignature 后删除。同一代币最多有一个从最新交易开始的区间
+type TradeBackfillCursor struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	AgentID         uint      `gorm:"not null;index" json:"agent_id"`
+	Mint            string    `gorm:"type:varchar(100);not null;index;uniqueIndex:idx_trade_backfill_head,where:before_signature = ''" json:"mint"`
+	BeforeSignature string    `gorm:"type:varchar(100);not null;default:''" json:"before_signature"`
+	UntilSignature  string    `gorm:"type:varchar(100);not null;default:''" json:"until_signature"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/GabbyWorld/all-time-high-backend/internal/config"
+	"github.com/GabbyWorld/all-time-high-backend/internal/models"
 	"github.com/GabbyWorld/all-time-high-backend/pkg/utils"
 	"go.uber.org/zap"
 	"gorm.io/driver/postgres"
@@ -17,7 +18,60 @@ type Repository struct {
 	DB *gorm.DB
 }
 
+// NewRepository 连接数据库，自动迁移模型并补齐历史数据
 func NewRepository(cfg *config.Config) (*Repository, error) {
+	db, err := Connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Migrate(db); err != nil {
+		return nil, err
+	}
+
+	return &Repository{DB: db}, nil
+}
+
+// Migrate 自动迁移全部模型并补齐历史数据
+func Migrate(db *gorm.DB) error {
+	// 自动迁移模型
+	err := db.AutoMigrate(
+		&models.User{},
+		&models.Agent{},
+		&models.Battle{},
+		&models.JudgeVote{},
+		&models.RatingHistory{},
+		&models.BattleJob{},
+		&models.AthEvent{},
+		&models.Season{},
+		&models.AgentSeasonStats{},
+		&models.SeasonStanding{},
+		&models.Tournament{},
+		&models.TournamentEntry{},
+		&models.TournamentMatch{},
+		&models.BattleSkip{},
+		&models.BattleParticipant{},
+		&models.BattleRound{},
+		&models.PriceSnapshot{},
+		&models.Trade{},
+		&models.TradeBackfillCursor{},
+		&models.AgentAnalytics{},
+		&models.StatsRebuildJob{},
+	)
+	if err != nil {
+		return err
+	}
+
+	// 为引入参战者表之前的 1v1 战斗补齐参战记录，已存在的不会重复写入
+	if err := backfillBattleParticipants(db); err != nil {
+		return fmt.Errorf("backfill battle participants: %w", err)
+	}
+
+	return nil
+}
+
+// Connect 连接数据库并配置连接池，不做迁移，供命令行子命令使用
+func Connect(cfg *config.Config) (*gorm.DB, error) {
 	var err error
 	var db *gorm.DB
 	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d",
@@ -87,17 +141,18 @@ func NewRepository(cfg *config.Config) (*Repository, error) {
 	if err := sqlDB.Ping(); err != nil {
 		return nil, err
 	}
+	return db, nil
+}
 
-	// 自动迁移模型
-	err = db.AutoMigrate(
-	// 在此处列出需要迁移的模型，如：
-	// &models.User{},
-	// &models.Agent{}, // 添加Agent模型
-	// &models.Battle{},
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	return &Repository{DB: db}, nil
+// backfillBattleParticipants 根据 attacker_id / defender_id 为缺少参战记录的战斗写入双方
+func backfillBattleParticipants(db *gorm.DB) error {
+	return db.Exec(`
+		INSERT INTO battle_participants (battle_id, agent_id, side, slot, created_at)
+		SELECT id, attacker_id, ?, 0, created_at FROM battles b
+		WHERE NOT EXISTS (SELECT 1 FROM battle_participants p WHERE p.battle_id = b.id)
+		UNION ALL
+		SELECT id, defender_id, ?, 0, created_at FROM battles b
+		WHERE NOT EXISTS (SELECT 1 FROM battle_participants p WHERE p.battle_id = b.id)
+		ON CONFLICT (battle_id, agent_id) DO NOTHING`,
+		models.SideAttacker, models.SideDefender).Error
 }
@@ -16,7 +16,7 @@ import (
 	"gorm.io/gorm"
 )
 
-func SetupRouter(db *gorm.DB, jwtManager *utils.JWTManager, cfg *config.Config) *gin.Engine {
+func SetupRouter(db *gorm.DB, jwtManager *utils.JWTManager, prices utils.PriceProvider, curves *utils.BondingCurveReader, cfg *config.Config) *gin.Engine {
 	r := gin.New()
 
 	// 添加Zap日志中间件
@@ -46,20 +46,46 @@ func SetupRouter(db *gorm.DB, jwtManager *utils.JWTManager, cfg *config.Config)
 		JWTManager: jwtManager,
 	}
 
+	// 接口读取价格走共享缓存；价格监控需要最新价格，直接使用上游
+	priceCache := utils.NewPriceCache(prices, cfg.Price.CacheTTL)
+	marketCaps := handlers.NewMarketCapService(db, priceCache, utils.NewRPCSupplyProvider(cfg.Solana.RPCEndpoint), cfg)
+	marketCaps.Start()
+
 	// Agent相关路由
 	agentHandler := handlers.AgentHandler{
 		DB:         db,
 		Config:     cfg,
 		JWTManager: jwtManager,
+		Prices:     priceCache,
+		MarketCaps: marketCaps,
 	}
 
 	agentWSHandler := &handlers.AgentWebSocketHandler{
-		DB: db,
+		DB:     db,
+		Prices: priceCache,
 	}
 
 	battleWSHandler := handlers.NewBattleWebSocketHandler(db)
-	battleService := handlers.NewBattleService(db, battleWSHandler, cfg)
-	battleService.StartPriceMonitoring()
+	battleService := handlers.NewBattleService(db, battleWSHandler, prices, cfg)
+	battleService.StartBattleWorkers()
+	battleService.StartSeasonRollover()
+	battleService.StartPriceHistoryMaintenance()
+
+	webhooks := utils.NewWebhookNotifier(cfg.Webhook.URLs, cfg.Webhook.Secret, cfg.Webhook.Timeout)
+	// 联合曲线跟踪和交易索引依赖 pump.fun 程序地址，未配置时 curves 为空
+	var indexer *handlers.TradeIndexer
+	if curves != nil {
+		handlers.NewBondingCurveService(db, curves, battleService, webhooks, cfg).Start()
+		if cfg.Indexer.Enabled {
+			indexer = handlers.NewTradeIndexer(db, curves, battleService, cfg)
+			indexer.Start()
+		}
+	} else if cfg.Indexer.Enabled {
+		logger.Logger.Warn("Trade indexer is enabled but bonding curve tracking is disabled, not starting it")
+	}
+	// 索引器运行时，价格轮询只为已毕业或未被索引的代币触发战斗
+	battleService.StartPriceMonitoring(indexer)
+	handlers.NewAnalyticsService(db, utils.NewTokenHolderReader(cfg.Solana.RPCEndpoint, curves), cfg).Start()
 
 	api := r.Group("/api")
 	{
@@ -68,7 +94,13 @@ func SetupRouter(db *gorm.DB, jwtManager *utils.JWTManager, cfg *config.Config)
 		api.POST("/connect_wallet", userHandler.ConnectWallet)
 		api.GET("/agents/all", agentHandler.GetAllAgents)
 		api.GET("/battles", battleService.GetBattles)
+		api.GET("/battles/feed", battleService.GetBattleFeed)
 		api.GET("/agent/:id", agentHandler.GetAgentByID)
+		api.GET("/agents/:id/rating_history", agentHandler.GetRatingHistory)
+		api.GET("/agents/:id/candles", agentHandler.GetCandles)
+		api.GET("/agents/:id/analytics", agentHandler.GetAnalytics)
+		api.GET("/agents/:id/matchups", battleService.GetMatchups)
+		api.GET("/agents/:id/vs/:opponent_id", battleService.GetHeadToHead)
 		api.GET("/generate_nonce", userHandler.GenerateNonce)
 
 		// WebSocket路由（无需JWT认证，示例可根据需要调整认证逻辑）
@@ -77,6 +109,9 @@ func SetupRouter(db *gorm.DB, jwtManager *utils.JWTManager, cfg *config.Config)
 		api.GET("/ws/agents", agentWSHandler.HandleAgentWebSocket)
 		api.GET("/ws/battle", battleWSHandler.HandleBattleWebSocket)
 		api.GET("/leaderboard", agentHandler.GetLeaderboard)
+		api.GET("/seasons", battleService.GetSeasons)
+		api.GET("/tournaments", battleService.GetTournaments)
+		api.GET("/tournaments/:id", battleService.GetTournament)
 
 		// 受保护的路由组
 		protected := api.Group("/")
@@ -86,6 +121,25 @@ func SetupRouter(db *gorm.DB, jwtManager *utils.JWTManager, cfg *config.Config)
 			protected.POST("/agent", agentHandler.CreateAgent)   // 新增Agent路由
 			protected.GET("/agents", agentHandler.GetUserAgents) // 新增Agent查询路由
 			protected.GET("/battle", battleService.GetBattle)
+			protected.POST("/battle/challenge", battleService.ChallengeBattle)
+			protected.POST("/battle/team", battleService.TeamBattle)
+			protected.POST("/tournaments/:id/entries", battleService.RegisterTournamentAgent)
+		}
+
+		// 管理接口，仅允许配置的管理员钱包访问
+		admin := api.Group("/admin")
+		admin.Use(middleware.JWTAuthMiddleware(jwtManager), middleware.AdminAuthMiddleware(cfg.Admin.WalletAddresses))
+		{
+			admin.GET("/battle_jobs", battleService.ListBattleJobs)
+			admin.POST("/battle_jobs/:id/retry", battleService.RetryBattleJob)
+			admin.POST("/battle_jobs/:id/cancel", battleService.CancelBattleJob)
+			admin.GET("/battle_skips", battleService.ListBattleSkips)
+			admin.GET("/price_sources", battleService.ListPriceSources)
+			admin.POST("/stats/rebuild", battleService.RebuildStats)
+			admin.GET("/stats/rebuild/:id", battleService.GetStatsRebuild)
+			admin.POST("/tournaments", battleService.CreateTournament)
+			admin.POST("/tournaments/:id/start", battleService.StartTournament)
+			admin.POST("/tournaments/:id/run_round", battleService.RunTournamentRound)
 		}
 	}
 
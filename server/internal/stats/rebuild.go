@@ -0,0 +1,277 @@
+// internal/stats/rebuild.go
+package stats
+
+import (
+	"cmp"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/models"
+	"github.com/GabbyWorld/all-time-high-backend/pkg/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultBatchSize 每批读取的战斗数
+const DefaultBatchSize = 500
+
+// ratingEpsilon 小于该值的分数差异视为未变化
+const ratingEpsilon = 1e-6
+
+// ErrAgentNotFound 指定的 Agent 不存在
+var ErrAgentNotFound = errors.New("agent not found")
+
+// Options 重建战绩的参数
+type Options struct {
+	AgentID   *uint // 只写回该 Agent，为空时写回全部 Agent
+	DryRun    bool  // 只计算差异，不写入数据库
+	BatchSize int
+}
+
+// AgentDiff 一个 Agent 重建前后的战绩
+type AgentDiff = models.AgentStatsDiff
+
+// Report 一次重建的结果，Changed 只包含战绩发生变化的 Agent，
+// HistoryRewritten 为分数历史与重放结果不一致（需要或已经重写）的 Agent 数
+type Report struct {
+	DryRun           bool        `json:"dry_run"`
+	Battles          int         `json:"battles"`
+	Agents           int         `json:"agents"`
+	Changed          []AgentDiff `json:"changed"`
+	HistoryRewritten int         `json:"history_rewritten"`
+}
+
+// Rebuild 按战斗记录的先后顺序重放全部战斗，重新计算每个 Agent 的总战绩和 Elo 分数，
+// 并在一个事务内写回战绩，同时按重放结果重写与之不一致的 rating_history，使最后一条历史与 agents.rating 一致。
+// Elo 依赖对手当时的分数，因此即使只重建一个 Agent 也需要重放全部战斗。赛季战绩不在重建范围内。
+// 写回时先锁住要写回的 Agent，执行期间这些 Agent 的战斗结算和价格更新会等待；
+// dry run 在只读的可重复读事务中执行，不加锁
+func Rebuild(db *gorm.DB, opts Options) (*Report, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	report := &Report{DryRun: opts.DryRun, Changed: []AgentDiff{}}
+
+	txOpts := &sql.TxOptions{}
+	if opts.DryRun {
+		txOpts = &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var agents []models.Agent
+		query := tx.Order("id ASC")
+		if !opts.DryRun {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		if opts.AgentID != nil {
+			query = query.Where("id = ?", *opts.AgentID)
+		}
+		if err := query.Find(&agents).Error; err != nil {
+			return err
+		}
+		if opts.AgentID != nil && len(agents) == 0 {
+			return fmt.Errorf("%w: %d", ErrAgentNotFound, *opts.AgentID)
+		}
+		report.Agents = len(agents)
+
+		records := make(map[uint]*models.SeasonRecord)
+		history := make(map[uint][]models.RatingHistory)
+		var battles []models.Battle
+		result := tx.Preload("Participants").FindInBatches(&battles, opts.BatchSize, func(_ *gorm.DB, _ int) error {
+			for _, battle := range battles {
+				replay(records, history, battle)
+			}
+			report.Battles += len(battles)
+			return nil
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		for _, agent := range agents {
+			after := models.SeasonRecord{Rating: utils.DefaultRating}
+			if record, ok := records[agent.ID]; ok {
+				after = *record
+			}
+			before := models.SeasonRecord{
+				Total:   agent.Total,
+				Wins:    agent.Wins,
+				Losses:  agent.Losses,
+				Draws:   agent.Draws,
+				WinRate: agent.WinRate,
+				Rating:  agent.Rating,
+			}
+			if !changed(before, after) {
+				continue
+			}
+			report.Changed = append(report.Changed, AgentDiff{AgentID: agent.ID, Name: agent.Name, Before: before, After: after})
+		}
+
+		stale, err := staleHistory(tx, opts.AgentID, agents, history)
+		if err != nil {
+			return fmt.Errorf("compare rating history: %w", err)
+		}
+		report.HistoryRewritten = len(stale)
+
+		if opts.DryRun {
+			return nil
+		}
+		// 只更新战绩列，不覆盖价格等其他字段
+		for _, diff := range report.Changed {
+			if err := tx.Model(&models.Agent{}).Where("id = ?", diff.AgentID).Updates(map[string]interface{}{
+				"total":    diff.After.Total,
+				"wins":     diff.After.Wins,
+				"losses":   diff.After.Losses,
+				"draws":    diff.After.Draws,
+				"win_rate": diff.After.WinRate,
+				"rating":   diff.After.Rating,
+			}).Error; err != nil {
+				return fmt.Errorf("update agent %d: %w", diff.AgentID, err)
+			}
+		}
+		for _, agentID := range stale {
+			if err := tx.Where("agent_id = ?", agentID).Delete(&models.RatingHistory{}).Error; err != nil {
+				return fmt.Errorf("delete rating history of agent %d: %w", agentID, err)
+			}
+			if rows := history[agentID]; len(rows) > 0 {
+				if err := tx.CreateInBatches(rows, opts.BatchSize).Error; err != nil {
+					return fmt.Errorf("rewrite rating history of agent %d: %w", agentID, err)
+				}
+			}
+		}
+		return nil
+	}, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// staleHistory 返回 agents 中 rating_history 与重放结果不一致的 Agent，按 ID 顺序
+func staleHistory(tx *gorm.DB, agentID *uint, agents []models.Agent, replayed map[uint][]models.RatingHistory) ([]uint, error) {
+	existing := make(map[uint][]models.RatingHistory, len(agents))
+	query := tx.Model(&models.RatingHistory{})
+	if agentID != nil {
+		query = query.Where("agent_id = ?", *agentID)
+	}
+	var rows []models.RatingHistory
+	err := query.FindInBatches(&rows, DefaultBatchSize, func(_ *gorm.DB, _ int) error {
+		for _, row := range rows {
+			existing[row.AgentID] = append(existing[row.AgentID], row)
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var stale []uint
+	for _, agent := range agents {
+		// 重放按战斗 ID 顺序进行，历史按相同顺序比较
+		rows := existing[agent.ID]
+		slices.SortStableFunc(rows, func(a, b models.RatingHistory) int { return cmp.Compare(a.BattleID, b.BattleID) })
+		if !sameHistory(rows, replayed[agent.ID]) {
+			stale = append(stale, agent.ID)
+		}
+	}
+	return stale, nil
+}
+
+// sameHistory 两份分数历史是否对应相同的战斗和分数
+func sameHistory(a, b []models.RatingHistory) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].BattleID != b[i].BattleID ||
+			math.Abs(a[i].OldRating-b[i].OldRating) > ratingEpsilon ||
+			math.Abs(a[i].NewRating-b[i].NewRating) > ratingEpsilon {
+			return false
+		}
+	}
+	return true
+}
+
+// replay 把一场战斗计入 records 和 history，规则与战斗结算一致：团队战中每名成员按对方队伍的平均分数计算 Elo 变化
+func replay(records map[uint]*models.SeasonRecord, history map[uint][]models.RatingHistory, battle models.Battle) {
+	record := func(agentID uint) *models.SeasonRecord {
+		r, ok := records[agentID]
+		if !ok {
+			r = &models.SeasonRecord{Rating: utils.DefaultRating}
+			records[agentID] = r
+		}
+		return r
+	}
+
+	// 参战者表之前的战斗没有补齐参战记录时，退回到双方队长
+	participants := battle.Participants
+	if len(participants) == 0 {
+		participants = []models.BattleParticipant{
+			{AgentID: battle.AttackerID, Side: models.SideAttacker},
+			{AgentID: battle.DefenderID, Side: models.SideDefender},
+		}
+	}
+	type member struct {
+		agentID uint
+		record  *models.SeasonRecord
+	}
+	sides := map[string][]member{}
+	for _, participant := range participants {
+		sides[participant.Side] = append(sides[participant.Side], member{participant.AgentID, record(participant.AgentID)})
+	}
+	attackers, defenders := sides[models.SideAttacker], sides[models.SideDefender]
+	if len(attackers) == 0 || len(defenders) == 0 {
+		return
+	}
+
+	var attackerScore float64
+	switch {
+	case battle.Outcome.AttackerWon():
+		attackerScore = 1
+	case battle.Outcome.DefenderWon():
+	default:
+		attackerScore = 0.5
+	}
+
+	average := func(team []member) float64 {
+		var sum float64
+		for _, m := range team {
+			sum += m.record.Rating
+		}
+		return sum / float64(len(team))
+	}
+	attackerAvg, defenderAvg := average(attackers), average(defenders)
+	for _, side := range []struct {
+		members     []member
+		score       float64
+		opponentAvg float64
+	}{
+		{attackers, attackerScore, defenderAvg},
+		{defenders, 1 - attackerScore, attackerAvg},
+	} {
+		for _, m := range side.members {
+			oldRating := m.record.Rating
+			m.record.Rating += utils.EloDelta(oldRating, side.opponentAvg, side.score, battle.Outcome.Decisive())
+			m.record.Record(side.score)
+			history[m.agentID] = append(history[m.agentID], models.RatingHistory{
+				AgentID:   m.agentID,
+				BattleID:  battle.ID,
+				OldRating: oldRating,
+				NewRating: m.record.Rating,
+				Delta:     m.record.Rating - oldRating,
+				CreatedAt: battle.CreatedAt,
+			})
+		}
+	}
+}
+
+func changed(before, after models.SeasonRecord) bool {
+	return before.Total != after.Total ||
+		before.Wins != after.Wins ||
+		before.Losses != after.Losses ||
+		before.Draws != after.Draws ||
+		math.Abs(before.WinRate-after.WinRate) > ratingEpsilon ||
+		math.Abs(before.Rating-after.Rating) > ratingEpsilon
+}
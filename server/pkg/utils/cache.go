@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// TTLCache 带过期时间的内存缓存，可并发使用
+type TTLCache[V any] struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]ttlEntry[V]
+}
+
+type ttlEntry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// NewTTLCache 创建缓存，ttl 不大于 0 时不缓存任何内容
+func NewTTLCache[V any](ttl time.Duration) *TTLCache[V] {
+	return &TTLCache[V]{ttl: ttl, entries: make(map[string]ttlEntry[V])}
+}
+
+// Get 返回未过期的缓存值
+func (c *TTLCache[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		var zero V
+		return zero, false
+	}
+	return entry.value, true
+}
+
+// Set 写入缓存值
+func (c *TTLCache[V]) Set(key string, value V) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = ttlEntry[V]{value: value, expiresAt: time.Now().Add(c.ttl)}
+}
+
+// Purge 清空缓存
+func (c *TTLCache[V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]ttlEntry[V])
+}
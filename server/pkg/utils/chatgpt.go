@@ -3,10 +3,15 @@ package utils
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/models"
 )
 
 type ChatGPTRequest struct {
@@ -92,38 +97,287 @@ func GenerateDescription(apiKey, endpoint, name, prompt string) (string, error)
 	return chatResp.Choices[0].Message.Content, nil
 }
 
-// GenerateBattleOutcome 评估玩家对战的结果
-func GenerateBattleOutcome(apiKey, endpoint, attName, attPrompt, defName, defPrompt string) (string, error) {
-	client := &http.Client{Timeout: 30 * time.Second}
-	requestBody := map[string]interface{}{
-		"model": "gpt-4o", // 或 "gpt-4"（如果有权限）
-		"messages": []map[string]string{
-			{
-				"role": "system",
-				"content": fmt.Sprintf(`You're a game system tasked with determining the outcome of battles in a player-vs-player arena featuring user-generated AI agents. Your role is to evaluate agents fairly and impartially, based only on the provided prompts, ensuring outcomes reflect their described abilities and how they might interact in an encounter.
-																Analyze the following agents:
+// ErrInvalidVerdict 裁判返回的内容无法解析或未通过校验
+var ErrInvalidVerdict = errors.New("invalid battle verdict")
+
+// BattleVerdict 裁判返回的结构化判决
+type BattleVerdict struct {
+	Outcome   models.BattleOutcome `json:"outcome"`
+	Margin    int                  `json:"margin"`
+	Narrative string               `json:"narrative"`
+	Reasoning string               `json:"reasoning"`
+}
+
+// DecisiveMargin 压倒性结果（TOTAL_VICTORY / CRUSHING_DEFEAT）要求的最小差距，小于该值为险胜
+const DecisiveMargin = 50
+
+// maxNarrativeLength 战斗故事的最大长度（字符）
+const maxNarrativeLength = 280
+
+// battleVerdictSchema OpenAI structured outputs 使用的 JSON Schema
+var battleVerdictSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"outcome": map[string]interface{}{
+			"type": "string",
+			"enum": models.JudgeOutcomes,
+		},
+		"margin": map[string]interface{}{
+			"type":        "integer",
+			"description": "How decisive the result was, from 0 (coin flip) to 100 (complete domination).",
+		},
+		"narrative": map[string]interface{}{
+			"type":        "string",
+			"description": "The battle story, under 280 characters.",
+		},
+		"reasoning": map[string]interface{}{
+			"type":        "string",
+			"description": "Short explanation of why the abilities led to this outcome.",
+		},
+	},
+	"required":             []string{"outcome", "margin", "narrative", "reasoning"},
+	"additionalProperties": false,
+}
+
+// Validate 校验判决内容
+func (v *BattleVerdict) Validate() error {
+	if !slices.Contains(models.JudgeOutcomes, v.Outcome) {
+		return fmt.Errorf("%w: unknown outcome %q", ErrInvalidVerdict, v.Outcome)
+	}
+	if v.Margin < 0 || v.Margin > 100 {
+		return fmt.Errorf("%w: margin %d out of range", ErrInvalidVerdict, v.Margin)
+	}
+	if v.Outcome.Decisive() != (v.Margin >= DecisiveMargin) {
+		return fmt.Errorf("%w: margin %d does not match outcome %s", ErrInvalidVerdict, v.Margin, v.Outcome)
+	}
+	v.Narrative = strings.TrimSpace(v.Narrative)
+	if v.Narrative == "" {
+		return fmt.Errorf("%w: empty narrative", ErrInvalidVerdict)
+	}
+	if runes := []rune(v.Narrative); len(runes) > maxNarrativeLength {
+		v.Narrative = string(runes[:maxNarrativeLength])
+	}
+	v.Reasoning = strings.TrimSpace(v.Reasoning)
+	return nil
+}
+
+// JudgeOptions 裁判调用使用的模型参数
+type JudgeOptions struct {
+	Model       string
+	Temperature float64
+}
+
+// Combatant 参战的一个 Agent
+type Combatant struct {
+	Name   string
+	Prompt string
+}
+
+// battleMatchup 生成裁判提示词中描述双方的部分，1v1 保持原有格式，多人对战按队伍列出
+func battleMatchup(attackers, defenders []Combatant) string {
+	if len(attackers) == 1 && len(defenders) == 1 {
+		return fmt.Sprintf(`Analyze the following agents:
 																- Attacker Agent Name: %s
 																- Attacker Agent Prompt: %s
 																- Defender Agent Name: %s
 																- Defender Agent Prompt: %s
+`, attackers[0].Name, attackers[0].Prompt, defenders[0].Name, defenders[0].Prompt)
+	}
+
+	var b strings.Builder
+	b.WriteString("This is a team battle. The Attacker and the Defender below are teams; judge each team as a whole, considering how its members' abilities combine, support each other and cover each other's weaknesses.\n")
+	for _, side := range []struct {
+		name    string
+		members []Combatant
+	}{{"Attacker", attackers}, {"Defender", defenders}} {
+		fmt.Fprintf(&b, "%s team (%d agents):\n", side.name, len(side.members))
+		for i, member := range side.members {
+			fmt.Fprintf(&b, "- %s Agent %d Name: %s\n- %s Agent %d Prompt: %s\n", side.name, i+1, member.Name, side.name, i+1, member.Prompt)
+		}
+	}
+	b.WriteString("In the narrative, mention every agent's name.\n")
+	return b.String()
+}
+
+// BattleRoundResult 多回合战斗中单个回合的结果
+type BattleRoundResult struct {
+	Narrative      string `json:"narrative"`
+	AttackerPoints int    `json:"attacker_points"`
+	DefenderPoints int    `json:"defender_points"`
+}
+
+// maxRoundPoints 单个回合中一方最多得到的分数
+const maxRoundPoints = 10
+
+// battleRoundSchema 回合结果的 JSON Schema
+var battleRoundSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"narrative": map[string]interface{}{
+			"type":        "string",
+			"description": "What happened in this round, under 280 characters.",
+		},
+		"attacker_points": map[string]interface{}{
+			"type":        "integer",
+			"description": "Points the Attacker earned this round, from 0 to 10.",
+		},
+		"defender_points": map[string]interface{}{
+			"type":        "integer",
+			"description": "Points the Defender earned this round, from 0 to 10.",
+		},
+	},
+	"required":             []string{"narrative", "attacker_points", "defender_points"},
+	"additionalProperties": false,
+}
+
+// Validate 校验回合内容
+func (r *BattleRoundResult) Validate() error {
+	if r.AttackerPoints < 0 || r.AttackerPoints > maxRoundPoints || r.DefenderPoints < 0 || r.DefenderPoints > maxRoundPoints {
+		return fmt.Errorf("%w: round points %d-%d out of range", ErrInvalidVerdict, r.AttackerPoints, r.DefenderPoints)
+	}
+	r.Narrative = strings.TrimSpace(r.Narrative)
+	if r.Narrative == "" {
+		return fmt.Errorf("%w: empty round narrative", ErrInvalidVerdict)
+	}
+	if runes := []rune(r.Narrative); len(runes) > maxNarrativeLength {
+		r.Narrative = string(runes[:maxNarrativeLength])
+	}
+	return nil
+}
+
+// battleTranscript 把已完成的回合写成提示词，没有回合时返回空字符串
+func battleTranscript(rounds []BattleRoundResult) string {
+	if len(rounds) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("Rounds fought so far:\n")
+	for i, round := range rounds {
+		fmt.Fprintf(&b, "- Round %d (Attacker %d, Defender %d): %s\n", i+1, round.AttackerPoints, round.DefenderPoints, round.Narrative)
+	}
+	return b.String()
+}
+
+// GenerateBattleRound 生成多回合战斗中的第 round 回合（从 1 开始），previous 为之前的回合
+func GenerateBattleRound(apiKey, endpoint string, opts JudgeOptions, attackers, defenders []Combatant, round, totalRounds int, previous []BattleRoundResult) (*BattleRoundResult, error) {
+	if len(attackers) == 0 || len(defenders) == 0 {
+		return nil, fmt.Errorf("both sides need at least one agent")
+	}
+
+	requestBody := map[string]interface{}{
+		"model":       opts.Model,
+		"temperature": opts.Temperature,
+		"messages": []map[string]string{
+			{
+				"role": "system",
+				"content": fmt.Sprintf(`You're a game system narrating a battle in a player-vs-player arena featuring user-generated AI agents. The battle is fought over %d rounds and you are narrating round %d. Evaluate the agents fairly and impartially, based only on the provided prompts.
+																%s
+																%s
+																Output Instructions:
+																Set "narrative" to what happens in round %d, under 280 characters, continuing from the earlier rounds.
+																	- Base the exchange entirely on the interaction of abilities; avoid assumptions based on names.
+																	- Do not decide the whole battle; describe only this round.
+																Set "attacker_points" and "defender_points" from 0 to 10 to score how well each side did this round.
+																`, totalRounds, round, battleMatchup(attackers, defenders), battleTranscript(previous), round),
+			},
+		},
+		"response_format": map[string]interface{}{
+			"type": "json_schema",
+			"json_schema": map[string]interface{}{
+				"name":   "battle_round",
+				"strict": true,
+				"schema": battleRoundSchema,
+			},
+		},
+		"max_tokens": 1000,
+	}
+
+	content, err := structuredCompletion(apiKey, endpoint, requestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	var result BattleRoundResult
+	if err := json.Unmarshal([]byte(content), &result); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidVerdict, err)
+	}
+	if err := result.Validate(); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GenerateBattleOutcome 评估玩家对战的结果，返回结构化判决。每一方可以是单个 Agent 或一支队伍，
+// 多回合战斗通过 rounds 传入全部回合，判决以回合记录为依据
+func GenerateBattleOutcome(apiKey, endpoint string, opts JudgeOptions, attackers, defenders []Combatant, rounds []BattleRoundResult) (*BattleVerdict, error) {
+	if len(attackers) == 0 || len(defenders) == 0 {
+		return nil, fmt.Errorf("both sides need at least one agent")
+	}
+
+	transcript := ""
+	if len(rounds) > 0 {
+		transcript = battleTranscript(rounds) + "The battle is over. Base the final verdict on how the rounds went, and let the narrative describe how the battle ended.\n"
+	}
 
+	requestBody := map[string]interface{}{
+		"model":       opts.Model,
+		"temperature": opts.Temperature,
+		"messages": []map[string]string{
+			{
+				"role": "system",
+				"content": fmt.Sprintf(`You're a game system tasked with determining the outcome of battles in a player-vs-player arena featuring user-generated AI agents. Your role is to evaluate agents fairly and impartially, based only on the provided prompts, ensuring outcomes reflect their described abilities and how they might interact in an encounter.
+																%s
+																%s
 																Output Instructions:
-																Begin by stating the Attack Outcome:
-																	- “Total Victory!” for clear domination by the Attacker.
-																	- “Narrow Victory!” for a slight edge to the Attacker.
-																	- “Narrow Defeat!” for a slight edge to the Defender.
-																	- “Crushing Defeat!” for clear domination by the Defender.
-																Craft a story under 280 characters, reflecting the battle and its outcome.
+																Set "outcome" to one of:
+																	- TOTAL_VICTORY for clear domination by the Attacker.
+																	- NARROW_VICTORY for a slight edge to the Attacker.
+																	- NARROW_DEFEAT for a slight edge to the Defender.
+																	- CRUSHING_DEFEAT for clear domination by the Defender.
+																Set "margin" from 0 to 100: below %d for narrow results, %d or above for total victories and crushing defeats.
+																Set "narrative" to a story under 280 characters, reflecting the battle and its outcome.
 																	- Mention both names but base the narrative entirely on the interaction of abilities.
 																	- Avoid directly describing their abilities; focus on the imaginative depiction of how the battle unfolded.
 																	- Avoid assumptions or biases based on names; rely only on logical implications of abilities.
 																	- Ensure the outcome aligns with how one ability counters, overpowers, or is neutralized by another.
-																`, attName, attPrompt, defName, defPrompt),
+																Set "reasoning" to one or two sentences explaining the decision.
+																`, battleMatchup(attackers, defenders), transcript, DecisiveMargin, DecisiveMargin),
+			},
+		},
+		"response_format": map[string]interface{}{
+			"type": "json_schema",
+			"json_schema": map[string]interface{}{
+				"name":   "battle_verdict",
+				"strict": true,
+				"schema": battleVerdictSchema,
 			},
 		},
 		"max_tokens": 1000, // todo: 需要根据实际情况调整
 	}
 
+	content, err := structuredCompletion(apiKey, endpoint, requestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	var verdict BattleVerdict
+	if err := json.Unmarshal([]byte(content), &verdict); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidVerdict, err)
+	}
+	if err := verdict.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &verdict, nil
+}
+
+// CompletionTimeout 单次回合或判决请求的超时时间
+const CompletionTimeout = 30 * time.Second
+
+// structuredCompletion 发送使用 structured outputs 的请求并返回消息内容，模型拒绝回答时返回 ErrInvalidVerdict
+func structuredCompletion(apiKey, endpoint string, requestBody map[string]interface{}) (string, error) {
+	client := &http.Client{Timeout: CompletionTimeout}
+
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
 		return "", err
@@ -148,6 +402,10 @@ func GenerateBattleOutcome(apiKey, endpoint, attName, attPrompt, defName, defPro
 		return "", err
 	}
 
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("battle outcome request failed, status: %s, body: %s", resp.Status, string(bodyBytes))
+	}
+
 	// 解析响应
 	var chatResp struct {
 		ID      string `json:"id"`
@@ -158,6 +416,7 @@ func GenerateBattleOutcome(apiKey, endpoint, attName, attPrompt, defName, defPro
 			Message struct {
 				Role    string `json:"role"`
 				Content string `json:"content"`
+				Refusal string `json:"refusal"`
 			} `json:"message"`
 			FinishReason string `json:"finish_reason"`
 		} `json:"choices"`
@@ -171,5 +430,9 @@ func GenerateBattleOutcome(apiKey, endpoint, attName, attPrompt, defName, defPro
 		return "", fmt.Errorf("no battle outcome generated")
 	}
 
-	return chatResp.Choices[0].Message.Content, nil
+	message := chatResp.Choices[0].Message
+	if message.Refusal != "" {
+		return "", fmt.Errorf("%w: judge refused: %s", ErrInvalidVerdict, message.Refusal)
+	}
+	return message.Content, nil
 }
@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/models"
+)
+
+func TestBattleVerdictValidateMarginBands(t *testing.T) {
+	tests := []struct {
+		outcome models.BattleOutcome
+		margin  int
+		valid   bool
+	}{
+		{models.OutcomeTotalVictory, DecisiveMargin, true},
+		{models.OutcomeTotalVictory, DecisiveMargin - 1, false},
+		{models.OutcomeCrushingDefeat, 100, true},
+		{models.OutcomeCrushingDefeat, 10, false},
+		{models.OutcomeNarrowVictory, DecisiveMargin - 1, true},
+		{models.OutcomeNarrowVictory, DecisiveMargin, false},
+		{models.OutcomeNarrowDefeat, 0, true},
+		{models.OutcomeNarrowDefeat, 90, false},
+	}
+	for _, tt := range tests {
+		v := BattleVerdict{Outcome: tt.outcome, Margin: tt.margin, Narrative: "A fight."}
+		err := v.Validate()
+		if tt.valid && err != nil {
+			t.Errorf("%s with margin %d: unexpected error %v", tt.outcome, tt.margin, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidVerdict) {
+			t.Errorf("%s with margin %d: err = %v, want ErrInvalidVerdict", tt.outcome, tt.margin, err)
+		}
+	}
+}
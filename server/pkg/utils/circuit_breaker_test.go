@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	b := NewCircuitBreaker(3, time.Hour)
+	for i := 0; i < 2; i++ {
+		if !b.Allow() {
+			t.Fatalf("request %d rejected before the threshold", i+1)
+		}
+		b.Failure()
+	}
+	if b.State() != BreakerClosed {
+		t.Fatalf("state = %s after 2 failures, want closed", b.State())
+	}
+
+	// 成功会清零连续失败次数
+	b.Success()
+	b.Failure()
+	b.Failure()
+	if b.State() != BreakerClosed {
+		t.Fatalf("state = %s, want closed after a success reset the count", b.State())
+	}
+	b.Failure()
+	if b.State() != BreakerOpen {
+		t.Fatalf("state = %s after 3 consecutive failures, want open", b.State())
+	}
+	if b.Allow() {
+		t.Error("open breaker allowed a request during the cooldown")
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbe(t *testing.T) {
+	const cooldown = 20 * time.Millisecond
+	b := NewCircuitBreaker(1, cooldown)
+	b.Failure()
+	if b.State() != BreakerOpen {
+		t.Fatalf("state = %s, want open", b.State())
+	}
+	time.Sleep(2 * cooldown)
+	if b.State() != BreakerHalfOpen {
+		t.Fatalf("state = %s after the cooldown, want half_open", b.State())
+	}
+
+	// 熔断期结束后只放行一个试探请求
+	if !b.Allow() {
+		t.Fatal("probe rejected after the cooldown")
+	}
+	if b.Allow() {
+		t.Error("second request allowed while the probe is in flight")
+	}
+
+	// 试探失败再次熔断
+	b.Failure()
+	if b.State() != BreakerOpen || b.Allow() {
+		t.Fatalf("state = %s, want open again after a failed probe", b.State())
+	}
+
+	// 试探成功恢复
+	time.Sleep(2 * cooldown)
+	if !b.Allow() {
+		t.Fatal("probe rejected after the second cooldown")
+	}
+	b.Success()
+	if b.State() != BreakerClosed {
+		t.Fatalf("state = %s after a successful probe, want closed", b.State())
+	}
+	for i := 0; i < 3; i++ {
+		if !b.Allow() {
+			t.Errorf("closed breaker rejected request %d", i+1)
+		}
+	}
+}
+
+func TestCircuitBreakerAbortReleasesProbe(t *testing.T) {
+	const cooldown = 20 * time.Millisecond
+	b := NewCircuitBreaker(1, cooldown)
+	b.Failure()
+	time.Sleep(2 * cooldown)
+	if !b.Allow() {
+		t.Fatal("probe rejected after the cooldown")
+	}
+	// 放弃的试探不计入成败，下一个请求可以重新试探
+	b.Abort()
+	if b.State() != BreakerHalfOpen {
+		t.Errorf("state = %s after an aborted probe, want half_open", b.State())
+	}
+	if !b.Allow() {
+		t.Error("new probe rejected after the previous one was aborted")
+	}
+}
@@ -1,194 +1,438 @@
 package utils
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
-	"log"
 	"math"
 	"net/http"
+	"net/url"
+	"os"
 	"strings"
+	"sync"
+	"time"
 )
 
-type ApiResponse struct {
-	Data      map[string]TokenData `json:"data"`
-	TimeTaken float64              `json:"timeTaken"`
+// SOLMint Wrapped SOL 的 mint 地址，作为 vsToken 时返回以 SOL 计价的价格
+const SOLMint = "So11111111111111111111111111111111111111112"
+
+// PriceProvider 批量获取代币价格。vsToken 为空时以 USD 计价。
+// 部分代币没有取到价格时返回其余代币的价格和 TokenPriceErrors
+type PriceProvider interface {
+	GetPrices(ctx context.Context, mints []string, vsToken string) (map[string]float64, error)
 }
 
-type TokenData struct {
-	ID    string      `json:"id"`
-	Type  string      `json:"type"`
-	Price json.Number `json:"price"`
+// ErrNoPrice 价格来源没有该代币的报价
+var ErrNoPrice = errors.New("no price available")
+
+// TokenPriceErrors 部分代币没有取到价格时 GetPrices 返回的错误，键为 mint 地址。
+// 此时返回的价格仍然可用，可以用 PartialPriceErrors 判断
+type TokenPriceErrors map[string]error
+
+func (e TokenPriceErrors) Error() string {
+	return fmt.Sprintf("failed to get prices of %d tokens", len(e))
 }
 
-// GetTokenPrice 根据给定的 tokenAddress 从外部服务获取市值（价格）
-func GetTokenPrice(tokenAddress string) (float64, error) {
-	if tokenAddress == "" {
-		return 0, errors.New("tokenAddress is empty")
+// PartialPriceErrors 判断 GetPrices 的错误是否只涉及部分代币
+func PartialPriceErrors(err error) (TokenPriceErrors, bool) {
+	var partial TokenPriceErrors
+	if errors.As(err, &partial) {
+		return partial, true
 	}
+	return nil, false
+}
 
-	resp, err := http.Get(fmt.Sprintf("https://api.jup.ag/price/v2?ids=%s", tokenAddress))
-	if err != nil {
-		log.Printf("Failed to send GET request: %v", err)
-		return 0, err
-	}
-	defer resp.Body.Close()
+// 支持的价格来源
+const (
+	PriceProviderJupiter   = "jupiter"
+	PriceProviderFake      = "fake"
+	PriceProviderReplay    = "replay"
+	PriceProviderComposite = "composite"
+)
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("Failed to read response body: %v", err)
-		return 0, err
+// 组合价格来源中可用的来源
+const (
+	PriceSourceJupiter     = "jupiter"
+	PriceSourceDexScreener = "dexscreener"
+	PriceSourcePumpFun     = "pumpfun"
+)
+
+// PriceProviderOptions 创建价格来源的参数
+type PriceProviderOptions struct {
+	Kind        string        // jupiter, fake, replay, composite
+	BaseURL     string        // Jupiter Price API 地址
+	Timeout     time.Duration // 单次请求的超时时间
+	ChunkSize   int           // 每次请求的代币数
+	Concurrency int           // 同时进行的请求数
+	ReplayFile  string        // replay 使用的脚本文件
+	// composite 使用的来源（按优先级排列）及各来源的参数
+	Sources          []string
+	DexScreenerURL   string
+	RPCEndpoint      string // 读取 pump.fun 联合曲线的 Solana RPC
+	PumpProgramID    string
+	BreakerThreshold int           // 连续失败多少次后熔断
+	BreakerCooldown  time.Duration // 熔断时长
+}
+
+// NewPriceProvider 按配置创建价格来源
+func NewPriceProvider(opts PriceProviderOptions) (PriceProvider, error) {
+	switch opts.Kind {
+	case PriceProviderJupiter:
+		return NewJupiterPriceProvider(opts.BaseURL, opts.Timeout, opts.ChunkSize, opts.Concurrency), nil
+	case PriceProviderFake:
+		return NewFakePriceProvider(), nil
+	case PriceProviderReplay:
+		return LoadReplayPriceProvider(opts.ReplayFile)
+	case PriceProviderComposite:
+		return newCompositeFromOptions(opts)
+	default:
+		return nil, fmt.Errorf("unknown price provider %q", opts.Kind)
 	}
+}
 
-	var apiResponse ApiResponse
-	err = json.Unmarshal(body, &apiResponse)
-	if err != nil {
-		log.Printf("Failed to parse JSON: %v", err)
-		return 0, err
+// newCompositeFromOptions 按 opts.Sources 的顺序组合价格来源。
+// 联合曲线的 USD 价格需要 SOL/USD 价格，由其余 HTTP 来源提供，共用同一组熔断器
+func newCompositeFromOptions(opts PriceProviderOptions) (*CompositePriceProvider, error) {
+	var sources, httpSources []*PriceSource
+	var curve *BondingCurvePriceProvider
+	for _, name := range opts.Sources {
+		var provider PriceProvider
+		switch name {
+		case PriceSourceJupiter:
+			provider = NewJupiterPriceProvider(opts.BaseURL, opts.Timeout, opts.ChunkSize, opts.Concurrency)
+		case PriceSourceDexScreener:
+			provider = NewDexScreenerPriceProvider(opts.DexScreenerURL, opts.Timeout, opts.Concurrency)
+		case PriceSourcePumpFun:
+			reader, err := NewBondingCurveReader(opts.RPCEndpoint, opts.PumpProgramID)
+			if err != nil {
+				return nil, err
+			}
+			curve = NewBondingCurvePriceProvider(reader, nil, opts.Concurrency)
+			provider = curve
+		default:
+			return nil, fmt.Errorf("unknown price source %q", name)
+		}
+		source := NewPriceSource(name, provider, NewCircuitBreaker(opts.BreakerThreshold, opts.BreakerCooldown))
+		sources = append(sources, source)
+		if name != PriceSourcePumpFun {
+			httpSources = append(httpSources, source)
+		}
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no price sources configured")
 	}
+	if curve != nil && len(httpSources) > 0 {
+		curve.solUSD = NewCompositePriceProvider(httpSources...)
+	}
+	return NewCompositePriceProvider(sources...), nil
+}
 
-	priceStr := apiResponse.Data[tokenAddress].Price
-	priceVal, err := priceStr.Float64()
-	if err != nil {
-		log.Printf("Failed to convert gabbyPriceStr to float64: %v", err)
-		return 0, err
+// roundPrice 以 SOL 计价的价格保留 10 位小数，其他保留 7 位
+func roundPrice(price float64, vsToken string) float64 {
+	if vsToken == SOLMint {
+		return math.Round(price*1e10) / 1e10
 	}
+	return math.Round(price*1e7) / 1e7
+}
 
-	// 将结果四舍五入到小数点后 7 位
-	priceVal = math.Round(priceVal*1e7) / 1e7
+// Jupiter Price API 请求的默认分片参数
+const (
+	DefaultPriceChunkSize   = 100 // Jupiter 单次请求最多支持的代币数
+	DefaultPriceConcurrency = 4
+)
 
-	return priceVal, nil
+// JupiterPriceProvider 通过 Jupiter Price API v2 获取价格。代币按 chunkSize 分片并发请求，
+// 单个分片或单个代币失败只影响对应的代币
+type JupiterPriceProvider struct {
+	baseURL     string
+	client      *http.Client
+	chunkSize   int
+	concurrency int
 }
 
-// GetTokenPrice 根据给定的 tokenAddress 从外部服务获取市值（价格）
-func GetTokenVsSOLPrice(tokenAddress string) (float64, error) {
-	if tokenAddress == "" {
-		return 0, errors.New("tokenAddress is empty")
+// NewJupiterPriceProvider 创建 Jupiter 价格来源，timeout 为单次请求的超时时间，
+// chunkSize、concurrency 不大于 0 时使用默认值
+func NewJupiterPriceProvider(baseURL string, timeout time.Duration, chunkSize, concurrency int) *JupiterPriceProvider {
+	if chunkSize <= 0 {
+		chunkSize = DefaultPriceChunkSize
 	}
-
-	resp, err := http.Get(fmt.Sprintf("https://api.jup.ag/price/v2?ids=%s&vsToken=So11111111111111111111111111111111111111112", tokenAddress))
-	if err != nil {
-		log.Printf("Failed to send GET request: %v", err)
-		return 0, err
+	if concurrency <= 0 {
+		concurrency = DefaultPriceConcurrency
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("Failed to read response body: %v", err)
-		return 0, err
+	return &JupiterPriceProvider{
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		client:      &http.Client{Timeout: timeout},
+		chunkSize:   chunkSize,
+		concurrency: concurrency,
 	}
+}
 
-	var apiResponse ApiResponse
-	err = json.Unmarshal(body, &apiResponse)
-	if err != nil {
-		log.Printf("Failed to parse JSON: %v", err)
-		return 0, err
-	}
+// jupiterPriceResponse 每个代币单独解析，避免一个异常的报价导致整批失败
+type jupiterPriceResponse struct {
+	Data      map[string]json.RawMessage `json:"data"`
+	TimeTaken float64                    `json:"timeTaken"`
+}
 
-	priceStr := apiResponse.Data[tokenAddress].Price
-	priceVal, err := priceStr.Float64()
-	if err != nil {
-		log.Printf("Failed to convert gabbyPriceStr to float64: %v", err)
-		return 0, err
+type jupiterTokenPrice struct {
+	ID    string      `json:"id"`
+	Type  string      `json:"type"`
+	Price json.Number `json:"price"`
+}
+
+// GetPrices 实现 PriceProvider
+func (p *JupiterPriceProvider) GetPrices(ctx context.Context, mints []string, vsToken string) (map[string]float64, error) {
+	return fetchInChunks(ctx, mints, p.chunkSize, p.concurrency, func(ctx context.Context, chunk []string) (map[string]float64, TokenPriceErrors, error) {
+		return p.fetchChunk(ctx, chunk, vsToken)
+	})
+}
+
+// chunkFetcher 请求一个分片的价格，返回的 error 表示整个分片失败
+type chunkFetcher func(ctx context.Context, chunk []string) (map[string]float64, TokenPriceErrors, error)
+
+// fetchInChunks 把代币按 chunkSize 分片，最多 concurrency 个分片并发请求。
+// 部分代币失败时返回其余代币的价格和 TokenPriceErrors，所有分片都失败时返回第一个错误
+func fetchInChunks(ctx context.Context, mints []string, chunkSize, concurrency int, fetch chunkFetcher) (map[string]float64, error) {
+	mints = uniqueMints(mints)
+	prices := make(map[string]float64, len(mints))
+	if len(mints) == 0 {
+		return prices, nil
 	}
 
-	// 将结果四舍五入到小数点后 10 位
-	priceVal = math.Round(priceVal*1e10) / 1e10
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		failures  = make(TokenPriceErrors)
+		firstErr  error
+		succeeded bool
+	)
+	sem := make(chan struct{}, concurrency)
+	for start := 0; start < len(mints); start += chunkSize {
+		chunk := mints[start:min(start+chunkSize, len(mints))]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			chunkPrices, chunkFailures, err := fetch(ctx, chunk)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				for _, mint := range chunk {
+					failures[mint] = err
+				}
+				return
+			}
+			succeeded = true
+			for mint, price := range chunkPrices {
+				prices[mint] = price
+			}
+			for mint, err := range chunkFailures {
+				failures[mint] = err
+			}
+		}()
+	}
+	wg.Wait()
 
-	return priceVal, nil
+	if !succeeded {
+		return nil, firstErr
+	}
+	if len(failures) > 0 {
+		return prices, failures
+	}
+	return prices, nil
 }
 
-// GetMultipleTokenPrice 根据给定的 tokenAddresses 从外部服务获取多个代币的市值（价格）
-func GetMultipleTokenPrice(tokenAddresses []string) (map[string]float64, error) {
-	if len(tokenAddresses) == 0 {
-		return nil, errors.New("tokenAddresses is empty")
+// fetchChunk 请求一个分片的价格，返回的 error 表示整个分片失败
+func (p *JupiterPriceProvider) fetchChunk(ctx context.Context, mints []string, vsToken string) (map[string]float64, TokenPriceErrors, error) {
+	query := url.Values{"ids": {strings.Join(mints, ",")}}
+	if vsToken != "" {
+		query.Set("vsToken", vsToken)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	resp, err := http.Get(fmt.Sprintf("https://api.jup.ag/price/v2?ids=%s", strings.Join(tokenAddresses, ",")))
+	resp, err := p.client.Do(req)
 	if err != nil {
-		log.Printf("Failed to send GET request: %v", err)
-		return nil, err
+		return nil, nil, fmt.Errorf("request jupiter prices: %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Printf("Failed to read response body: %v", err)
-		return nil, err
+		return nil, nil, fmt.Errorf("read jupiter response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("jupiter price request failed, status: %s, body: %s", resp.Status, string(body))
 	}
 
-	var apiResponse ApiResponse
-	err = json.Unmarshal(body, &apiResponse)
-	if err != nil {
-		log.Printf("Failed to parse JSON: %v", err)
-		return nil, err
+	var parsed jupiterPriceResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, nil, fmt.Errorf("parse jupiter response: %w", err)
 	}
 
-	prices := make(map[string]float64)
-	for _, tokenAddress := range tokenAddresses {
-		priceStr := apiResponse.Data[tokenAddress].Price
-		priceVal, err := priceStr.Float64()
+	prices := make(map[string]float64, len(mints))
+	failures := make(TokenPriceErrors)
+	for _, mint := range mints {
+		raw := parsed.Data[mint]
+		if len(raw) == 0 || string(raw) == "null" {
+			failures[mint] = ErrNoPrice
+			continue
+		}
+		var data jupiterTokenPrice
+		if err := json.Unmarshal(raw, &data); err != nil {
+			failures[mint] = fmt.Errorf("parse price: %w", err)
+			continue
+		}
+		if data.Price == "" {
+			failures[mint] = ErrNoPrice
+			continue
+		}
+		price, err := data.Price.Float64()
 		if err != nil {
-			log.Printf("Failed to convert priceStr to float64 for token %s: %v", tokenAddress, err)
-			return nil, err
+			failures[mint] = fmt.Errorf("parse price: %w", err)
+			continue
 		}
+		prices[mint] = roundPrice(price, vsToken)
+	}
+	return prices, failures, nil
+}
 
-		// 将结果四舍五入到小数点后 7 位
-		priceVal = math.Round(priceVal*1e7) / 1e7
-
-		prices[tokenAddress] = priceVal
+// uniqueMints 去掉空地址和重复地址，保持原有顺序
+func uniqueMints(mints []string) []string {
+	seen := make(map[string]bool, len(mints))
+	unique := make([]string, 0, len(mints))
+	for _, mint := range mints {
+		if mint == "" || seen[mint] {
+			continue
+		}
+		seen[mint] = true
+		unique = append(unique, mint)
 	}
+	return unique
+}
 
-	return prices, nil
+// FakePriceProvider 离线使用的确定性价格来源：同一个 mint 总是返回同一个价格，可以用 Set 覆盖
+type FakePriceProvider struct {
+	mu        sync.RWMutex
+	overrides map[string]float64
 }
 
-// GetMultipleTokenVsSOLPrice 根据给定的 tokenAddresses 从外部服务获取多个代币相对于 SOL 的价格
-func GetMultipleTokenVsSOLPrice(tokenAddresses []string) (map[string]float64, error) {
-	if len(tokenAddresses) == 0 {
-		return nil, errors.New("tokenAddresses is empty")
-	}
+// NewFakePriceProvider 创建确定性价格来源
+func NewFakePriceProvider() *FakePriceProvider {
+	return &FakePriceProvider{overrides: make(map[string]float64)}
+}
 
-	url := fmt.Sprintf(
-		"https://api.jup.ag/price/v2?ids=%s&vsToken=So11111111111111111111111111111111111111112",
-		strings.Join(tokenAddresses, ","),
-	)
+// Set 指定某个 mint 的价格（与 vsToken 无关），价格不大于 0 时返回 ErrNoPrice
+func (p *FakePriceProvider) Set(mint string, price float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.overrides[mint] = price
+}
 
-	resp, err := http.Get(url)
-	if err != nil {
-		log.Printf("Failed to send GET request: %v", err)
+// GetPrices 实现 PriceProvider
+func (p *FakePriceProvider) GetPrices(ctx context.Context, mints []string, vsToken string) (map[string]float64, error) {
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	prices := make(map[string]float64, len(mints))
+	failures := make(TokenPriceErrors)
+	for _, mint := range mints {
+		if mint == "" {
+			continue
+		}
+		if price, ok := p.overrides[mint]; ok {
+			if price > 0 {
+				prices[mint] = price
+			} else {
+				failures[mint] = ErrNoPrice
+			}
+			continue
+		}
+		// 由 mint 的哈希得到 1e-8 到 1e-5 之间的价格
+		h := fnv.New32a()
+		h.Write([]byte(vsToken + ":" + mint))
+		prices[mint] = roundPrice(float64(h.Sum32()%1000+1)*1e-8, vsToken)
+	}
+	if len(failures) > 0 {
+		return prices, failures
+	}
+	return prices, nil
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("Failed to read response body: %v", err)
-		return nil, err
+// PriceSnapshot replay 脚本中的一步，VsToken 为空表示 USD 计价
+type PriceSnapshot struct {
+	VsToken string             `json:"vs_token"`
+	Prices  map[string]float64 `json:"prices"`
+}
+
+// ReplayPriceProvider 按脚本依次返回价格快照，每种 vsToken 单独计数，脚本结束后重复最后一步
+type ReplayPriceProvider struct {
+	mu    sync.Mutex
+	steps map[string][]PriceSnapshot
+	next  map[string]int
+}
+
+// NewReplayPriceProvider 用给定的快照创建 replay 价格来源
+func NewReplayPriceProvider(snapshots []PriceSnapshot) *ReplayPriceProvider {
+	p := &ReplayPriceProvider{steps: make(map[string][]PriceSnapshot), next: make(map[string]int)}
+	for _, snapshot := range snapshots {
+		p.steps[snapshot.VsToken] = append(p.steps[snapshot.VsToken], snapshot)
 	}
+	return p
+}
 
-	var apiResponse ApiResponse
-	err = json.Unmarshal(body, &apiResponse)
+// LoadReplayPriceProvider 从 JSON 文件（PriceSnapshot 数组）加载 replay 脚本
+func LoadReplayPriceProvider(path string) (*ReplayPriceProvider, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		log.Printf("Failed to parse JSON: %v", err)
+		return nil, fmt.Errorf("read price replay file: %w", err)
+	}
+	var snapshots []PriceSnapshot
+	if err := json.Unmarshal(data, &snapshots); err != nil {
+		return nil, fmt.Errorf("parse price replay file: %w", err)
+	}
+	return NewReplayPriceProvider(snapshots), nil
+}
+
+// GetPrices 实现 PriceProvider
+func (p *ReplayPriceProvider) GetPrices(ctx context.Context, mints []string, vsToken string) (map[string]float64, error) {
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	prices := make(map[string]float64)
-	for _, tokenAddress := range tokenAddresses {
-		priceStr := apiResponse.Data[tokenAddress].Price
-		priceVal, err := priceStr.Float64()
-		if err != nil {
-			log.Printf("Failed to convert priceStr to float64 for token %s: %v", tokenAddress, err)
-			return nil, err
+	steps := p.steps[vsToken]
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("no replay prices for vsToken %q", vsToken)
+	}
+	i := min(p.next[vsToken], len(steps)-1)
+	p.next[vsToken] = i + 1
+
+	prices := make(map[string]float64, len(mints))
+	failures := make(TokenPriceErrors)
+	for _, mint := range mints {
+		if price, ok := steps[i].Prices[mint]; ok {
+			prices[mint] = price
+		} else {
+			failures[mint] = ErrNoPrice
 		}
-
-		// 将结果四舍五入到小数点后 10 位
-		priceVal = math.Round(priceVal*1e10) / 1e10
-
-		prices[tokenAddress] = priceVal
 	}
-
+	if len(failures) > 0 {
+		return prices, failures
+	}
 	return prices, nil
 }
@@ -0,0 +1,207 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/logger"
+	"go.uber.org/zap"
+)
+
+// PriceQuote 缓存返回的价格。Stale 表示最近一次向上游刷新失败，Price 为最后一次成功获取的价格
+type PriceQuote struct {
+	Price     float64
+	Stale     bool
+	UpdatedAt time.Time
+}
+
+// PriceCache 进程内共享的价格缓存：
+//   - 价格在 ttl 内直接返回；
+//   - 过期后先返回旧价格，同时在后台刷新（stale-while-revalidate）；
+//   - 没有缓存的代币合并成一次批量请求，同一代币的并发查询共享一次上游调用；
+//   - 上游不可用时返回最后一次成功的价格并标记为 Stale
+type PriceCache struct {
+	upstream PriceProvider
+	ttl      time.Duration
+
+	mu       sync.Mutex
+	entries  map[string]*priceEntry
+	inflight map[string]*priceCall
+}
+
+type priceEntry struct {
+	price     float64
+	ok        bool      // 是否曾成功获取到价格
+	stale     bool      // 最近一次刷新是否失败
+	updatedAt time.Time // 最近一次成功获取价格的时间
+	checkedAt time.Time // 最近一次向上游查询的时间，无论成败
+}
+
+// priceCall 一次正在进行的上游批量请求
+type priceCall struct {
+	done chan struct{}
+}
+
+// NewPriceCache 创建价格缓存，ttl 为价格被视为新鲜的时长
+func NewPriceCache(upstream PriceProvider, ttl time.Duration) *PriceCache {
+	return &PriceCache{
+		upstream: upstream,
+		ttl:      ttl,
+		entries:  make(map[string]*priceEntry),
+		inflight: make(map[string]*priceCall),
+	}
+}
+
+func priceKey(mint, vsToken string) string {
+	return vsToken + ":" + mint
+}
+
+// ErrStalePrice 最近一次向上游刷新失败，缓存中只有旧价格或没有价格
+var ErrStalePrice = errors.New("price is stale")
+
+// GetPrices 实现 PriceProvider，只返回新鲜的价格：刷新失败的代币返回 ErrStalePrice，
+// 没有报价的代币返回 ErrNoPrice，二者都在 TokenPriceErrors 中报告
+func (c *PriceCache) GetPrices(ctx context.Context, mints []string, vsToken string) (map[string]float64, error) {
+	quotes := c.Quotes(ctx, mints, vsToken)
+	prices := make(map[string]float64, len(quotes))
+	failures := make(TokenPriceErrors)
+	for _, mint := range mints {
+		if mint == "" {
+			continue
+		}
+		quote, ok := quotes[mint]
+		switch {
+		case ok && !quote.Stale:
+			prices[mint] = quote.Price
+		case ok:
+			failures[mint] = ErrStalePrice
+		case ctx.Err() != nil:
+			// 等待进行中的请求时被取消
+			failures[mint] = ctx.Err()
+		default:
+			failures[mint] = ErrNoPrice
+		}
+	}
+	if len(failures) > 0 {
+		return prices, failures
+	}
+	return prices, nil
+}
+
+// Quotes 返回代币价格，不会因上游故障失败：从未获取成功的代币在上游故障时返回价格为 0 的 Stale 报价，
+// 上游确认没有报价的代币不出现在结果中
+func (c *PriceCache) Quotes(ctx context.Context, mints []string, vsToken string) map[string]PriceQuote {
+	now := time.Now()
+	var missing, expired []string
+	var waits []*priceCall
+
+	c.mu.Lock()
+	for _, mint := range mints {
+		if mint == "" {
+			continue
+		}
+		key := priceKey(mint, vsToken)
+		entry := c.entries[key]
+		if entry != nil && now.Sub(entry.checkedAt) < c.ttl {
+			continue
+		}
+		if call := c.inflight[key]; call != nil {
+			// 已有缓存时直接返回旧价格，否则等待进行中的请求
+			if entry == nil {
+				waits = append(waits, call)
+			}
+			continue
+		}
+		if entry == nil {
+			missing = append(missing, mint)
+		} else {
+			expired = append(expired, mint)
+		}
+	}
+	syncCall := c.startCall(missing, vsToken)
+	asyncCall := c.startCall(expired, vsToken)
+	c.mu.Unlock()
+
+	if asyncCall != nil {
+		go c.fetch(context.Background(), asyncCall, expired, vsToken)
+	}
+	if syncCall != nil {
+		// 结果由所有等待者共享，不随单个请求取消
+		c.fetch(context.WithoutCancel(ctx), syncCall, missing, vsToken)
+	}
+	for _, call := range waits {
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	quotes := make(map[string]PriceQuote, len(mints))
+	for _, mint := range mints {
+		entry := c.entries[priceKey(mint, vsToken)]
+		if entry == nil || (!entry.ok && !entry.stale) {
+			continue
+		}
+		quotes[mint] = PriceQuote{Price: entry.price, Stale: entry.stale, UpdatedAt: entry.updatedAt}
+	}
+	return quotes
+}
+
+// startCall 为一批代币登记进行中的请求，调用方需持有锁
+func (c *PriceCache) startCall(mints []string, vsToken string) *priceCall {
+	if len(mints) == 0 {
+		return nil
+	}
+	call := &priceCall{done: make(chan struct{})}
+	for _, mint := range mints {
+		c.inflight[priceKey(mint, vsToken)] = call
+	}
+	return call
+}
+
+// fetch 向上游批量请求价格并写入缓存。上游确认没有报价的代币清空价格；
+// 请求失败的代币保留旧价格并标记为 Stale，ttl 内不再重试
+func (c *PriceCache) fetch(ctx context.Context, call *priceCall, mints []string, vsToken string) {
+	prices, err := c.upstream.GetPrices(ctx, mints, vsToken)
+	failures, partial := PartialPriceErrors(err)
+	if err != nil && !partial {
+		// 整批失败时所有代币都按失败处理
+		failures = make(TokenPriceErrors, len(mints))
+		for _, mint := range mints {
+			failures[mint] = err
+		}
+	}
+	if err != nil {
+		logger.Logger.Warn("Failed to refresh token prices, serving last known prices",
+			zap.Int("tokens", len(mints)),
+			zap.Int("failed", len(failures)),
+			zap.String("vsToken", vsToken),
+			zap.Error(err))
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, mint := range mints {
+		key := priceKey(mint, vsToken)
+		entry := c.entries[key]
+		if entry == nil {
+			entry = &priceEntry{}
+			c.entries[key] = entry
+		}
+		entry.checkedAt = now
+		if price, ok := prices[mint]; ok {
+			*entry = priceEntry{price: price, ok: true, updatedAt: now, checkedAt: now}
+		} else if failure := failures[mint]; failure == nil || errors.Is(failure, ErrNoPrice) {
+			*entry = priceEntry{checkedAt: now}
+		} else {
+			entry.stale = true
+		}
+		delete(c.inflight, key)
+	}
+	close(call.done)
+}
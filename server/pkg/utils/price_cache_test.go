@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GabbyWorld/all-time-high-backend/internal/logger"
+	"go.uber.org/zap"
+)
+
+// gatedPriceProvider 在 release 关闭前阻塞每次请求，并统计请求次数
+type gatedPriceProvider struct {
+	stubPriceProvider
+	release chan struct{}
+	started atomic.Int32
+}
+
+func (p *gatedPriceProvider) GetPrices(ctx context.Context, mints []string, vsToken string) (map[string]float64, error) {
+	p.started.Add(1)
+	<-p.release
+	return p.stubPriceProvider.GetPrices(ctx, mints, vsToken)
+}
+
+// set 修改 stub 的价格和错误，err 为 nil 时恢复正常
+func (p *stubPriceProvider) set(mint string, price float64, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.prices == nil {
+		p.prices = make(map[string]float64)
+	}
+	p.prices[mint] = price
+	p.err = err
+}
+
+func newTestPriceCache(upstream PriceProvider, ttl time.Duration) *PriceCache {
+	if logger.Logger == nil {
+		logger.Logger = zap.NewNop()
+	}
+	return NewPriceCache(upstream, ttl)
+}
+
+// waitFor 轮询 cond 直到成立，超时后测试失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPriceCacheTTLAndStaleWhileRevalidate(t *testing.T) {
+	const ttl = 50 * time.Millisecond
+	upstream := &stubPriceProvider{prices: map[string]float64{"a": 1}}
+	c := newTestPriceCache(upstream, ttl)
+	ctx := context.Background()
+
+	if quote := c.Quotes(ctx, []string{"a"}, "")["a"]; quote.Price != 1 || quote.Stale {
+		t.Fatalf("first quote = %+v, want 1", quote)
+	}
+	upstream.set("a", 2, nil)
+	if quote := c.Quotes(ctx, []string{"a"}, "")["a"]; quote.Price != 1 {
+		t.Errorf("quote within the ttl = %+v, want the cached 1", quote)
+	}
+	if got := len(upstream.requested()); got != 1 {
+		t.Fatalf("upstream requested %d times within the ttl, want 1", got)
+	}
+
+	// 过期后先返回旧价格，后台刷新完成后返回新价格
+	time.Sleep(2 * ttl)
+	if quote := c.Quotes(ctx, []string{"a"}, "")["a"]; quote.Price != 1 || quote.Stale {
+		t.Errorf("expired quote = %+v, want the old price while revalidating", quote)
+	}
+	waitFor(t, "the background refresh", func() bool {
+		return c.Quotes(ctx, []string{"a"}, "")["a"].Price == 2
+	})
+	if got := len(upstream.requested()); got != 2 {
+		t.Errorf("upstream requested %d times, want 2", got)
+	}
+}
+
+func TestPriceCacheCoalescesConcurrentMisses(t *testing.T) {
+	upstream := &gatedPriceProvider{
+		stubPriceProvider: stubPriceProvider{prices: map[string]float64{"a": 3}},
+		release:           make(chan struct{}),
+	}
+	c := newTestPriceCache(upstream, time.Hour)
+
+	const callers = 10
+	var wg sync.WaitGroup
+	quotes := make([]PriceQuote, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			quotes[i] = c.Quotes(context.Background(), []string{"a"}, "")["a"]
+		}(i)
+	}
+	waitFor(t, "the upstream request", func() bool { return upstream.started.Load() > 0 })
+	close(upstream.release)
+	wg.Wait()
+
+	if got := upstream.started.Load(); got != 1 {
+		t.Errorf("upstream requested %d times, want 1 shared request", got)
+	}
+	for i, quote := range quotes {
+		if quote.Price != 3 {
+			t.Errorf("caller %d got %+v, want 3", i, quote)
+		}
+	}
+}
+
+func TestPriceCacheStaleOnUpstreamFailure(t *testing.T) {
+	const ttl = 20 * time.Millisecond
+	upstream := &stubPriceProvider{prices: map[string]float64{"a": 1}}
+	c := newTestPriceCache(upstream, ttl)
+	ctx := context.Background()
+	c.Quotes(ctx, []string{"a"}, "")
+
+	// 上游故障后返回最后一次成功的价格并标记为 Stale
+	upstream.set("a", 5, errors.New("connection refused"))
+	time.Sleep(2 * ttl)
+	c.Quotes(ctx, []string{"a"}, "")
+	waitFor(t, "the failed refresh", func() bool {
+		return c.Quotes(ctx, []string{"a"}, "")["a"].Stale
+	})
+	quote := c.Quotes(ctx, []string{"a", "b"}, "")
+	if quote["a"].Price != 1 {
+		t.Errorf("stale quote = %+v, want the last known price 1", quote["a"])
+	}
+	// 从未取到价格的代币返回价格为 0 的 Stale 报价
+	if q, ok := quote["b"]; !ok || !q.Stale || q.Price != 0 {
+		t.Errorf("quote of never fetched b = %+v (%v), want a stale zero quote", q, ok)
+	}
+
+	// GetPrices 不返回旧价格或 0，而是报告失败
+	prices, err := c.GetPrices(ctx, []string{"a", "b"}, "")
+	partial, ok := PartialPriceErrors(err)
+	if !ok {
+		t.Fatalf("err = %v, want TokenPriceErrors", err)
+	}
+	if len(prices) != 0 {
+		t.Errorf("prices = %v, want none while the upstream is down", prices)
+	}
+	for _, mint := range []string{"a", "b"} {
+		if !errors.Is(partial[mint], ErrStalePrice) {
+			t.Errorf("error of %s = %v, want ErrStalePrice", mint, partial[mint])
+		}
+	}
+
+	// 上游恢复后清除 Stale；上游确认没有报价的代币返回 ErrNoPrice
+	upstream.set("a", 5, nil)
+	time.Sleep(2 * ttl)
+	waitFor(t, "the recovered refresh", func() bool {
+		q := c.Quotes(ctx, []string{"a"}, "")["a"]
+		return q.Price == 5 && !q.Stale
+	})
+	time.Sleep(2 * ttl)
+	prices, err = c.GetPrices(ctx, []string{"a", "c"}, "")
+	partial, _ = PartialPriceErrors(err)
+	if prices["a"] != 5 {
+		t.Errorf("price of a = %v, want 5", prices["a"])
+	}
+	if !errors.Is(partial["c"], ErrNoPrice) {
+		t.Errorf("error of c = %v, want ErrNoPrice", partial["c"])
+	}
+}
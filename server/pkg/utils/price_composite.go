@@ -0,0 +1,194 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// healthAlpha 健康分数的平滑系数，越大越看重最近的请求
+const healthAlpha = 0.2
+
+// PriceSource 组合价格来源中的一个来源，带熔断器和健康统计
+type PriceSource struct {
+	Name     string
+	Provider PriceProvider
+	breaker  *CircuitBreaker
+
+	mu     sync.Mutex
+	health SourceHealth
+}
+
+// SourceHealth 价格来源的健康状况。Score 为请求成功率的指数加权平均（0-1）
+type SourceHealth struct {
+	Name          string     `json:"name"`
+	State         string     `json:"state"`
+	Score         float64    `json:"score"`
+	Requests      int64      `json:"requests"`
+	Failures      int64      `json:"failures"`
+	LatencyMs     float64    `json:"latency_ms"` // 平均耗时的指数加权平均
+	LastError     string     `json:"last_error,omitempty"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+	LastFailureAt *time.Time `json:"last_failure_at,omitempty"`
+}
+
+// NewPriceSource 创建价格来源
+func NewPriceSource(name string, provider PriceProvider, breaker *CircuitBreaker) *PriceSource {
+	return &PriceSource{
+		Name:     name,
+		Provider: provider,
+		breaker:  breaker,
+		health:   SourceHealth{Name: name, Score: 1},
+	}
+}
+
+// record 记录一次请求的结果
+func (s *PriceSource) record(latency time.Duration, err error) {
+	if err != nil {
+		s.breaker.Failure()
+	} else {
+		s.breaker.Success()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	outcome := 1.0
+	if err != nil {
+		outcome = 0
+		s.health.Failures++
+		s.health.LastError = err.Error()
+		s.health.LastFailureAt = &now
+	} else {
+		s.health.LastSuccessAt = &now
+	}
+	ms := float64(latency) / float64(time.Millisecond)
+	if s.health.Requests == 0 {
+		s.health.LatencyMs = ms
+	} else {
+		s.health.LatencyMs += healthAlpha * (ms - s.health.LatencyMs)
+	}
+	s.health.Requests++
+	s.health.Score += healthAlpha * (outcome - s.health.Score)
+}
+
+// Health 返回来源当前的健康状况
+func (s *PriceSource) Health() SourceHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	health := s.health
+	health.State = s.breaker.State()
+	return health
+}
+
+// SourcedPriceProvider 能报告每个价格来自哪个来源的 PriceProvider
+type SourcedPriceProvider interface {
+	PriceProvider
+	GetPricesWithSources(ctx context.Context, mints []string, vsToken string) (map[string]float64, map[string]string, error)
+}
+
+// GetPricesWithSources 获取价格及其来源，provider 不能报告来源时来源为空
+func GetPricesWithSources(ctx context.Context, provider PriceProvider, mints []string, vsToken string) (map[string]float64, map[string]string, error) {
+	if sourced, ok := provider.(SourcedPriceProvider); ok {
+		return sourced.GetPricesWithSources(ctx, mints, vsToken)
+	}
+	prices, err := provider.GetPrices(ctx, mints, vsToken)
+	return prices, map[string]string{}, err
+}
+
+// CompositePriceProvider 按优先级依次尝试多个价格来源：前一个来源没有取到的代币交给下一个来源，
+// 熔断中的来源直接跳过。所有来源都整体失败时返回最后一个错误
+type CompositePriceProvider struct {
+	sources []*PriceSource
+}
+
+// NewCompositePriceProvider 创建组合价格来源，sources 按优先级从高到低排列
+func NewCompositePriceProvider(sources ...*PriceSource) *CompositePriceProvider {
+	return &CompositePriceProvider{sources: sources}
+}
+
+// GetPrices 实现 PriceProvider
+func (p *CompositePriceProvider) GetPrices(ctx context.Context, mints []string, vsToken string) (map[string]float64, error) {
+	prices, _, err := p.GetPricesWithSources(ctx, mints, vsToken)
+	return prices, err
+}
+
+// GetPricesWithSources 实现 SourcedPriceProvider
+func (p *CompositePriceProvider) GetPricesWithSources(ctx context.Context, mints []string, vsToken string) (map[string]float64, map[string]string, error) {
+	remaining := uniqueMints(mints)
+	prices := make(map[string]float64, len(remaining))
+	sources := make(map[string]string, len(remaining))
+	failures := make(TokenPriceErrors)
+	if len(remaining) == 0 {
+		return prices, sources, nil
+	}
+
+	var lastErr error
+	succeeded := false
+	for _, source := range p.sources {
+		if len(remaining) == 0 {
+			break
+		}
+		if !source.breaker.Allow() {
+			lastErr = fmt.Errorf("%s: circuit open", source.Name)
+			continue
+		}
+
+		start := time.Now()
+		got, err := source.Provider.GetPrices(ctx, remaining, vsToken)
+		if ctx.Err() != nil {
+			// 调用方取消不计入来源的健康统计
+			source.breaker.Abort()
+			return nil, nil, ctx.Err()
+		}
+		partial, isPartial := PartialPriceErrors(err)
+		if err != nil && !isPartial {
+			source.record(time.Since(start), err)
+			lastErr = fmt.Errorf("%s: %w", source.Name, err)
+			for _, mint := range remaining {
+				failures[mint] = lastErr
+			}
+			continue
+		}
+		source.record(time.Since(start), nil)
+		succeeded = true
+
+		var next []string
+		for _, mint := range remaining {
+			if price, ok := got[mint]; ok {
+				prices[mint] = price
+				sources[mint] = source.Name
+				delete(failures, mint)
+				continue
+			}
+			reason := partial[mint]
+			if reason == nil {
+				reason = ErrNoPrice
+			}
+			failures[mint] = fmt.Errorf("%s: %w", source.Name, reason)
+			next = append(next, mint)
+		}
+		remaining = next
+	}
+
+	if !succeeded {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no price sources configured")
+		}
+		return nil, nil, lastErr
+	}
+	if len(failures) > 0 {
+		return prices, sources, failures
+	}
+	return prices, sources, nil
+}
+
+// Health 按优先级返回各来源的健康状况
+func (p *CompositePriceProvider) Health() []SourceHealth {
+	health := make([]SourceHealth, len(p.sources))
+	for i, source := range p.sources {
+		health[i] = source.Health()
+	}
+	return health
+}
@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubPriceProvider 返回固定价格的价格来源，err 不为空时整体失败，并记录每次请求的代币
+type stubPriceProvider struct {
+	mu     sync.Mutex
+	prices map[string]float64
+	err    error
+	calls  [][]string
+}
+
+func (p *stubPriceProvider) GetPrices(ctx context.Context, mints []string, vsToken string) (map[string]float64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, append([]string(nil), mints...))
+	if p.err != nil {
+		return nil, p.err
+	}
+	prices := make(map[string]float64)
+	failures := make(TokenPriceErrors)
+	for _, mint := range mints {
+		if price, ok := p.prices[mint]; ok {
+			prices[mint] = price
+		} else {
+			failures[mint] = ErrNoPrice
+		}
+	}
+	if len(failures) > 0 {
+		return prices, failures
+	}
+	return prices, nil
+}
+
+func (p *stubPriceProvider) requested() [][]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls
+}
+
+func TestCompositePriceProviderFallsBackInOrder(t *testing.T) {
+	primary := &stubPriceProvider{prices: map[string]float64{"a": 1}}
+	secondary := &stubPriceProvider{prices: map[string]float64{"a": 10, "b": 2}}
+	tertiary := &stubPriceProvider{prices: map[string]float64{"c": 3}}
+	p := NewCompositePriceProvider(
+		NewPriceSource("primary", primary, NewCircuitBreaker(3, time.Minute)),
+		NewPriceSource("secondary", secondary, NewCircuitBreaker(3, time.Minute)),
+		NewPriceSource("tertiary", tertiary, NewCircuitBreaker(3, time.Minute)),
+	)
+
+	prices, sources, err := p.GetPricesWithSources(context.Background(), []string{"a", "b", "c", "d"}, "")
+	partial, ok := PartialPriceErrors(err)
+	if !ok {
+		t.Fatalf("err = %v, want TokenPriceErrors", err)
+	}
+	want := map[string]struct {
+		price  float64
+		source string
+	}{"a": {1, "primary"}, "b": {2, "secondary"}, "c": {3, "tertiary"}}
+	for mint, w := range want {
+		if prices[mint] != w.price || sources[mint] != w.source {
+			t.Errorf("%s = %v from %q, want %v from %q", mint, prices[mint], sources[mint], w.price, w.source)
+		}
+	}
+	if !errors.Is(partial["d"], ErrNoPrice) {
+		t.Errorf("error of d = %v, want ErrNoPrice", partial["d"])
+	}
+	if len(partial) != 1 {
+		t.Errorf("failures = %v, want only d", partial)
+	}
+
+	// 后面的来源只请求前面来源没有取到的代币
+	if got := secondary.requested(); len(got) != 1 || len(got[0]) != 3 {
+		t.Errorf("secondary requested %v, want b, c and d", got)
+	}
+	if got := tertiary.requested(); len(got) != 1 || len(got[0]) != 2 {
+		t.Errorf("tertiary requested %v, want c and d", got)
+	}
+}
+
+func TestCompositePriceProviderSkipsFailingSources(t *testing.T) {
+	down := &stubPriceProvider{err: errors.New("connection refused")}
+	backup := &stubPriceProvider{prices: map[string]float64{"a": 1}}
+	downSource := NewPriceSource("down", down, NewCircuitBreaker(2, time.Hour))
+	p := NewCompositePriceProvider(downSource, NewPriceSource("backup", backup, NewCircuitBreaker(2, time.Hour)))
+
+	for i := 0; i < 3; i++ {
+		prices, sources, err := p.GetPricesWithSources(context.Background(), []string{"a"}, "")
+		if err != nil {
+			t.Fatalf("GetPricesWithSources: %v", err)
+		}
+		if prices["a"] != 1 || sources["a"] != "backup" {
+			t.Errorf("a = %v from %q, want 1 from backup", prices["a"], sources["a"])
+		}
+	}
+	// 连续失败 2 次后熔断，第三次不再请求
+	if got := len(down.requested()); got != 2 {
+		t.Errorf("failing source requested %d times, want 2", got)
+	}
+	health := downSource.Health()
+	if health.State != BreakerOpen || health.Failures != 2 || health.LastError == "" {
+		t.Errorf("health = %+v, want an open breaker after 2 failures", health)
+	}
+}
+
+func TestCompositePriceProviderAllSourcesFail(t *testing.T) {
+	p := NewCompositePriceProvider(
+		NewPriceSource("first", &stubPriceProvider{err: errors.New("first down")}, NewCircuitBreaker(5, time.Minute)),
+		NewPriceSource("second", &stubPriceProvider{err: errors.New("second down")}, NewCircuitBreaker(5, time.Minute)),
+	)
+	prices, sources, err := p.GetPricesWithSources(context.Background(), []string{"a"}, "")
+	if err == nil || prices != nil || sources != nil {
+		t.Fatalf("GetPricesWithSources = (%v, %v, %v), want an error", prices, sources, err)
+	}
+	if _, ok := PartialPriceErrors(err); ok {
+		t.Errorf("err = %v, want a whole-request failure", err)
+	}
+}
+
+func TestGetPricesWithSourcesPlainProvider(t *testing.T) {
+	prices, sources, err := GetPricesWithSources(context.Background(), &stubPriceProvider{prices: map[string]float64{"a": 1}}, []string{"a"}, "")
+	if err != nil || prices["a"] != 1 || len(sources) != 0 {
+		t.Errorf("GetPricesWithSources = (%v, %v, %v), want a price without sources", prices, sources, err)
+	}
+}
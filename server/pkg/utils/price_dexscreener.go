@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dexScreenerChunkSize DexScreener 单次请求最多支持的代币数
+const dexScreenerChunkSize = 30
+
+// DexScreenerPriceProvider 通过 DexScreener 的交易对数据获取价格，同一代币取流动性最高的交易对。
+// 只支持 USD 和 SOL 计价，SOL 价格来自以 SOL 为报价币的交易对
+type DexScreenerPriceProvider struct {
+	baseURL     string
+	client      *http.Client
+	concurrency int
+}
+
+// NewDexScreenerPriceProvider 创建 DexScreener 价格来源，concurrency 不大于 0 时使用默认值
+func NewDexScreenerPriceProvider(baseURL string, timeout time.Duration, concurrency int) *DexScreenerPriceProvider {
+	if concurrency <= 0 {
+		concurrency = DefaultPriceConcurrency
+	}
+	return &DexScreenerPriceProvider{
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		client:      &http.Client{Timeout: timeout},
+		concurrency: concurrency,
+	}
+}
+
+type dexScreenerPair struct {
+	BaseToken struct {
+		Address string `json:"address"`
+	} `json:"baseToken"`
+	QuoteToken struct {
+		Address string `json:"address"`
+	} `json:"quoteToken"`
+	PriceNative string `json:"priceNative"`
+	PriceUSD    string `json:"priceUsd"`
+	Liquidity   *struct {
+		USD float64 `json:"usd"`
+	} `json:"liquidity"`
+}
+
+// GetPrices 实现 PriceProvider
+func (p *DexScreenerPriceProvider) GetPrices(ctx context.Context, mints []string, vsToken string) (map[string]float64, error) {
+	if vsToken != "" && vsToken != SOLMint {
+		return nil, fmt.Errorf("dexscreener does not support vsToken %s", vsToken)
+	}
+	return fetchInChunks(ctx, mints, dexScreenerChunkSize, p.concurrency, func(ctx context.Context, chunk []string) (map[string]float64, TokenPriceErrors, error) {
+		return p.fetchChunk(ctx, chunk, vsToken)
+	})
+}
+
+// fetchChunk 请求一个分片的交易对，返回的 error 表示整个分片失败
+func (p *DexScreenerPriceProvider) fetchChunk(ctx context.Context, mints []string, vsToken string) (map[string]float64, TokenPriceErrors, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/tokens/v1/solana/"+strings.Join(mints, ","), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("request dexscreener pairs: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read dexscreener response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("dexscreener request failed, status: %s, body: %s", resp.Status, string(body))
+	}
+
+	var pairs []dexScreenerPair
+	if err := json.Unmarshal(body, &pairs); err != nil {
+		return nil, nil, fmt.Errorf("parse dexscreener response: %w", err)
+	}
+
+	requested := make(map[string]bool, len(mints))
+	for _, mint := range mints {
+		requested[mint] = true
+	}
+	prices := make(map[string]float64, len(mints))
+	liquidity := make(map[string]float64, len(mints))
+	for _, pair := range pairs {
+		mint := pair.BaseToken.Address
+		if !requested[mint] {
+			continue
+		}
+		raw := pair.PriceUSD
+		if vsToken == SOLMint {
+			if pair.QuoteToken.Address != SOLMint {
+				continue
+			}
+			raw = pair.PriceNative
+		}
+		price, err := strconv.ParseFloat(raw, 64)
+		if err != nil || price <= 0 {
+			continue
+		}
+		var usd float64
+		if pair.Liquidity != nil {
+			usd = pair.Liquidity.USD
+		}
+		if _, seen := prices[mint]; !seen || usd > liquidity[mint] {
+			prices[mint] = roundPrice(price, vsToken)
+			liquidity[mint] = usd
+		}
+	}
+
+	failures := make(TokenPriceErrors)
+	for _, mint := range mints {
+		if _, ok := prices[mint]; !ok {
+			failures[mint] = ErrNoPrice
+		}
+	}
+	return prices, failures, nil
+}
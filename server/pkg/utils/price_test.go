@@ -0,0 +1,251 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newJupiterStub 模拟 Jupiter Price API，prices 中没有的代币返回 null，价格为空字符串的代币返回 null 价格，
+// fail 返回 true 的请求以 500 响应。返回每次请求的 ids
+func newJupiterStub(t *testing.T, prices map[string]string, fail func(ids []string) bool) (*httptest.Server, func() [][]string) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests [][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids := strings.Split(r.URL.Query().Get("ids"), ",")
+		mu.Lock()
+		requests = append(requests, ids)
+		mu.Unlock()
+		if fail != nil && fail(ids) {
+			http.Error(w, "upstream error", http.StatusInternalServerError)
+			return
+		}
+		data := make(map[string]interface{}, len(ids))
+		for _, id := range ids {
+			if price, ok := prices[id]; ok {
+				// 空字符串表示代币存在但没有报价
+				var value interface{}
+				if price != "" {
+					value = price
+				}
+				data[id] = map[string]interface{}{"id": id, "type": "derivedPrice", "price": value}
+			} else {
+				data[id] = nil
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data, "timeTaken": 0.01})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() [][]string {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+func TestJupiterPriceProviderChunksRequests(t *testing.T) {
+	srv, requests := newJupiterStub(t, map[string]string{"a": "1.5", "b": "2", "c": "0.25", "d": "4", "e": "5"}, nil)
+	p := NewJupiterPriceProvider(srv.URL, time.Second, 2, 2)
+
+	prices, err := p.GetPrices(context.Background(), []string{"a", "b", "c", "a", "", "d", "e"}, "")
+	if err != nil {
+		t.Fatalf("GetPrices: %v", err)
+	}
+	want := map[string]float64{"a": 1.5, "b": 2, "c": 0.25, "d": 4, "e": 5}
+	if len(prices) != len(want) {
+		t.Fatalf("prices = %v, want %v", prices, want)
+	}
+	for mint, price := range want {
+		if prices[mint] != price {
+			t.Errorf("price of %s = %v, want %v", mint, prices[mint], price)
+		}
+	}
+	// 去重并跳过空地址后 5 个代币分为 3 个请求，每个请求不超过 2 个代币
+	got := requests()
+	if len(got) != 3 {
+		t.Fatalf("requests = %v, want 3 chunks", got)
+	}
+	for _, ids := range got {
+		if len(ids) > 2 {
+			t.Errorf("chunk %v exceeds chunk size 2", ids)
+		}
+	}
+}
+
+func TestJupiterPriceProviderMissingTokens(t *testing.T) {
+	srv, _ := newJupiterStub(t, map[string]string{"a": "1", "b": ""}, nil)
+	p := NewJupiterPriceProvider(srv.URL, time.Second, 10, 1)
+
+	prices, err := p.GetPrices(context.Background(), []string{"a", "b", "c"}, SOLMint)
+	partial, ok := PartialPriceErrors(err)
+	if !ok {
+		t.Fatalf("err = %v, want TokenPriceErrors", err)
+	}
+	if prices["a"] != 1 {
+		t.Errorf("price of a = %v, want 1", prices["a"])
+	}
+	for _, mint := range []string{"b", "c"} {
+		if !errors.Is(partial[mint], ErrNoPrice) {
+			t.Errorf("error of %s = %v, want ErrNoPrice", mint, partial[mint])
+		}
+	}
+	if _, ok := partial["a"]; ok {
+		t.Errorf("a reported as failed: %v", partial["a"])
+	}
+}
+
+func TestJupiterPriceProviderStatusCodes(t *testing.T) {
+	srv, _ := newJupiterStub(t, map[string]string{"a": "1", "b": "2", "c": "3"}, func(ids []string) bool {
+		return ids[0] == "c"
+	})
+	p := NewJupiterPriceProvider(srv.URL, time.Second, 2, 1)
+
+	// 一个分片失败只影响该分片的代币
+	prices, err := p.GetPrices(context.Background(), []string{"a", "b", "c"}, "")
+	partial, ok := PartialPriceErrors(err)
+	if !ok {
+		t.Fatalf("err = %v, want TokenPriceErrors", err)
+	}
+	if prices["a"] != 1 || prices["b"] != 2 {
+		t.Errorf("prices = %v, want a and b", prices)
+	}
+	if partial["c"] == nil || !strings.Contains(partial["c"].Error(), "500") {
+		t.Errorf("error of c = %v, want the 500 status", partial["c"])
+	}
+
+	// 所有分片都失败时整体返回错误
+	prices, err = p.GetPrices(context.Background(), []string{"c"}, "")
+	if err == nil || prices != nil {
+		t.Fatalf("GetPrices = (%v, %v), want an error", prices, err)
+	}
+	if _, ok := PartialPriceErrors(err); ok {
+		t.Errorf("err = %v, want a whole-request failure", err)
+	}
+}
+
+// dexPair 构造 DexScreener 返回的交易对
+func dexPair(base, quote, priceUSD, priceNative string, liquidity float64) map[string]interface{} {
+	return map[string]interface{}{
+		"baseToken":   map[string]string{"address": base},
+		"quoteToken":  map[string]string{"address": quote},
+		"priceUsd":    priceUSD,
+		"priceNative": priceNative,
+		"liquidity":   map[string]float64{"usd": liquidity},
+	}
+}
+
+// newDexScreenerStub 模拟 DexScreener tokens 接口，status 不为 0 时以该状态码响应。返回每次请求的代币
+func newDexScreenerStub(t *testing.T, pairs map[string][]map[string]interface{}, status int) (*httptest.Server, func() [][]string) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests [][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mints := strings.Split(strings.TrimPrefix(r.URL.Path, "/tokens/v1/solana/"), ",")
+		mu.Lock()
+		requests = append(requests, mints)
+		mu.Unlock()
+		if status != 0 {
+			http.Error(w, "rate limited", status)
+			return
+		}
+		result := []map[string]interface{}{}
+		for _, mint := range mints {
+			result = append(result, pairs[mint]...)
+		}
+		json.NewEncoder(w).Encode(result)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() [][]string {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+func TestDexScreenerPriceProviderPicksLiquidPairs(t *testing.T) {
+	pairs := map[string][]map[string]interface{}{
+		"a": {
+			dexPair("a", "USDC", "1.0", "0.01", 100),
+			dexPair("a", SOLMint, "1.2", "0.008", 5000),
+		},
+		"b": {dexPair("b", "USDC", "3.0", "3.0", 10)},
+	}
+	srv, _ := newDexScreenerStub(t, pairs, 0)
+	p := NewDexScreenerPriceProvider(srv.URL, time.Second, 1)
+
+	prices, err := p.GetPrices(context.Background(), []string{"a", "b", "missing"}, "")
+	partial, ok := PartialPriceErrors(err)
+	if !ok {
+		t.Fatalf("err = %v, want TokenPriceErrors", err)
+	}
+	if prices["a"] != 1.2 || prices["b"] != 3 {
+		t.Errorf("USD prices = %v, want a from the most liquid pair and b", prices)
+	}
+	if !errors.Is(partial["missing"], ErrNoPrice) {
+		t.Errorf("error of missing = %v, want ErrNoPrice", partial["missing"])
+	}
+
+	// SOL 计价只使用以 SOL 为报价币的交易对
+	prices, err = p.GetPrices(context.Background(), []string{"a", "b"}, SOLMint)
+	partial, _ = PartialPriceErrors(err)
+	if prices["a"] != 0.008 {
+		t.Errorf("SOL price of a = %v, want 0.008", prices["a"])
+	}
+	if !errors.Is(partial["b"], ErrNoPrice) {
+		t.Errorf("error of b = %v, want ErrNoPrice without a SOL pair", partial["b"])
+	}
+
+	if _, err := p.GetPrices(context.Background(), []string{"a"}, "USDC"); err == nil {
+		t.Error("unsupported vsToken accepted")
+	}
+}
+
+func TestDexScreenerPriceProviderChunksRequests(t *testing.T) {
+	pairs := make(map[string][]map[string]interface{})
+	var mints []string
+	for i := 0; i < dexScreenerChunkSize+5; i++ {
+		mint := fmt.Sprintf("m%d", i)
+		mints = append(mints, mint)
+		pairs[mint] = []map[string]interface{}{dexPair(mint, "USDC", "1", "1", 1)}
+	}
+	srv, requests := newDexScreenerStub(t, pairs, 0)
+	p := NewDexScreenerPriceProvider(srv.URL, time.Second, 2)
+
+	prices, err := p.GetPrices(context.Background(), mints, "")
+	if err != nil {
+		t.Fatalf("GetPrices: %v", err)
+	}
+	if len(prices) != len(mints) {
+		t.Errorf("got %d prices, want %d", len(prices), len(mints))
+	}
+	got := requests()
+	if len(got) != 2 {
+		t.Fatalf("got %d requests, want 2", len(got))
+	}
+	for _, chunk := range got {
+		if len(chunk) > dexScreenerChunkSize {
+			t.Errorf("chunk of %d tokens exceeds %d", len(chunk), dexScreenerChunkSize)
+		}
+	}
+}
+
+func TestDexScreenerPriceProviderStatusCodes(t *testing.T) {
+	srv, _ := newDexScreenerStub(t, nil, http.StatusTooManyRequests)
+	p := NewDexScreenerPriceProvider(srv.URL, time.Second, 1)
+
+	prices, err := p.GetPrices(context.Background(), []string{"a"}, "")
+	if err == nil || prices != nil {
+		t.Fatalf("GetPrices = (%v, %v), want an error", prices, err)
+	}
+	if !strings.Contains(err.Error(), "429") {
+		t.Errorf("err = %v, want the 429 status", err)
+	}
+}
@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// programDataPrefix Anchor emit! 输出事件时使用的日志前缀
+const programDataPrefix = "Program data: "
+
+// tradeEventDiscriminator Anchor 事件 TradeEvent 的前 8 字节
+var tradeEventDiscriminator = []byte{189, 219, 127, 211, 78, 230, 97, 238}
+
+// TradeEvent pump.fun 联合曲线上的一笔买入或卖出，金额为链上最小单位
+type TradeEvent struct {
+	Mint                 solana.PublicKey
+	SOLAmount            uint64
+	TokenAmount          uint64
+	IsBuy                bool
+	User                 solana.PublicKey
+	Timestamp            int64
+	VirtualSOLReserves   uint64
+	VirtualTokenReserves uint64
+}
+
+// PriceSOL 成交后联合曲线的价格（SOL），与价格来源的 SOL 价格保留相同的精度
+func (e TradeEvent) PriceSOL() float64 {
+	curve := BondingCurve{VirtualTokenReserves: e.VirtualTokenReserves, VirtualSOLReserves: e.VirtualSOLReserves}
+	return roundPrice(curve.PriceSOL(), SOLMint)
+}
+
+// Time 成交的链上时间
+func (e TradeEvent) Time() time.Time {
+	return time.Unix(e.Timestamp, 0)
+}
+
+// DecodeTradeEvent 解析 TradeEvent 事件数据。新版本程序在末尾追加的字段会被忽略
+func DecodeTradeEvent(data []byte) (*TradeEvent, error) {
+	const size = 8 + 32 + 8 + 8 + 1 + 32 + 8 + 8 + 8
+	if len(data) < size || !bytes.Equal(data[:8], tradeEventDiscriminator) {
+		return nil, fmt.Errorf("not a trade event")
+	}
+	le := binary.LittleEndian
+	event := &TradeEvent{
+		SOLAmount:            le.Uint64(data[40:]),
+		TokenAmount:          le.Uint64(data[48:]),
+		IsBuy:                data[56] != 0,
+		Timestamp:            int64(le.Uint64(data[89:])),
+		VirtualSOLReserves:   le.Uint64(data[97:]),
+		VirtualTokenReserves: le.Uint64(data[105:]),
+	}
+	copy(event.Mint[:], data[8:40])
+	copy(event.User[:], data[57:89])
+	return event, nil
+}
+
+// ParseTradeEvents 从交易日志中提取 TradeEvent，按出现顺序返回
+func ParseTradeEvents(logs []string) []TradeEvent {
+	var events []TradeEvent
+	for _, line := range logs {
+		payload, ok := strings.CutPrefix(line, programDataPrefix)
+		if !ok {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			continue
+		}
+		if event, err := DecodeTradeEvent(data); err == nil {
+			events = append(events, *event)
+		}
+	}
+	return events
+}
+
+// TradeSignature 涉及某个代币的一笔成功交易
+type TradeSignature struct {
+	Signature solana.Signature
+	Slot      uint64
+}
+
+// TradeSignaturePage GetTradeSignatures 读取的一段交易
+type TradeSignaturePage struct {
+	Signatures []TradeSignature // 成功的交易，从旧到新
+	Oldest     solana.Signature // 读到的最旧的交易（包括失败的交易），下一段从这里继续向前翻页
+	Done       bool             // 已经读到 until 或代币的第一笔交易
+}
+
+// GetTradeSignatures 从 before（为空时从最新的交易）开始从新到旧分页读取涉及 mint 的交易，
+// 直到遇到 until 或读满 limit 条。没有读完时用返回的 Oldest 作为下一次的 before
+func (r *BondingCurveReader) GetTradeSignatures(ctx context.Context, mint string, before, until solana.Signature, limit int) (*TradeSignaturePage, error) {
+	mintKey, err := solana.PublicKeyFromBase58(mint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mint %q: %w", mint, err)
+	}
+
+	page := &TradeSignaturePage{Oldest: before}
+	read := 0
+	for read < limit {
+		pageSize := min(limit-read, 1000)
+		result, err := r.client.GetSignaturesForAddressWithOpts(ctx, mintKey, &rpc.GetSignaturesForAddressOpts{
+			Limit:      &pageSize,
+			Before:     page.Oldest,
+			Until:      until,
+			Commitment: rpc.CommitmentConfirmed,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("get signatures for %s: %w", mint, err)
+		}
+		for _, sig := range result {
+			if sig.Err == nil {
+				page.Signatures = append(page.Signatures, TradeSignature{Signature: sig.Signature, Slot: sig.Slot})
+			}
+		}
+		read += len(result)
+		if len(result) > 0 {
+			page.Oldest = result[len(result)-1].Signature
+		}
+		if len(result) < pageSize {
+			page.Done = true
+			break
+		}
+	}
+
+	signatures := page.Signatures
+	for i, j := 0, len(signatures)-1; i < j; i, j = i+1, j-1 {
+		signatures[i], signatures[j] = signatures[j], signatures[i]
+	}
+	return page, nil
+}
+
+// GetTradeEvents 读取一笔交易中的 TradeEvent
+func (r *BondingCurveReader) GetTradeEvents(ctx context.Context, signature solana.Signature) ([]TradeEvent, error) {
+	maxVersion := uint64(0)
+	tx, err := r.client.GetTransaction(ctx, signature, &rpc.GetTransactionOpts{
+		Encoding:                       solana.EncodingBase64,
+		Commitment:                     rpc.CommitmentConfirmed,
+		MaxSupportedTransactionVersion: &maxVersion,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get transaction %s: %w", signature, err)
+	}
+	if tx == nil || tx.Meta == nil {
+		return nil, nil
+	}
+	return ParseTradeEvents(tx.Meta.LogMessages), nil
+}
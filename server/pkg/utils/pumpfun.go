@@ -0,0 +1,199 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// pump.fun 联合曲线账户的常量
+const (
+	pumpTokenDecimals = 6
+	// bondingCurveChunkSize getMultipleAccounts 单次最多查询的账户数
+	bondingCurveChunkSize = 100
+	// pumpInitialRealTokenReserves 新建联合曲线上可供出售的代币数量（最小单位），曲线售空时完成
+	pumpInitialRealTokenReserves = 793_100_000_000_000
+)
+
+// bondingCurveDiscriminator Anchor 账户 BondingCurve 的前 8 字节
+var bondingCurveDiscriminator = []byte{23, 183, 248, 55, 96, 216, 172, 96}
+
+// ErrBondingCurveComplete 联合曲线已完成，代币已迁移到 AMM，曲线上的价格不再有效
+var ErrBondingCurveComplete = fmt.Errorf("bonding curve complete: %w", ErrNoPrice)
+
+// BondingCurve pump.fun 代币的联合曲线账户，储备量为链上最小单位
+type BondingCurve struct {
+	VirtualTokenReserves uint64
+	VirtualSOLReserves   uint64
+	RealTokenReserves    uint64
+	RealSOLReserves      uint64
+	TokenTotalSupply     uint64
+	Complete             bool
+}
+
+// PriceSOL 按虚拟储备计算的代币价格（SOL）
+func (c BondingCurve) PriceSOL() float64 {
+	if c.VirtualTokenReserves == 0 {
+		return 0
+	}
+	sol := float64(c.VirtualSOLReserves) / float64(solana.LAMPORTS_PER_SOL)
+	tokens := float64(c.VirtualTokenReserves) / math.Pow10(pumpTokenDecimals)
+	return sol / tokens
+}
+
+// Progress 联合曲线的完成度（0-1），按已售出的代币占可售代币的比例计算
+func (c BondingCurve) Progress() float64 {
+	if c.Complete || c.RealTokenReserves == 0 {
+		return 1
+	}
+	if c.RealTokenReserves >= pumpInitialRealTokenReserves {
+		return 0
+	}
+	return 1 - float64(c.RealTokenReserves)/pumpInitialRealTokenReserves
+}
+
+// DecodeBondingCurve 解析联合曲线账户数据
+func DecodeBondingCurve(data []byte) (*BondingCurve, error) {
+	const size = 8 + 5*8 + 1
+	if len(data) < size || !bytes.Equal(data[:8], bondingCurveDiscriminator) {
+		return nil, fmt.Errorf("not a bonding curve account")
+	}
+	le := binary.LittleEndian
+	return &BondingCurve{
+		VirtualTokenReserves: le.Uint64(data[8:]),
+		VirtualSOLReserves:   le.Uint64(data[16:]),
+		RealTokenReserves:    le.Uint64(data[24:]),
+		RealSOLReserves:      le.Uint64(data[32:]),
+		TokenTotalSupply:     le.Uint64(data[40:]),
+		Complete:             data[48] != 0,
+	}, nil
+}
+
+// BondingCurveReader 通过 Solana RPC 读取 pump.fun 联合曲线账户
+type BondingCurveReader struct {
+	client    *rpc.Client
+	programID solana.PublicKey
+}
+
+// NewBondingCurveReader 创建联合曲线读取器，programID 为 pump.fun 程序地址
+func NewBondingCurveReader(endpoint, programID string) (*BondingCurveReader, error) {
+	program, err := solana.PublicKeyFromBase58(programID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pump.fun program id: %w", err)
+	}
+	return &BondingCurveReader{client: rpc.New(endpoint), programID: program}, nil
+}
+
+// BondingCurveAddress 代币对应的联合曲线账户地址
+func (r *BondingCurveReader) BondingCurveAddress(mint string) (solana.PublicKey, error) {
+	mintKey, err := solana.PublicKeyFromBase58(mint)
+	if err != nil {
+		return solana.PublicKey{}, fmt.Errorf("invalid mint %q: %w", mint, err)
+	}
+	address, _, err := solana.FindProgramAddress([][]byte{[]byte("bonding-curve"), mintKey[:]}, r.programID)
+	return address, err
+}
+
+// GetBondingCurves 批量读取联合曲线（单次最多 100 个）。账户不存在的代币返回 ErrNoPrice，
+// 返回的 error 表示整批失败
+func (r *BondingCurveReader) GetBondingCurves(ctx context.Context, mints []string) (map[string]*BondingCurve, TokenPriceErrors, error) {
+	curves := make(map[string]*BondingCurve, len(mints))
+	failures := make(TokenPriceErrors)
+
+	var addresses []solana.PublicKey
+	var queried []string
+	for _, mint := range mints {
+		address, err := r.BondingCurveAddress(mint)
+		if err != nil {
+			failures[mint] = err
+			continue
+		}
+		addresses = append(addresses, address)
+		queried = append(queried, mint)
+	}
+	if len(addresses) == 0 {
+		return curves, failures, nil
+	}
+
+	result, err := r.client.GetMultipleAccountsWithOpts(ctx, addresses, &rpc.GetMultipleAccountsOpts{
+		Encoding:   solana.EncodingBase64,
+		Commitment: rpc.CommitmentConfirmed,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("get bonding curve accounts: %w", err)
+	}
+	if result == nil || len(result.Value) != len(addresses) {
+		return nil, nil, fmt.Errorf("unexpected bonding curve accounts response")
+	}
+
+	for i, account := range result.Value {
+		mint := queried[i]
+		if account == nil || account.Data == nil {
+			failures[mint] = ErrNoPrice
+			continue
+		}
+		curve, err := DecodeBondingCurve(account.Data.GetBinary())
+		if err != nil {
+			failures[mint] = err
+			continue
+		}
+		curves[mint] = curve
+	}
+	return curves, failures, nil
+}
+
+// BondingCurvePriceProvider 直接读取 pump.fun 联合曲线计算价格，只适用于尚未迁移的代币。
+// USD 价格由 SOL 价格乘以 solUSD 提供的 SOL/USD 价格得到
+type BondingCurvePriceProvider struct {
+	reader      *BondingCurveReader
+	solUSD      PriceProvider
+	concurrency int
+}
+
+// NewBondingCurvePriceProvider 创建联合曲线价格来源，solUSD 为空时只支持 SOL 计价
+func NewBondingCurvePriceProvider(reader *BondingCurveReader, solUSD PriceProvider, concurrency int) *BondingCurvePriceProvider {
+	if concurrency <= 0 {
+		concurrency = DefaultPriceConcurrency
+	}
+	return &BondingCurvePriceProvider{reader: reader, solUSD: solUSD, concurrency: concurrency}
+}
+
+// GetPrices 实现 PriceProvider
+func (p *BondingCurvePriceProvider) GetPrices(ctx context.Context, mints []string, vsToken string) (map[string]float64, error) {
+	rate := 1.0
+	switch {
+	case vsToken == SOLMint:
+	case vsToken == "" && p.solUSD != nil:
+		solPrices, err := p.solUSD.GetPrices(ctx, []string{SOLMint}, "")
+		if solPrices[SOLMint] <= 0 {
+			if err == nil {
+				err = ErrNoPrice
+			}
+			return nil, fmt.Errorf("get SOL/USD price: %w", err)
+		}
+		rate = solPrices[SOLMint]
+	default:
+		return nil, fmt.Errorf("bonding curve prices do not support vsToken %q", vsToken)
+	}
+
+	return fetchInChunks(ctx, mints, bondingCurveChunkSize, p.concurrency, func(ctx context.Context, chunk []string) (map[string]float64, TokenPriceErrors, error) {
+		curves, failures, err := p.reader.GetBondingCurves(ctx, chunk)
+		if err != nil {
+			return nil, nil, err
+		}
+		prices := make(map[string]float64, len(curves))
+		for mint, curve := range curves {
+			if curve.Complete {
+				failures[mint] = ErrBondingCurveComplete
+				continue
+			}
+			prices[mint] = roundPrice(curve.PriceSOL()*rate, vsToken)
+		}
+		return prices, failures, nil
+	})
+}
@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// testPumpProgramID pump.fun 主网程序地址
+const testPumpProgramID = "6EF8rrecthR5Dkzon8Nwu78hRvfCKubJ14M5uBEwF6P"
+
+// encodeBondingCurve 按链上布局编码联合曲线账户
+func encodeBondingCurve(c BondingCurve) []byte {
+	data := make([]byte, 8+5*8+1)
+	copy(data, bondingCurveDiscriminator)
+	le := binary.LittleEndian
+	le.PutUint64(data[8:], c.VirtualTokenReserves)
+	le.PutUint64(data[16:], c.VirtualSOLReserves)
+	le.PutUint64(data[24:], c.RealTokenReserves)
+	le.PutUint64(data[32:], c.RealSOLReserves)
+	le.PutUint64(data[40:], c.TokenTotalSupply)
+	if c.Complete {
+		data[48] = 1
+	}
+	return data
+}
+
+// newAccountsStub 模拟 Solana RPC 的 getMultipleAccounts，accounts 以账户地址为键，不存在的账户返回 null
+func newAccountsStub(t *testing.T, accounts map[solana.PublicKey][]byte) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage   `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Method != "getMultipleAccounts" || len(req.Params) == 0 {
+			t.Errorf("unexpected RPC request %s: %v", req.Method, err)
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var addresses []solana.PublicKey
+		if err := json.Unmarshal(req.Params[0], &addresses); err != nil {
+			t.Errorf("decode addresses: %v", err)
+		}
+		value := make([]interface{}, len(addresses))
+		for i, address := range addresses {
+			data, ok := accounts[address]
+			if !ok {
+				continue
+			}
+			value[i] = map[string]interface{}{
+				"lamports":   1,
+				"owner":      testPumpProgramID,
+				"data":       []string{base64.StdEncoding.EncodeToString(data), "base64"},
+				"executable": false,
+				"rentEpoch":  0,
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      req.ID,
+			"result":  map[string]interface{}{"context": map[string]int{"slot": 1}, "value": value},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestBondingCurvePriceProvider(t *testing.T) {
+	active := solana.NewWallet().PublicKey().String()
+	complete := solana.NewWallet().PublicKey().String()
+	missing := solana.NewWallet().PublicKey().String()
+
+	// 先用一个不连接的读取器计算联合曲线地址
+	addressOf, err := NewBondingCurveReader("http://127.0.0.1:0", testPumpProgramID)
+	if err != nil {
+		t.Fatalf("NewBondingCurveReader: %v", err)
+	}
+	curve := BondingCurve{
+		VirtualTokenReserves: 1_000_000_000_000_000, // 10 亿代币
+		VirtualSOLReserves:   30 * solana.LAMPORTS_PER_SOL,
+		RealTokenReserves:    pumpInitialRealTokenReserves / 2,
+	}
+	accounts := map[solana.PublicKey][]byte{}
+	for mint, c := range map[string]BondingCurve{active: curve, complete: {VirtualTokenReserves: 1, Complete: true}} {
+		address, err := addressOf.BondingCurveAddress(mint)
+		if err != nil {
+			t.Fatalf("BondingCurveAddress: %v", err)
+		}
+		accounts[address] = encodeBondingCurve(c)
+	}
+	srv := newAccountsStub(t, accounts)
+
+	reader, err := NewBondingCurveReader(srv.URL, testPumpProgramID)
+	if err != nil {
+		t.Fatalf("NewBondingCurveReader: %v", err)
+	}
+	curves, failures, err := reader.GetBondingCurves(context.Background(), []string{active, complete, missing, "not-a-mint"})
+	if err != nil {
+		t.Fatalf("GetBondingCurves: %v", err)
+	}
+	if got := curves[active]; got == nil || *got != curve {
+		t.Errorf("curve of active mint = %+v, want %+v", got, curve)
+	}
+	if got := curves[active].Progress(); math.Abs(got-0.5) > 1e-9 {
+		t.Errorf("progress = %v, want 0.5", got)
+	}
+	if !errors.Is(failures[missing], ErrNoPrice) {
+		t.Errorf("error of missing mint = %v, want ErrNoPrice", failures[missing])
+	}
+	if failures["not-a-mint"] == nil {
+		t.Error("invalid mint not reported")
+	}
+
+	solUSD := NewFakePriceProvider()
+	solUSD.Set(SOLMint, 150)
+	p := NewBondingCurvePriceProvider(reader, solUSD, 1)
+
+	// 30 SOL / 10 亿代币 = 3e-8 SOL
+	prices, err := p.GetPrices(context.Background(), []string{active, complete}, SOLMint)
+	partial, ok := PartialPriceErrors(err)
+	if !ok {
+		t.Fatalf("err = %v, want TokenPriceErrors", err)
+	}
+	if math.Abs(prices[active]-3e-8) > 1e-12 {
+		t.Errorf("SOL price = %v, want 3e-8", prices[active])
+	}
+	if !errors.Is(partial[complete], ErrBondingCurveComplete) {
+		t.Errorf("error of complete curve = %v, want ErrBondingCurveComplete", partial[complete])
+	}
+
+	prices, err = p.GetPrices(context.Background(), []string{active}, "")
+	if err != nil {
+		t.Fatalf("GetPrices in USD: %v", err)
+	}
+	if math.Abs(prices[active]-4.5e-6) > 1e-9 {
+		t.Errorf("USD price = %v, want 4.5e-6", prices[active])
+	}
+
+	// 没有 SOL/USD 价格时整体失败
+	solUSD.Set(SOLMint, 0)
+	if _, err := p.GetPrices(context.Background(), []string{active}, ""); err == nil {
+		t.Error("USD price without SOL/USD accepted")
+	}
+}
+
+func TestNewBondingCurveReaderRejectsInvalidProgram(t *testing.T) {
+	// 旧的默认值多了两个字符，不是有效的公钥
+	if _, err := NewBondingCurveReader("http://127.0.0.1:0", "6EF8rcorrecthR5Dkzon8Nwu78hRvfCKubJ14M5uBEwF6P"); err == nil {
+		t.Error("invalid program id accepted")
+	}
+}
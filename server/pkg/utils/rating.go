@@ -0,0 +1,27 @@
+package utils
+
+import "math"
+
+const (
+	// DefaultRating 新 Agent 的初始 Elo 分数
+	DefaultRating = 1500.0
+	// ratingKFactor Elo 的基础 K 值
+	ratingKFactor = 32.0
+	// decisiveKMultiplier 压倒性胜负（Total Victory / Crushing Defeat）时 K 值的倍数
+	decisiveKMultiplier = 1.5
+)
+
+// ExpectedScore 计算 a 对 b 的期望得分
+func ExpectedScore(ratingA, ratingB float64) float64 {
+	return 1 / (1 + math.Pow(10, (ratingB-ratingA)/400))
+}
+
+// EloDelta 计算 a 的分数变化。score 为 a 的实际得分（胜 1，平 0.5，负 0），
+// decisive 为 true 时按压倒性结果放大 K 值
+func EloDelta(ratingA, ratingB, score float64, decisive bool) float64 {
+	k := ratingKFactor
+	if decisive {
+		k *= decisiveKMultiplier
+	}
+	return k * (score - ExpectedScore(ratingA, ratingB))
+}
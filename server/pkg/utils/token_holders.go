@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// splTokenAccountSize 经典 SPL Token 账户的大小，Token-2022 账户可能带扩展，大小不固定
+const splTokenAccountSize = 165
+
+// HolderStats 代币的持有人统计，份额为占总供应量的比例（0-1）。
+// pump.fun 联合曲线持有的代币不计入持有人和份额
+type HolderStats struct {
+	Holders        int
+	TopHolderShare float64
+	Top10Share     float64
+}
+
+// TokenHolderReader 通过 Solana RPC 统计代币持有人
+type TokenHolderReader struct {
+	client *rpc.Client
+	curves *BondingCurveReader
+}
+
+// NewTokenHolderReader 创建持有人读取器，curves 用于识别联合曲线的代币账户，为空时不排除
+func NewTokenHolderReader(endpoint string, curves *BondingCurveReader) *TokenHolderReader {
+	return &TokenHolderReader{client: rpc.New(endpoint), curves: curves}
+}
+
+// GetHolderStats 用 getProgramAccounts 统计余额大于 0 的代币账户数，用 getTokenLargestAccounts 计算头部持有人的份额
+func (r *TokenHolderReader) GetHolderStats(ctx context.Context, mint string) (HolderStats, error) {
+	mintKey, err := solana.PublicKeyFromBase58(mint)
+	if err != nil {
+		return HolderStats{}, fmt.Errorf("invalid mint %q: %w", mint, err)
+	}
+
+	// 代币账户归属于 mint 所在的程序（SPL Token 或 Token-2022）
+	mintAccount, err := r.client.GetAccountInfoWithOpts(ctx, mintKey, &rpc.GetAccountInfoOpts{Commitment: rpc.CommitmentConfirmed})
+	if err != nil {
+		return HolderStats{}, fmt.Errorf("get mint account %s: %w", mint, err)
+	}
+	program := mintAccount.Value.Owner
+
+	excluded := make(map[solana.PublicKey]bool)
+	if r.curves != nil {
+		if curve, err := r.curves.BondingCurveAddress(mint); err == nil {
+			vault, _, err := solana.FindProgramAddress([][]byte{curve[:], program[:], mintKey[:]}, solana.SPLAssociatedTokenAccountProgramID)
+			if err == nil {
+				excluded[vault] = true
+			}
+		}
+	}
+
+	supply, err := r.client.GetTokenSupply(ctx, mintKey, rpc.CommitmentConfirmed)
+	if err != nil {
+		return HolderStats{}, fmt.Errorf("get token supply of %s: %w", mint, err)
+	}
+	if supply == nil || supply.Value == nil {
+		return HolderStats{}, fmt.Errorf("empty token supply of %s", mint)
+	}
+	total, err := strconv.ParseFloat(supply.Value.Amount, 64)
+	if err != nil {
+		return HolderStats{}, fmt.Errorf("parse token supply of %s: %w", mint, err)
+	}
+
+	var stats HolderStats
+	largest, err := r.client.GetTokenLargestAccounts(ctx, mintKey, rpc.CommitmentConfirmed)
+	if err != nil {
+		return HolderStats{}, fmt.Errorf("get largest accounts of %s: %w", mint, err)
+	}
+	if largest != nil && total > 0 {
+		ranked := 0
+		for _, account := range largest.Value {
+			if excluded[account.Address] {
+				continue
+			}
+			amount, err := strconv.ParseFloat(account.Amount, 64)
+			if err != nil {
+				return HolderStats{}, fmt.Errorf("parse balance of %s: %w", account.Address, err)
+			}
+			if ranked == 0 {
+				stats.TopHolderShare = amount / total
+			}
+			if ranked < 10 {
+				stats.Top10Share += amount / total
+			}
+			ranked++
+		}
+	}
+
+	// 只取余额字段（偏移 64 的 u64），避免拉取完整账户数据
+	offset, length := uint64(64), uint64(8)
+	filters := []rpc.RPCFilter{{Memcmp: &rpc.RPCFilterMemcmp{Offset: 0, Bytes: mintKey[:]}}}
+	if program.Equals(solana.TokenProgramID) {
+		filters = append(filters, rpc.RPCFilter{DataSize: splTokenAccountSize})
+	}
+	accounts, err := r.client.GetProgramAccountsWithOpts(ctx, program, &rpc.GetProgramAccountsOpts{
+		Commitment: rpc.CommitmentConfirmed,
+		Encoding:   solana.EncodingBase64,
+		DataSlice:  &rpc.DataSlice{Offset: &offset, Length: &length},
+		Filters:    filters,
+	})
+	if err != nil {
+		return HolderStats{}, fmt.Errorf("get token accounts of %s: %w", mint, err)
+	}
+	for _, account := range accounts {
+		if excluded[account.Pubkey] || account.Account == nil || account.Account.Data == nil {
+			continue
+		}
+		data := account.Account.Data.GetBinary()
+		if len(data) >= 8 && binary.LittleEndian.Uint64(data) > 0 {
+			stats.Holders++
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// TokenSupply 代币的链上供应量，Amount 已按 Decimals 换算
+type TokenSupply struct {
+	Amount   float64
+	Decimals int
+}
+
+// SupplyProvider 读取代币的链上供应量
+type SupplyProvider interface {
+	GetTokenSupply(ctx context.Context, mint string) (TokenSupply, error)
+}
+
+// RPCSupplyProvider 通过 Solana RPC 的 getTokenSupply 读取供应量
+type RPCSupplyProvider struct {
+	client *rpc.Client
+}
+
+// NewRPCSupplyProvider 创建基于 Solana RPC 的供应量来源
+func NewRPCSupplyProvider(endpoint string) *RPCSupplyProvider {
+	return &RPCSupplyProvider{client: rpc.New(endpoint)}
+}
+
+// GetTokenSupply 实现 SupplyProvider
+func (p *RPCSupplyProvider) GetTokenSupply(ctx context.Context, mint string) (TokenSupply, error) {
+	pubkey, err := solana.PublicKeyFromBase58(mint)
+	if err != nil {
+		return TokenSupply{}, fmt.Errorf("invalid mint %q: %w", mint, err)
+	}
+	result, err := p.client.GetTokenSupply(ctx, pubkey, rpc.CommitmentConfirmed)
+	if err != nil {
+		return TokenSupply{}, fmt.Errorf("get token supply of %s: %w", mint, err)
+	}
+	if result == nil || result.Value == nil {
+		return TokenSupply{}, fmt.Errorf("empty token supply of %s", mint)
+	}
+	raw, err := strconv.ParseFloat(result.Value.Amount, 64)
+	if err != nil {
+		return TokenSupply{}, fmt.Errorf("parse token supply of %s: %w", mint, err)
+	}
+	decimals := int(result.Value.Decimals)
+	return TokenSupply{Amount: raw / math.Pow10(decimals), Decimals: decimals}, nil
+}
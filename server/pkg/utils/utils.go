@@ -16,14 +16,17 @@ func ParsePage(pageStr string) (int, error) {
 	return page, nil
 }
 
+// DefaultPageSize 未指定或无法解析每页大小时使用的默认值
+const DefaultPageSize = 4
+
 // ParsePageSize 解析每页大小字符串，转换为 int。若转换失败则返回错误
 func ParsePageSize(pageSizeStr string) (int, error) {
 	if pageSizeStr == "" {
-		return 4, nil
+		return DefaultPageSize, nil
 	}
 	pageSize, err := strconv.Atoi(pageSizeStr)
 	if err != nil || pageSize < 1 {
-		return 4, err
+		return DefaultPageSize, err
 	}
 	return pageSize, nil
 }
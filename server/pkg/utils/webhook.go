@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// WebhookSignatureHeader 请求体 HMAC-SHA256 签名（十六进制）所在的请求头，只在配置了密钥时发送
+const WebhookSignatureHeader = "X-Webhook-Signature"
+
+// webhookAttempts 单个地址的最大投递次数
+const webhookAttempts = 3
+
+// WebhookEvent 推送给 webhook 的事件
+type WebhookEvent struct {
+	Type      string      `json:"type"`
+	Data      interface{} `json:"data"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// WebhookNotifier 把事件以 JSON POST 到配置的地址，失败时按指数退避重试
+type WebhookNotifier struct {
+	urls   []string
+	secret string
+	client *http.Client
+}
+
+// NewWebhookNotifier 创建 webhook 推送器，urls 为空时不推送
+func NewWebhookNotifier(urls []string, secret string, timeout time.Duration) *WebhookNotifier {
+	return &WebhookNotifier{urls: urls, secret: secret, client: &http.Client{Timeout: timeout}}
+}
+
+// Enabled 是否配置了 webhook 地址
+func (n *WebhookNotifier) Enabled() bool {
+	return n != nil && len(n.urls) > 0
+}
+
+// Notify 向所有地址推送事件，返回每个投递失败的地址及其错误
+func (n *WebhookNotifier) Notify(ctx context.Context, eventType string, data interface{}) map[string]error {
+	if !n.Enabled() {
+		return nil
+	}
+	body, err := json.Marshal(WebhookEvent{Type: eventType, Data: data, CreatedAt: time.Now()})
+	if err != nil {
+		failures := make(map[string]error, len(n.urls))
+		for _, url := range n.urls {
+			failures[url] = fmt.Errorf("marshal webhook event: %w", err)
+		}
+		return failures
+	}
+
+	failures := make(map[string]error)
+	for _, url := range n.urls {
+		if err := n.deliver(ctx, url, body); err != nil {
+			failures[url] = err
+		}
+	}
+	return failures
+}
+
+// deliver 投递到单个地址，最多尝试 webhookAttempts 次
+func (n *WebhookNotifier) deliver(ctx context.Context, url string, body []byte) error {
+	var err error
+	backoff := time.Second
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		if err = n.post(ctx, url, body); err == nil {
+			return nil
+		}
+		if attempt == webhookAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	return err
+}
+
+func (n *WebhookNotifier) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.secret))
+		mac.Write(body)
+		req.Header.Set(WebhookSignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("webhook request failed, status: %s, body: %s", resp.Status, string(respBody))
+	}
+	return nil
+}